@@ -0,0 +1,345 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+const (
+    AppName = "tanita2csv"
+    EnvPrefix = "TANITA2CSV_"
+    DefaultURL = "https://www.healthplanet.jp"
+    DefaultConfigFile = "config.yml"
+    DefaultTokenFile = "token.json"
+    DefaultArchiveFile = "archive.jsonl"
+)
+
+type Config struct {
+    URL          string `yaml:"url"`
+    TokenFile    string `yaml:"token_file"`
+    ClientID     string `yaml:"client_id"`
+    ClientSecret string `yaml:"client_secret"`
+    Output       string `yaml:"output"`
+    ArchiveFile  string `yaml:"archive_file"`
+    // time zones (IANA names, e.g. "Asia/Tokyo", or "Local")
+    Timezone       string `yaml:"timezone"`        // for the day boundaries of -f/-t (default: Local)
+    OutputTimezone string `yaml:"output_timezone"` // for the dates in the output (default: timezone)
+    APITimezone    string `yaml:"api_timezone"`    // of the HealthPlanet API (default: Asia/Tokyo)
+    // bounds of the weight (kg) for the outlier filter, 0 is no bound
+    MinWeight    float64 `yaml:"min_weight"`
+    MaxWeight    float64 `yaml:"max_weight"`
+    // goals for goal mode, 0 or empty is no goal
+    GoalWeight   float64 `yaml:"goal_weight"`   // kg
+    GoalBodyFat  float64 `yaml:"goal_body_fat"` // %
+    GoalDate     string  `yaml:"goal_date"`     // YYYY-MM-DD
+    InfluxDB     InfluxConfig `yaml:"influxdb"`
+    MQTT         MQTTConfig `yaml:"mqtt"`
+    Webhooks     []*WebhookConfig `yaml:"webhooks"`
+    Garmin       GarminConfig `yaml:"garmin"`
+    APIKeys      []string `yaml:"api_keys"` // keys of the API served by serve mode
+    Profiles     map[string]*Profile `yaml:"profiles"`
+
+    // path of the loaded config file, empty if the config comes only from environment variables
+    path string
+    // line numbers of the keys in the config file (key: dotted path, e.g. "client_id")
+    lines map[string]int
+    // environment variables used to override the fields (key: dotted path)
+    env map[string]string
+    // problems found while decoding the config file
+    problems []ConfigProblem
+    // kinds of the files written by the mode (e.g. "token_file"), which Validate checks to be writable
+    writes map[string]bool
+}
+
+// envFields calls fn with the dotted path and the value of every field which can be overridden by environment variables,
+// following the yaml tags (e.g. "influxdb.token" -> TANITA2CSV_INFLUXDB_TOKEN, see envName).
+// The fields of the webhooks are of the webhooks in the config file, by their index.
+// Maps (headers and profiles) are not walked, as their keys are not known in advance.
+func envFields(v reflect.Value, prefix string, fn func(key string, field reflect.Value)) {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+        if name == "" || name == "-" {
+            continue
+        }
+        key := prefix + name
+        field := v.Field(i)
+        switch {
+        case field.Kind() == reflect.Struct:
+            envFields(field, key+".", fn)
+        case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Pointer:
+            for j := 0; j < field.Len(); j++ {
+                if elem := field.Index(j); !elem.IsNil() && elem.Elem().Kind() == reflect.Struct {
+                    envFields(elem.Elem(), fmt.Sprintf("%s[%d].", key, j), fn)
+                }
+            }
+        case field.Kind() == reflect.Map:
+        default:
+            fn(key, field)
+        }
+    }
+}
+
+// setField sets the field to the value of an environment variable.
+// An empty value sets the zero value, and a list is separated by commas.
+func setField(field reflect.Value, value string) error {
+    if field.Kind() == reflect.Pointer {
+        if value == "" {
+            field.Set(reflect.Zero(field.Type()))
+            return nil
+        }
+        elem := reflect.New(field.Type().Elem())
+        if err := setField(elem.Elem(), value); err != nil {
+            return err
+        }
+        field.Set(elem)
+        return nil
+    }
+    if value == "" {
+        field.Set(reflect.Zero(field.Type()))
+        return nil
+    }
+    switch field.Kind() {
+    case reflect.String:
+        field.SetString(value)
+    case reflect.Float64:
+        f, err := strconv.ParseFloat(value, 64)
+        if err != nil {
+            return errors.New("not a number")
+        }
+        field.SetFloat(f)
+    case reflect.Int:
+        n, err := strconv.Atoi(value)
+        if err != nil {
+            return errors.New("not an integer")
+        }
+        field.SetInt(int64(n))
+    case reflect.Bool:
+        b, err := strconv.ParseBool(value)
+        if err != nil {
+            return errors.New("not a boolean (true or false)")
+        }
+        field.SetBool(b)
+    case reflect.Slice:
+        var list []string
+        for _, item := range strings.Split(value, ",") {
+            if item = strings.TrimSpace(item); item != "" {
+                list = append(list, item)
+            }
+        }
+        field.Set(reflect.ValueOf(list))
+    default:
+        return fmt.Errorf("unsupported type %s", field.Type())
+    }
+    return nil
+}
+
+// envName returns the environment variable name of the dotted path, e.g. "webhooks[0].secret" -> TANITA2CSV_WEBHOOKS_0_SECRET
+func envName(key string) string {
+    return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "[", "_", "]", "").Replace(key))
+}
+
+// lookupEnv returns the value of the environment variable, or the content of the file named by <name>_FILE
+// (e.g. a Docker secret) without the trailing newline. The variable itself takes precedence over the file.
+func (c *Config) lookupEnv(key string) (string, bool) {
+    name := envName(key)
+    if value, ok := os.LookupEnv(name); ok {
+        c.env[key] = name
+        return value, true
+    }
+    path, ok := os.LookupEnv(name + "_FILE")
+    if !ok {
+        return "", false
+    }
+    c.env[key] = name + "_FILE"
+    content, err := os.ReadFile(path)
+    if err != nil {
+        c.problems = append(c.problems, ConfigProblem{Source: name + "_FILE", Key: key, Message: fmt.Sprintf("failed to read: %v", err)})
+        return "", false
+    }
+    return strings.TrimRight(string(content), "\r\n"), true
+}
+
+func (c *Config) applyEnv() {
+    envFields(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value) {
+        value, ok := c.lookupEnv(key)
+        if !ok {
+            return
+        }
+        if err := setField(field, value); err != nil {
+            c.problems = append(c.problems, ConfigProblem{Source: c.env[key], Key: key, Message: fmt.Sprintf("invalid value %q: %v", value, err)})
+        }
+    })
+}
+
+// Locations returns the time zones of the API, of the query (-f/-t) and of the output.
+func (c *Config) Locations() (api *time.Location, query *time.Location, output *time.Location, err error) {
+    api = healthplanet.DefaultAPILocation
+    if c.APITimezone != "" {
+        api, err = time.LoadLocation(c.APITimezone)
+        if err != nil {
+            return nil, nil, nil, fmt.Errorf("invalid api_timezone: %w", err)
+        }
+    }
+    query = time.Local
+    if c.Timezone != "" {
+        query, err = time.LoadLocation(c.Timezone)
+        if err != nil {
+            return nil, nil, nil, fmt.Errorf("invalid timezone: %w", err)
+        }
+    }
+    output = query
+    if c.OutputTimezone != "" {
+        output, err = time.LoadLocation(c.OutputTimezone)
+        if err != nil {
+            return nil, nil, nil, fmt.Errorf("invalid output_timezone: %w", err)
+        }
+    }
+    return api, query, output, nil
+}
+
+// Path returns the path of the loaded config file.
+func (c *Config) Path() string {
+    return c.path
+}
+
+// Dir returns the directory that relative paths in the config are resolved against.
+func (c *Config) Dir() string {
+    if c.path == "" {
+        return "."
+    }
+    return filepath.Dir(c.path)
+}
+
+// resolvePath makes a relative path in the config file relative to the config file's directory.
+func (c *Config) resolvePath(path string) string {
+    if path == "" || filepath.IsAbs(path) {
+        return path
+    }
+    return filepath.Join(c.Dir(), path)
+}
+
+// xdgDir returns $<env>/tanita2csv, or ~/<fallback>/tanita2csv if the variable is not set.
+// Relative values are ignored as required by the XDG Base Directory Specification.
+func xdgDir(env string, fallback string) string {
+    base := os.Getenv(env)
+    if base == "" || !filepath.IsAbs(base) {
+        home, err := os.UserHomeDir()
+        if err != nil {
+            return ""
+        }
+        base = filepath.Join(home, fallback)
+    }
+    return filepath.Join(base, AppName)
+}
+
+func ConfigDir() string {
+    return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+func StateDir() string {
+    return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// configSearchPaths returns the candidates of the config file in priority order.
+func configSearchPaths() []string {
+    paths := []string{DefaultConfigFile}
+    if dir := ConfigDir(); dir != "" {
+        paths = append(paths, filepath.Join(dir, DefaultConfigFile))
+    }
+    dirs := os.Getenv("XDG_CONFIG_DIRS")
+    if dirs == "" {
+        dirs = "/etc/xdg"
+    }
+    for _, dir := range filepath.SplitList(dirs) {
+        if filepath.IsAbs(dir) {
+            paths = append(paths, filepath.Join(dir, AppName, DefaultConfigFile))
+        }
+    }
+    return paths
+}
+
+// findConfigFile returns the config file to load.
+// If filePath is given (by -c or TANITA2CSV_CONFIG), it must exist.
+// Otherwise the search paths are tried and an empty string is returned if none of them exists.
+func findConfigFile(filePath string) (string, error) {
+    if filePath == "" {
+        filePath = os.Getenv(EnvPrefix + "CONFIG")
+    }
+    if filePath != "" {
+        if _, err := os.Stat(filePath); err != nil {
+            return "", fmt.Errorf("failed to find config file: %w", err)
+        }
+        return filePath, nil
+    }
+
+    for _, path := range configSearchPaths() {
+        if _, err := os.Stat(path); err == nil {
+            return path, nil
+        }
+    }
+    return "", nil
+}
+
+// readConfig reads the config file (if any) and applies the environment variables.
+// Problems in the file content are recorded and reported by Validate, so that all of them can be shown at once.
+func readConfig(filePath string) (*Config, error) {
+    path, err := findConfigFile(filePath)
+    if err != nil {
+        return nil, err
+    }
+
+    config := Config{URL: DefaultURL, path: path, lines: map[string]int{}, env: map[string]string{}}
+    if path != "" {
+        content, err := os.ReadFile(path)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read config file: %w", err)
+        }
+        config.decode(content)
+        config.TokenFile = config.resolvePath(config.TokenFile)
+        config.Output = config.resolvePath(config.Output)
+        config.ArchiveFile = config.resolvePath(config.ArchiveFile)
+        config.MQTT.CAFile = config.resolvePath(config.MQTT.CAFile)
+        for _, w := range config.Webhooks {
+            w.DeadLetterFile = config.resolvePath(w.DeadLetterFile)
+        }
+        config.Garmin.StateFile = config.resolvePath(config.Garmin.StateFile)
+        config.resolveProfiles()
+    }
+
+    // environment variables take precedence over the config file
+    config.applyEnv()
+
+    if config.TokenFile == "" {
+        config.TokenFile = filepath.Join(StateDir(), DefaultTokenFile)
+    }
+    if config.ArchiveFile == "" {
+        config.ArchiveFile = filepath.Join(StateDir(), DefaultArchiveFile)
+    }
+
+    return &config, nil
+}
+
+// loadConfig reads the config and fails if it has any problem.
+// writes are the kinds of the files which the mode writes (e.g. "token_file"), which must be writable.
+func loadConfig(filePath string, writes ...string) (*Config, error) {
+    config, err := readConfig(filePath)
+    if err != nil {
+        return nil, err
+    }
+    config.writes = map[string]bool{}
+    for _, kind := range writes {
+        config.writes[kind] = true
+    }
+    if problems := config.Validate(); len(problems) > 0 {
+        return nil, &ConfigError{Problems: problems}
+    }
+    return config, nil
+}
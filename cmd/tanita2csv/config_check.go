@@ -0,0 +1,361 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "net/url"
+    "os"
+    "path/filepath"
+    "reflect"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+    "gopkg.in/yaml.v3"
+)
+
+// ConfigProblem is a problem found in the config.
+type ConfigProblem struct {
+    Source string // config file path or environment variable name
+    Line int      // line number in the config file, 0 if unknown
+    Key string    // dotted path of the key, e.g. "client_id"
+    Message string
+}
+
+func (p ConfigProblem) String() string {
+    location := p.Source
+    if p.Line > 0 {
+        location = fmt.Sprintf("%s:%d", p.Source, p.Line)
+    }
+    if location == "" {
+        location = "(config)"
+    }
+    if p.Key == "" {
+        return fmt.Sprintf("%s: %s", location, p.Message)
+    }
+    return fmt.Sprintf("%s: %s: %s", location, p.Key, p.Message)
+}
+
+type ConfigError struct {
+    Problems []ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+    messages := make([]string, 0, len(e.Problems))
+    for _, p := range e.Problems {
+        messages = append(messages, p.String())
+    }
+    return fmt.Sprintf("invalid config (%d problems): %s", len(e.Problems), strings.Join(messages, "; "))
+}
+
+// placeholderPattern matches values copied from config.example.yml without editing, e.g. "<your_client_id>"
+var placeholderPattern = regexp.MustCompile(`^<.*>$|(?i)^your[_-]|^changeme$|^x{3,}$`)
+
+// decode decodes the config file content.
+// Unknown keys and type errors are recorded as problems instead of failing at the first one.
+func (c *Config) decode(content []byte) {
+    var root yaml.Node
+    err := yaml.Unmarshal(content, &root)
+    if err != nil {
+        c.problems = append(c.problems, ConfigProblem{Source: c.path, Message: err.Error()})
+        return
+    }
+    if len(root.Content) == 0 {
+        // empty file
+        return
+    }
+    doc := root.Content[0]
+    if doc.Kind != yaml.MappingNode {
+        c.problems = append(c.problems, ConfigProblem{Source: c.path, Line: doc.Line, Message: "config must be a mapping of keys and values"})
+        return
+    }
+
+    c.problems = append(c.problems, c.checkKeys(doc, reflect.TypeOf(*c), "")...)
+
+    err = doc.Decode(c)
+    var typeErr *yaml.TypeError
+    if errors.As(err, &typeErr) {
+        for _, e := range typeErr.Errors {
+            c.problems = append(c.problems, ConfigProblem{Source: c.path, Message: e})
+        }
+    } else if err != nil {
+        c.problems = append(c.problems, ConfigProblem{Source: c.path, Message: err.Error()})
+    }
+}
+
+// checkKeys walks the mapping node along with the struct type,
+// records the line number of every key and reports the keys which do not exist in the struct.
+func (c *Config) checkKeys(node *yaml.Node, t reflect.Type, prefix string) []ConfigProblem {
+    var problems []ConfigProblem
+
+    fields := map[string]reflect.Type{}
+    for i := 0; i < t.NumField(); i++ {
+        name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+        if name != "" && name != "-" {
+            fields[name] = t.Field(i).Type
+        }
+    }
+
+    for i := 0; i+1 < len(node.Content); i += 2 {
+        key, value := node.Content[i], node.Content[i+1]
+        path := prefix + key.Value
+        c.lines[path] = key.Line
+
+        fieldType, ok := fields[key.Value]
+        if !ok {
+            problems = append(problems, ConfigProblem{Source: c.path, Line: key.Line, Key: path, Message: "unknown key"})
+            continue
+        }
+        for fieldType.Kind() == reflect.Pointer {
+            fieldType = fieldType.Elem()
+        }
+        switch {
+        case fieldType.Kind() == reflect.Struct && value.Kind == yaml.MappingNode:
+            problems = append(problems, c.checkKeys(value, fieldType, path+".")...)
+        case fieldType.Kind() == reflect.Slice && value.Kind == yaml.SequenceNode:
+            elemType := fieldType.Elem()
+            for elemType.Kind() == reflect.Pointer {
+                elemType = elemType.Elem()
+            }
+            for j, elem := range value.Content {
+                elemPath := fmt.Sprintf("%s[%d]", path, j)
+                c.lines[elemPath] = elem.Line
+                if elemType.Kind() == reflect.Struct && elem.Kind == yaml.MappingNode {
+                    problems = append(problems, c.checkKeys(elem, elemType, elemPath+".")...)
+                }
+            }
+        case fieldType.Kind() == reflect.Map && value.Kind == yaml.MappingNode:
+            elemType := fieldType.Elem()
+            for elemType.Kind() == reflect.Pointer {
+                elemType = elemType.Elem()
+            }
+            if elemType.Kind() != reflect.Struct {
+                continue
+            }
+            for j := 0; j+1 < len(value.Content); j += 2 {
+                name, elem := value.Content[j], value.Content[j+1]
+                c.lines[path+"."+name.Value] = name.Line
+                if elem.Kind == yaml.MappingNode {
+                    problems = append(problems, c.checkKeys(elem, elemType, path+"."+name.Value+".")...)
+                }
+            }
+        }
+    }
+    return problems
+}
+
+// problem builds a ConfigProblem for the key, pointing to where its value came from.
+func (c *Config) problem(key string, format string, args ...any) ConfigProblem {
+    // an element of a list overridden as a whole, e.g. api_keys[1] of TANITA2CSV_API_KEYS
+    list, _, _ := strings.Cut(key, "[")
+    for _, k := range []string{key, list} {
+        if env, ok := c.env[k]; ok {
+            return ConfigProblem{Source: env, Key: key, Message: fmt.Sprintf(format, args...)}
+        }
+    }
+    return ConfigProblem{Source: c.path, Line: c.lines[key], Key: key, Message: fmt.Sprintf(format, args...)}
+}
+
+func (c *Config) checkRequired(key string, value string) []ConfigProblem {
+    if value == "" {
+        if strings.Contains(key, ".") {
+            return []ConfigProblem{c.problem(key, "required but not set")}
+        }
+        return []ConfigProblem{c.problem(key, "required but not set (set it in the config file or %s)", envName(key))}
+    }
+    if placeholderPattern.MatchString(value) {
+        return []ConfigProblem{c.problem(key, "looks like a placeholder (%q), replace it with the actual value", value)}
+    }
+    return nil
+}
+
+func (c *Config) checkURL(key string, value string) []ConfigProblem {
+    if value == "" {
+        return []ConfigProblem{c.problem(key, "required but not set")}
+    }
+    u, err := url.Parse(value)
+    if err != nil {
+        return []ConfigProblem{c.problem(key, "invalid URL: %v", err)}
+    }
+    if u.Scheme != "http" && u.Scheme != "https" {
+        return []ConfigProblem{c.problem(key, "URL scheme must be http or https (%q)", value)}
+    }
+    if u.Host == "" {
+        return []ConfigProblem{c.problem(key, "URL has no host (%q)", value)}
+    }
+    return nil
+}
+
+func (c *Config) checkTimezone(key string, value string) []ConfigProblem {
+    if value == "" {
+        return nil
+    }
+    if _, err := time.LoadLocation(value); err != nil {
+        return []ConfigProblem{c.problem(key, "unknown time zone %q (use an IANA name such as \"Asia/Tokyo\", \"UTC\" or \"Local\")", value)}
+    }
+    return nil
+}
+
+// checkWeightBounds checks min_weight and max_weight, prefix is the path of their parent (e.g. "profiles.kid.").
+func (c *Config) checkWeightBounds(prefix string, min float64, max float64) []ConfigProblem {
+    var problems []ConfigProblem
+    if min < 0 {
+        problems = append(problems, c.problem(prefix+"min_weight", "must not be negative (%g)", min))
+    }
+    if max < 0 {
+        problems = append(problems, c.problem(prefix+"max_weight", "must not be negative (%g)", max))
+    }
+    if min > 0 && max > 0 && min >= max {
+        problems = append(problems, c.problem(prefix+"max_weight", "must be greater than min_weight (%g >= %g)", min, max))
+    }
+    return problems
+}
+
+// checkGoals checks goal_weight, goal_body_fat and goal_date, prefix is the path of their parent.
+func (c *Config) checkGoals(prefix string, weight float64, bodyFat float64, date string) []ConfigProblem {
+    var problems []ConfigProblem
+    if weight < 0 {
+        problems = append(problems, c.problem(prefix+"goal_weight", "must not be negative (%g)", weight))
+    }
+    if bodyFat < 0 || bodyFat >= 100 {
+        problems = append(problems, c.problem(prefix+"goal_body_fat", "must be between 0 and 100 (%g)", bodyFat))
+    }
+    if date != "" {
+        if _, err := time.Parse("2006-01-02", date); err != nil {
+            problems = append(problems, c.problem(prefix+"goal_date", "invalid date %q (use YYYY-MM-DD)", date))
+        } else if weight == 0 && bodyFat == 0 {
+            problems = append(problems, c.problem(prefix+"goal_date", "set but no goal_weight nor goal_body_fat"))
+        }
+    }
+    return problems
+}
+
+// checkWritable checks that the file can be written, or created in the nearest existing ancestor directory
+// (the parent directories are created when the file is written). Writing a probe file is skipped
+// unless the kind of the file (the last part of the key, e.g. token_file) is in c.writes,
+// so that the modes which do not write it run on a read-only file system.
+func (c *Config) checkWritable(key string, path string) []ConfigProblem {
+    if !c.writes[key[strings.LastIndex(key, ".")+1:]] {
+        return nil
+    }
+    info, err := os.Stat(path)
+    if err == nil {
+        if info.IsDir() {
+            return []ConfigProblem{c.problem(key, "%s is a directory", path)}
+        }
+        f, err := os.OpenFile(path, os.O_WRONLY, 0)
+        if err != nil {
+            return []ConfigProblem{c.problem(key, "not writable: %v", err)}
+        }
+        f.Close()
+        return nil
+    }
+    if !errors.Is(err, os.ErrNotExist) {
+        return []ConfigProblem{c.problem(key, "cannot access: %v", err)}
+    }
+
+    // the file will be created on the nearest existing ancestor directory
+    dir := filepath.Dir(path)
+    for {
+        info, err := os.Stat(dir)
+        if err == nil {
+            if !info.IsDir() {
+                return []ConfigProblem{c.problem(key, "%s is not a directory", dir)}
+            }
+            break
+        }
+        parent := filepath.Dir(dir)
+        if parent == dir {
+            return []ConfigProblem{c.problem(key, "cannot access: %v", err)}
+        }
+        dir = parent
+    }
+    f, err := os.CreateTemp(dir, "."+AppName+"-check-*")
+    if err != nil {
+        return []ConfigProblem{c.problem(key, "directory %s is not writable: %v", dir, err)}
+    }
+    f.Close()
+    os.Remove(f.Name())
+    return nil
+}
+
+// Validate returns all problems of the config.
+func (c *Config) Validate() []ConfigProblem {
+    problems := append([]ConfigProblem{}, c.problems...)
+
+    problems = append(problems, c.checkURL("url", c.URL)...)
+    problems = append(problems, c.checkTimezone("timezone", c.Timezone)...)
+    problems = append(problems, c.checkTimezone("output_timezone", c.OutputTimezone)...)
+    problems = append(problems, c.checkTimezone("api_timezone", c.APITimezone)...)
+    problems = append(problems, c.checkWeightBounds("", c.MinWeight, c.MaxWeight)...)
+    problems = append(problems, c.checkGoals("", c.GoalWeight, c.GoalBodyFat, c.GoalDate)...)
+    problems = append(problems, c.validateInflux()...)
+    problems = append(problems, c.validateMQTT()...)
+    problems = append(problems, c.validateWebhooks()...)
+    problems = append(problems, c.validateGarmin("garmin.", &c.Garmin, DefaultProfile)...)
+    for i, key := range c.APIKeys {
+        problems = append(problems, c.checkRequired(fmt.Sprintf("api_keys[%d]", i), key)...)
+    }
+
+    if len(c.Profiles) == 0 {
+        problems = append(problems, c.checkRequired("client_id", c.ClientID)...)
+        problems = append(problems, c.checkRequired("client_secret", c.ClientSecret)...)
+        problems = append(problems, c.checkWritable("token_file", c.TokenFile)...)
+        problems = append(problems, c.checkWritable("archive_file", c.ArchiveFile)...)
+    } else {
+        // the top level values are only defaults of the profiles
+        if c.ClientID != "" {
+            problems = append(problems, c.checkRequired("client_id", c.ClientID)...)
+        }
+        if c.ClientSecret != "" {
+            problems = append(problems, c.checkRequired("client_secret", c.ClientSecret)...)
+        }
+        problems = append(problems, c.validateProfiles()...)
+    }
+
+    return problems
+}
+
+// runConfigCheck prints every problem of the config and returns the exit code.
+func runConfigCheck(w io.Writer, filePath string) int {
+    config, err := readConfig(filePath)
+    if err != nil {
+        fmt.Fprintln(w, err)
+        return 1
+    }
+
+    if config.Path() == "" {
+        fmt.Fprintf(w, "config file: (not found, searched: %s)\n", strings.Join(configSearchPaths(), ", "))
+    } else {
+        fmt.Fprintf(w, "config file: %s\n", config.Path())
+    }
+    if len(config.Profiles) == 0 {
+        fmt.Fprintf(w, "token file: %s\n", config.TokenFile)
+    }
+    for _, name := range config.ProfileNames() {
+        if profile, err := config.Profile(name); err == nil {
+            fmt.Fprintf(w, "profile %s: token file: %s\n", name, profile.TokenFile)
+        }
+    }
+    keys := make([]string, 0, len(config.env))
+    for key := range config.env {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        fmt.Fprintf(w, "%s: overridden by %s\n", key, config.env[key])
+    }
+
+    config.writes = map[string]bool{"token_file": true, "archive_file": true, "dead_letter_file": true, "state_file": true}
+    problems := config.Validate()
+    if len(problems) == 0 {
+        fmt.Fprintln(w, "OK")
+        return 0
+    }
+    for _, p := range problems {
+        fmt.Fprintln(w, p.String())
+    }
+    fmt.Fprintf(w, "%d problems found\n", len(problems))
+    return 1
+}
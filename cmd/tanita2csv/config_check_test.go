@@ -0,0 +1,160 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// findProblem returns the problem of the key, or nil.
+func findProblem(problems []ConfigProblem, key string) *ConfigProblem {
+    for i := range problems {
+        if problems[i].Key == key {
+            return &problems[i]
+        }
+    }
+    return nil
+}
+
+func TestConfigUnknownKeys(t *testing.T) {
+    path := writeConfig(t, `client_id: id
+clinet_secret: secret
+mqtt:
+  broker: tcp://localhost:1883
+  pasword: secret
+webhooks:
+  - url: http://localhost/hook
+    retry: 3
+profiles:
+  kid:
+    client_id: kid
+    client_secret: kid
+    goal: 30
+`)
+    config, err := readConfig(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    problems := config.Validate()
+
+    tests := []struct {
+        key string
+        line int
+    }{
+        {"clinet_secret", 2},
+        {"mqtt.pasword", 5},
+        {"webhooks[0].retry", 8},
+        {"profiles.kid.goal", 13},
+    }
+    for _, tt := range tests {
+        p := findProblem(problems, tt.key)
+        if p == nil {
+            t.Errorf("no problem of %s in %v", tt.key, problems)
+            continue
+        }
+        want := fmt.Sprintf("%s:%d: %s: unknown key", path, tt.line, tt.key)
+        if p.String() != want {
+            t.Errorf("problem = %q, want %q", p.String(), want)
+        }
+    }
+    if p := findProblem(problems, "mqtt.broker"); p != nil {
+        t.Errorf("known key reported: %v", p)
+    }
+}
+
+func TestConfigPlaceholders(t *testing.T) {
+    tests := []struct {
+        value string
+        placeholder bool
+    }{
+        {"<your_client_id>", true},
+        {"your_client_secret", true},
+        {"Your-Secret", true},
+        {"changeme", true},
+        {"xxxxxxxx", true},
+        {"3f2a9c1b", false},
+        {"xx", false},
+        {"ayour_secret", false},
+    }
+    for _, tt := range tests {
+        path := writeConfig(t, fmt.Sprintf("client_id: %q\nclient_secret: real\n", tt.value))
+        config, err := readConfig(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        p := findProblem(config.Validate(), "client_id")
+        if (p != nil) != tt.placeholder {
+            t.Errorf("client_id %q: problem = %v, want placeholder %v", tt.value, p, tt.placeholder)
+            continue
+        }
+        if p != nil && (p.Line != 1 || !strings.Contains(p.Message, "placeholder")) {
+            t.Errorf("client_id %q: problem = %q", tt.value, p.String())
+        }
+    }
+}
+
+func TestConfigWritable(t *testing.T) {
+    dir := t.TempDir()
+    // a regular file where a directory is expected
+    blocker := filepath.Join(dir, "blocker")
+    if err := os.WriteFile(blocker, nil, 0600); err != nil {
+        t.Fatal(err)
+    }
+    path := writeConfig(t, fmt.Sprintf("client_id: id\nclient_secret: secret\ntoken_file: %s\narchive_file: %s\n",
+        filepath.Join(blocker, "token.json"), dir))
+
+    tests := []struct {
+        writes []string
+        keys []string
+    }{
+        {nil, nil},
+        {[]string{"token_file"}, []string{"token_file"}},
+        {[]string{"archive_file"}, []string{"archive_file"}},
+        {[]string{"token_file", "archive_file"}, []string{"token_file", "archive_file"}},
+    }
+    for _, tt := range tests {
+        _, err := loadConfig(path, tt.writes...)
+        var problems []ConfigProblem
+        if configErr, ok := err.(*ConfigError); ok {
+            problems = configErr.Problems
+        } else if err != nil {
+            t.Fatal(err)
+        }
+        if len(problems) != len(tt.keys) {
+            t.Errorf("writes %v: problems = %v, want of %v", tt.writes, problems, tt.keys)
+            continue
+        }
+        for _, key := range tt.keys {
+            if findProblem(problems, key) == nil {
+                t.Errorf("writes %v: no problem of %s in %v", tt.writes, key, problems)
+            }
+        }
+    }
+}
+
+func TestRunConfigCheck(t *testing.T) {
+    path := writeConfig(t, "client_id: <your_client_id>\nclinet_secret: secret\n")
+    var out bytes.Buffer
+    if code := runConfigCheck(&out, path); code != 1 {
+        t.Errorf("exit code = %d, want 1", code)
+    }
+    for _, want := range []string{
+        path + ":1: client_id: looks like a placeholder",
+        path + ":2: clinet_secret: unknown key",
+        "client_secret: required but not set",
+        "3 problems found",
+    } {
+        if !strings.Contains(out.String(), want) {
+            t.Errorf("output does not contain %q:\n%s", want, out.String())
+        }
+    }
+
+    path = writeConfig(t, "client_id: id\nclient_secret: secret\n")
+    out.Reset()
+    if code := runConfigCheck(&out, path); code != 0 || !strings.HasSuffix(out.String(), "OK\n") {
+        t.Errorf("exit code = %d, output:\n%s", code, out.String())
+    }
+}
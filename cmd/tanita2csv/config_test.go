@@ -0,0 +1,154 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// writeConfig writes the config file content in a temporary directory and returns its path.
+func writeConfig(t *testing.T, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), DefaultConfigFile)
+    if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+        t.Fatal(err)
+    }
+    t.Setenv("XDG_STATE_HOME", t.TempDir())
+    return path
+}
+
+// writeSecret writes the value in a temporary file and returns its path.
+func writeSecret(t *testing.T, value string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "secret")
+    if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestEnvOverrides(t *testing.T) {
+    path := writeConfig(t, `client_id: file-id
+client_secret: file-secret
+min_weight: 40
+goal_weight: 65
+influxdb:
+  url: http://file:8086
+  org: file-org
+mqtt:
+  broker: tcp://file:1883
+  retain: true
+webhooks:
+  - url: http://file/hook
+    secret: file-hook
+`)
+    t.Setenv("TANITA2CSV_CLIENT_ID", "env-id")
+    t.Setenv("TANITA2CSV_MIN_WEIGHT", "45.5")
+    t.Setenv("TANITA2CSV_GOAL_DATE", "2026-12-31")
+    t.Setenv("TANITA2CSV_INFLUXDB_URL", "http://env:8086")
+    t.Setenv("TANITA2CSV_INFLUXDB_BUCKET", "env-bucket")
+    t.Setenv("TANITA2CSV_MQTT_TOPIC", "env/topic")
+    t.Setenv("TANITA2CSV_MQTT_RETAIN", "false")
+    t.Setenv("TANITA2CSV_MQTT_QOS", "0")
+    t.Setenv("TANITA2CSV_WEBHOOKS_0_URL", "http://env/hook")
+    t.Setenv("TANITA2CSV_API_KEYS", "a, b,,c")
+
+    config, err := readConfig(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if problems := config.Validate(); len(problems) > 0 {
+        t.Fatalf("Validate() = %v", problems)
+    }
+
+    tests := []struct {
+        key string
+        got any
+        want any
+    }{
+        {"client_id", config.ClientID, "env-id"},
+        {"client_secret", config.ClientSecret, "file-secret"},
+        {"min_weight", config.MinWeight, 45.5},
+        {"goal_weight", config.GoalWeight, 65.0},
+        {"goal_date", config.GoalDate, "2026-12-31"},
+        {"influxdb.url", config.InfluxDB.URL, "http://env:8086"},
+        {"influxdb.org", config.InfluxDB.Org, "file-org"},
+        {"influxdb.bucket", config.InfluxDB.Bucket, "env-bucket"},
+        {"mqtt.topic", config.MQTT.Topic, "env/topic"},
+        {"mqtt.retain", *config.MQTT.Retain, false},
+        {"mqtt.qos", *config.MQTT.QoS, 0},
+        {"webhooks[0].url", config.Webhooks[0].URL, "http://env/hook"},
+        {"webhooks[0].secret", config.Webhooks[0].Secret, "file-hook"},
+        {"api_keys", len(config.APIKeys), 3},
+    }
+    for _, tt := range tests {
+        if tt.got != tt.want {
+            t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.want)
+        }
+    }
+    if source := config.env["min_weight"]; source != "TANITA2CSV_MIN_WEIGHT" {
+        t.Errorf("source of min_weight = %q, want TANITA2CSV_MIN_WEIGHT", source)
+    }
+    if _, ok := config.env["client_secret"]; ok {
+        t.Errorf("client_secret is recorded as overridden")
+    }
+}
+
+func TestEnvFile(t *testing.T) {
+    tests := []struct {
+        name string
+        env map[string]string
+        want string
+        source string
+    }{
+        {"file", map[string]string{"TANITA2CSV_CLIENT_SECRET_FILE": writeSecret(t, "from-file\r\n")}, "from-file", "TANITA2CSV_CLIENT_SECRET_FILE"},
+        {"variable over file", map[string]string{
+            "TANITA2CSV_CLIENT_SECRET": "from-env",
+            "TANITA2CSV_CLIENT_SECRET_FILE": writeSecret(t, "from-file"),
+        }, "from-env", "TANITA2CSV_CLIENT_SECRET"},
+        {"no variable", map[string]string{}, "file-secret", ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            path := writeConfig(t, "client_id: id\nclient_secret: file-secret\n")
+            for name, value := range tt.env {
+                t.Setenv(name, value)
+            }
+            config, err := readConfig(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if config.ClientSecret != tt.want {
+                t.Errorf("client_secret = %q, want %q", config.ClientSecret, tt.want)
+            }
+            if source := config.env["client_secret"]; source != tt.source {
+                t.Errorf("source = %q, want %q", source, tt.source)
+            }
+        })
+    }
+}
+
+func TestEnvProblems(t *testing.T) {
+    path := writeConfig(t, "client_id: id\nclient_secret: secret\n")
+    t.Setenv("TANITA2CSV_MAX_WEIGHT", "heavy")
+    t.Setenv("TANITA2CSV_MQTT_DISCOVERY", "maybe")
+    t.Setenv("TANITA2CSV_TOKEN_FILE_FILE", filepath.Join(t.TempDir(), "missing"))
+
+    config, err := readConfig(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]string{
+        "max_weight": "TANITA2CSV_MAX_WEIGHT",
+        "mqtt.discovery": "TANITA2CSV_MQTT_DISCOVERY",
+        "token_file": "TANITA2CSV_TOKEN_FILE_FILE",
+    }
+    for _, p := range config.Validate() {
+        if source, ok := want[p.Key]; ok && p.Source == source {
+            delete(want, p.Key)
+        }
+    }
+    for key, source := range want {
+        t.Errorf("no problem of %s from %s", key, source)
+    }
+}
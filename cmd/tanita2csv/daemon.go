@@ -0,0 +1,298 @@
+package main
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "path/filepath"
+    "sync"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+    "github.com/kamaboko123/tanita2csv/pkg/schedule"
+)
+
+/*
+daemon mode: runs dump on a schedule, instead of cron and the shell glue around it.
+
+Each run resolves -f, -t and -range again at its start (so -f 7d is always the last 7 days),
+and writes the period of each profile into a directory of the day under -o:
+
+    <-o>/2026-10-19/tanita2csv-060000.csv        (tanita2csv-<profile>-060000.csv with -all-profiles)
+
+The runs follow -schedule, a cron expression in the time zone of the config (see pkg/schedule),
+or start now and then every -interval (default: DefaultDaemonInterval).
+The tokens are checked every tokenCheckInterval and refreshed a week before they expire, as a fetch does,
+so that they do not expire between the runs.
+
+GET /healthz on -listen returns the state of the daemon as JSON, with 503 while the last run is failing.
+The logs are JSON lines, the ones of a run with its run_id, ending with "Run finished".
+SIGINT or SIGTERM stops the daemon after the running run; a second signal exits at once.
+*/
+
+const (
+    DefaultDaemonListen = "localhost:9734"
+    DefaultDaemonInterval = 6 * time.Hour
+    tokenCheckInterval = 6 * time.Hour
+)
+
+// profileRun is the result of a run for a profile.
+type profileRun struct {
+    Profile string `json:"profile"`
+    OK bool `json:"ok"`
+    ExitCode int `json:"exit_code,omitempty"`
+    DataCount int `json:"data_count"`
+    OutputFile string `json:"output_file,omitempty"`
+}
+
+type runResult struct {
+    ID int `json:"id"`
+    Start time.Time `json:"start"`
+    End time.Time `json:"end"`
+    DurationSeconds float64 `json:"duration_seconds"`
+    From string `json:"from,omitempty"`
+    To string `json:"to,omitempty"`
+    OK bool `json:"ok"`
+    Profiles []*profileRun `json:"profiles"`
+}
+
+type tokenState struct {
+    Expires *time.Time `json:"expires,omitempty"`
+    Error string `json:"error,omitempty"`
+}
+
+// daemonState is the state served by /healthz.
+type daemonState struct {
+    Status string `json:"status"` // starting (no run has finished), ok or failing (the last run failed)
+    Schedule string `json:"schedule"`
+    Started time.Time `json:"started"`
+    NextRun *time.Time `json:"next_run,omitempty"`
+    LastSuccess *time.Time `json:"last_success,omitempty"`
+    Runs int `json:"runs"`
+    Failures int `json:"failures"`
+    ConsecutiveFailures int `json:"consecutive_failures"`
+    LastRun *runResult `json:"last_run,omitempty"`
+    Tokens map[string]*tokenState `json:"tokens,omitempty"` // key: profile label
+}
+
+type daemon struct {
+    runner *Runner
+    profiles []*Profile
+
+    mu sync.Mutex
+    state daemonState
+}
+
+func newDaemon(r *Runner, profiles []*Profile) *daemon {
+    return &daemon{
+        runner: r,
+        profiles: profiles,
+        state: daemonState{
+            Status: "starting",
+            Schedule: r.option.schedule.String(),
+            Started: time.Now(),
+            Tokens: make(map[string]*tokenState),
+        },
+    }
+}
+
+// runDaemon runs dump for the profiles on the schedule until SIGINT or SIGTERM.
+func (r *Runner) runDaemon(profiles []*Profile) int {
+    d := newDaemon(r, profiles)
+    labels := make([]string, len(profiles))
+    for i, p := range profiles {
+        labels[i] = profileLabel(p)
+    }
+
+    r.logger.Info("Starting daemon", "schedule", d.state.Schedule, "listen", r.option.listen, "output_dir", r.option.output, "profiles", labels)
+    return r.serveUntilSignal(d.handler(), d.loop)
+}
+
+// handler returns the handler of /healthz.
+func (d *daemon) handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/healthz", d.handleHealth)
+    return readOnly(mux)
+}
+
+// loop runs on the schedule and checks the tokens in between, until ctx is canceled.
+// Both are in this goroutine, so that the token file is not refreshed by two at once.
+func (d *daemon) loop(ctx context.Context) {
+    r := d.runner
+    d.checkTokens(true)
+    tokenTicker := time.NewTicker(tokenCheckInterval)
+    defer tokenTicker.Stop()
+
+    now := time.Now().In(r.queryLoc)
+    next := now
+    if _, ok := r.option.schedule.(*schedule.Cron); ok {
+        next = r.option.schedule.Next(now)
+    }
+    for {
+        if next.IsZero() {
+            r.logger.Error("No more runs in the schedule", "schedule", d.state.Schedule)
+            <-ctx.Done()
+            return
+        }
+        d.mu.Lock()
+        d.state.NextRun = &next
+        d.mu.Unlock()
+
+        timer := time.NewTimer(time.Until(next))
+        for waiting := true; waiting; {
+            select {
+            case <-ctx.Done():
+                timer.Stop()
+                return
+            case <-tokenTicker.C:
+                d.checkTokens(true)
+            case <-timer.C:
+                waiting = false
+            }
+        }
+
+        d.run(next)
+        d.checkTokens(false)
+
+        // skip the runs missed while running
+        now = time.Now().In(r.queryLoc)
+        next = r.option.schedule.Next(next)
+        if !next.IsZero() && next.Before(now) {
+            next = r.option.schedule.Next(now)
+        }
+    }
+}
+
+// run dumps the period of each profile into the directory of the day.
+func (d *daemon) run(scheduled time.Time) {
+    r := d.runner
+    d.mu.Lock()
+    d.state.Runs++
+    result := &runResult{ID: d.state.Runs, Start: time.Now(), OK: true}
+    d.mu.Unlock()
+    logger := r.logger.With("run_id", result.ID)
+
+    now := result.Start.In(r.queryLoc)
+    dataCount := 0
+    if err := r.option.resolvePeriod(now); err != nil {
+        logger.Error("Failed to resolve the period", "error", err)
+        result.OK = false
+    } else {
+        result.From = r.option.from.Format("2006-01-02")
+        result.To = r.option.to.Format("2006-01-02")
+        logger.Info("Run started", "scheduled", scheduled, "from", result.From, "to", result.To)
+
+        template := d.outputTemplate(now)
+        for _, p := range d.profiles {
+            pr := &profileRun{Profile: profileLabel(p)}
+            output := p.outputPath(template, r.option.allProfiles, r.option.format)
+            innerscan, code := r.dump(p, output, logger.With("profile", pr.Profile))
+            if code == 0 {
+                pr.OK = true
+                pr.DataCount = len(innerscan.Data)
+                pr.OutputFile = output
+                dataCount += pr.DataCount
+            } else {
+                pr.ExitCode = code
+                result.OK = false
+            }
+            result.Profiles = append(result.Profiles, pr)
+        }
+    }
+    result.End = time.Now()
+    result.DurationSeconds = result.End.Sub(result.Start).Seconds()
+
+    d.mu.Lock()
+    d.state.LastRun = result
+    if result.OK {
+        d.state.Status = "ok"
+        d.state.ConsecutiveFailures = 0
+        d.state.LastSuccess = &result.End
+    } else {
+        d.state.Status = "failing"
+        d.state.Failures++
+        d.state.ConsecutiveFailures++
+    }
+    failures := d.state.ConsecutiveFailures
+    d.mu.Unlock()
+
+    failed := 0
+    for _, pr := range result.Profiles {
+        if !pr.OK {
+            failed++
+        }
+    }
+    attrs := []any{"ok", result.OK, "duration_seconds", result.DurationSeconds, "data_count", dataCount, "failed_profiles", failed}
+    if result.OK {
+        logger.Info("Run finished", attrs...)
+    } else {
+        logger.Error("Run finished", append(attrs, "consecutive_failures", failures)...)
+    }
+}
+
+// outputTemplate returns the output file of a run at now, with {profile} if several profiles are dumped.
+func (d *daemon) outputTemplate(now time.Time) string {
+    name := AppName
+    if d.runner.option.allProfiles {
+        name += "-{profile}"
+    }
+    return filepath.Join(d.runner.option.output, now.Format("2006-01-02"), name + "-" + now.Format("150405") + formatExtension(d.runner.option.format))
+}
+
+// checkTokens records when the tokens expire, refreshing them first if refresh is true.
+func (d *daemon) checkTokens(refresh bool) {
+    r := d.runner
+    if r.option.source != "api" {
+        return
+    }
+    for _, p := range d.profiles {
+        label := profileLabel(p)
+        logger := r.logger.With("profile", label)
+        auth := healthplanet.NewSimpleAuth(r.config.URL, p.ClientID, p.ClientSecret, p.TokenFile, logger)
+        state := &tokenState{}
+
+        var err error
+        if refresh {
+            err = auth.RefreshToken()
+            if err != nil {
+                logger.Error("Failed to refresh token. Please reauthenticate with auth mode.", "error", err)
+            }
+        }
+        if err == nil {
+            var expiry time.Time
+            expiry, err = auth.TokenExpiry()
+            if err != nil {
+                logger.Warn("Failed to read token expiry", "error", err)
+            } else {
+                state.Expires = &expiry
+                if refresh {
+                    logger.Info("Checked token", "expires", expiry)
+                }
+            }
+        }
+        if err != nil {
+            state.Error = err.Error()
+        }
+
+        d.mu.Lock()
+        d.state.Tokens[label] = state
+        d.mu.Unlock()
+    }
+}
+
+func (d *daemon) handleHealth(w http.ResponseWriter, req *http.Request) {
+    d.mu.Lock()
+    body, err := marshalJSON(d.state)
+    failing := d.state.Status == "failing"
+    d.mu.Unlock()
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    if failing {
+        w.WriteHeader(http.StatusServiceUnavailable)
+    }
+    io.WriteString(w, body)
+}
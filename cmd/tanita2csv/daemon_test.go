@@ -0,0 +1,153 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/archive"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+    "github.com/kamaboko123/tanita2csv/pkg/schedule"
+)
+
+// newTestDaemon returns a daemon which dumps April 2025 of the archived profiles into dir, without HealthPlanet.
+func newTestDaemon(t *testing.T, dir string, names ...string) *daemon {
+    t.Helper()
+    r := &Runner{
+        config: &Config{},
+        option: &RunOption{
+            mode: "daemon",
+            source: "archive",
+            format: "csv",
+            weightUnit: "kg",
+            output: dir,
+            allProfiles: len(names) > 1,
+            schedule: schedule.Every(time.Hour),
+            dates: [3]*DateValue{NewDateValue("2025-04-01"), NewDateValue("2025-04-30"), NewRangeValue("")},
+        },
+        queryLoc: time.UTC,
+        outputLoc: time.UTC,
+        logger: discardLogger,
+    }
+    var profiles []*Profile
+    for _, name := range names {
+        p := &Profile{Name: name, ArchiveFile: filepath.Join(t.TempDir(), "archive.jsonl"), Garmin: &GarminConfig{}}
+        if _, err := archive.Open(p.ArchiveFile).Append(&healthplanet.Innerscan{Data: testData(66.4, 66.2)}, "api"); err != nil {
+            t.Fatal(err)
+        }
+        profiles = append(profiles, p)
+    }
+    return newDaemon(r, profiles)
+}
+
+func getHealth(t *testing.T, url string) (int, daemonState) {
+    t.Helper()
+    res, body := apiRequest(t, http.MethodGet, url + "/healthz", nil)
+    var state daemonState
+    if err := json.Unmarshal([]byte(body), &state); err != nil {
+        t.Fatalf("%v: %s", err, body)
+    }
+    if res.Header.Get("Cache-Control") != "no-store" {
+        t.Errorf("Cache-Control = %q", res.Header.Get("Cache-Control"))
+    }
+    return res.StatusCode, state
+}
+
+func TestDaemonHealth(t *testing.T) {
+    dir := t.TempDir()
+    d := newTestDaemon(t, filepath.Join(dir, "out"), DefaultProfile)
+    s := httptest.NewServer(d.handler())
+    defer s.Close()
+
+    if status, state := getHealth(t, s.URL); status != http.StatusOK || state.Status != "starting" || state.Runs != 0 || state.LastRun != nil || state.Schedule != "every 1h0m0s" {
+        t.Errorf("before the first run: %d %+v", status, state)
+    }
+
+    d.run(time.Now())
+    status, state := getHealth(t, s.URL)
+    if status != http.StatusOK || state.Status != "ok" || state.Runs != 1 || state.LastSuccess == nil || state.LastRun == nil || !state.LastRun.OK {
+        t.Fatalf("after a run: %d %+v", status, state)
+    }
+    if pr := state.LastRun.Profiles; len(pr) != 1 || !pr[0].OK || pr[0].DataCount != 2 || state.LastRun.From != "2025-04-01" || state.LastRun.To != "2025-04-30" {
+        t.Errorf("last run = %+v", state.LastRun)
+    }
+
+    // the output directory cannot be made under a file
+    if err := os.WriteFile(filepath.Join(dir, "blocker"), nil, 0644); err != nil {
+        t.Fatal(err)
+    }
+    d.runner.option.output = filepath.Join(dir, "blocker")
+    d.run(time.Now())
+    d.run(time.Now())
+    status, state = getHealth(t, s.URL)
+    if status != http.StatusServiceUnavailable || state.Status != "failing" || state.Runs != 3 || state.Failures != 2 || state.ConsecutiveFailures != 2 {
+        t.Errorf("after failed runs: %d %+v", status, state)
+    }
+    if pr := state.LastRun.Profiles; state.LastRun.OK || len(pr) != 1 || pr[0].OK || pr[0].ExitCode == 0 || pr[0].OutputFile != "" {
+        t.Errorf("failed run = %+v", state.LastRun)
+    }
+
+    // a successful run recovers
+    d.runner.option.output = filepath.Join(dir, "out")
+    d.run(time.Now())
+    if status, state := getHealth(t, s.URL); status != http.StatusOK || state.Status != "ok" || state.ConsecutiveFailures != 0 || state.Failures != 2 {
+        t.Errorf("after recovery: %d %+v", status, state)
+    }
+
+    if res, _ := apiRequest(t, http.MethodPost, s.URL + "/healthz", nil); res.StatusCode != http.StatusMethodNotAllowed {
+        t.Errorf("POST: status %d, want 405", res.StatusCode)
+    }
+}
+
+func TestDaemonOutputPath(t *testing.T) {
+    tests := []struct {
+        name string
+        profiles []string
+        format string
+        files []string // with the time of the run for %s
+    }{
+        {"single profile", []string{DefaultProfile}, "csv", []string{"tanita2csv-%s.csv"}},
+        {"json", []string{DefaultProfile}, "json", []string{"tanita2csv-%s.json"}},
+        {"all profiles", []string{"alice", "bob"}, "csv", []string{"tanita2csv-alice-%s.csv", "tanita2csv-bob-%s.csv"}},
+    }
+    for _, tt := range tests {
+        dir := t.TempDir()
+        d := newTestDaemon(t, dir, tt.profiles...)
+        d.runner.option.format = tt.format
+        d.run(time.Now())
+
+        result := d.state.LastRun
+        if !result.OK || len(result.Profiles) != len(tt.files) {
+            t.Errorf("%s: run = %+v", tt.name, result)
+            continue
+        }
+        // a directory of the day, and the time of the run in the file name
+        start := result.Start.In(time.UTC)
+        for i, f := range tt.files {
+            want := filepath.Join(dir, start.Format("2006-01-02"), strings.ReplaceAll(f, "%s", start.Format("150405")))
+            if got := result.Profiles[i].OutputFile; got != want {
+                t.Errorf("%s: output = %s, want %s", tt.name, got, want)
+            }
+            content, err := os.ReadFile(want)
+            if err != nil || !strings.Contains(string(content), "66.2") {
+                t.Errorf("%s: %s = %q, %v", tt.name, want, content, err)
+            }
+        }
+    }
+
+    // the day and the time are of the time zone of the config
+    tokyo, err := time.LoadLocation("Asia/Tokyo")
+    if err != nil {
+        t.Fatal(err)
+    }
+    d := newTestDaemon(t, "out", DefaultProfile)
+    d.runner.queryLoc = tokyo
+    at := time.Date(2025, 4, 30, 23, 30, 5, 0, time.UTC)
+    if got, want := d.outputTemplate(at.In(tokyo)), filepath.Join("out", "2025-05-01", "tanita2csv-083005.csv"); got != want {
+        t.Errorf("outputTemplate() = %s, want %s", got, want)
+    }
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+    "embed"
+    "fmt"
+    "io/fs"
+    "net/http"
+    "sort"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/analytics"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+dashboard mode: a web UI of the measurements for people who do not use the CLI.
+
+The UI in dashboard/ is embedded in the binary and has no external dependencies (no CDN),
+so it works offline. It draws the weight, body fat and BMI of the period with the EWMA trend lines,
+and the data is read from the archive as serve mode does (with the same -source and -interval).
+
+    GET /                                     the UI
+    GET /api/profiles
+    GET /api/series?from=&to=&profile=        the series of the charts
+    GET /api/csv?from=&to=&profile=           the data of the period in the dump CSV format, as a download
+
+The dashboard has no authentication, so it listens on localhost by default.
+*/
+
+const DefaultDashboardListen = "localhost:9733"
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+type dashboardPoint struct {
+    Date time.Time `json:"date"`
+    Value float64 `json:"value"`
+    Trend float64 `json:"trend"` // EWMA
+}
+
+type dashboardSeries struct {
+    Unit string `json:"unit"`
+    Points []dashboardPoint `json:"points"`
+    Slope *float64 `json:"slope"` // per week, of the last -slope-days; null if not enough data
+}
+
+type dashboardResponse struct {
+    Profile string `json:"profile"`
+    From string `json:"from"`
+    To string `json:"to"`
+    Count int `json:"count"` // days with measurements
+    Series map[string]*dashboardSeries `json:"series"`
+}
+
+// runDashboard serves the dashboard of the profiles until SIGINT or SIGTERM.
+func (r *Runner) runDashboard(profiles []*Profile) int {
+    s := &apiServer{runner: r, profiles: make(map[string]*Profile)}
+    for _, p := range profiles {
+        s.profiles[profileLabel(p)] = p
+    }
+
+    handler, err := s.dashboardHandler()
+    if err != nil {
+        r.logger.Error("Failed to load dashboard", "error", err)
+        return 1
+    }
+
+    var poll func()
+    if r.option.source == "api" {
+        poll = s.fetchAll
+    }
+    return r.serveHTTP(handler, poll)
+}
+
+// dashboardHandler returns the handler of the UI and its API.
+func (s *apiServer) dashboardHandler() (http.Handler, error) {
+    static, err := fs.Sub(dashboardFiles, "dashboard")
+    if err != nil {
+        return nil, err
+    }
+    mux := http.NewServeMux()
+    mux.Handle("/", http.FileServer(http.FS(static)))
+    mux.HandleFunc("/api/profiles", s.handleProfiles)
+    mux.HandleFunc("/api/series", s.handleSeries)
+    mux.HandleFunc("/api/csv", s.handleCsv)
+    return readOnly(mux), nil
+}
+
+// dailyData returns the measurements of the request unified per day, writing the error response on failure.
+func (s *apiServer) dailyData(w http.ResponseWriter, req *http.Request) (*Profile, *healthplanet.Innerscan, time.Time, time.Time, bool) {
+    profile, ok := s.profile(w, req)
+    if !ok {
+        return nil, nil, time.Time{}, time.Time{}, false
+    }
+    from, to, ok := s.period(w, req)
+    if !ok {
+        return nil, nil, time.Time{}, time.Time{}, false
+    }
+    innerscan, _, err := s.read(profile, from, to)
+    if err != nil {
+        s.runner.logger.Error("Failed to read archive", "profile", profileLabel(profile), "error", err)
+        writeError(w, http.StatusInternalServerError, "failed to read archive")
+        return nil, nil, time.Time{}, time.Time{}, false
+    }
+    return profile, innerscan.UniqByDay(), from, to, true
+}
+
+func (s *apiServer) handleSeries(w http.ResponseWriter, req *http.Request) {
+    profile, innerscan, from, to, ok := s.dailyData(w, req)
+    if !ok {
+        return
+    }
+    opts := s.runner.option.trendOptions
+    res := &dashboardResponse{
+        Profile: profileLabel(profile),
+        From: from.Format("2006-01-02"),
+        To: to.Format("2006-01-02"),
+        Count: len(innerscan.Data),
+        Series: map[string]*dashboardSeries{
+            "weight": newDashboardSeries("kg", analytics.WeightPoints(innerscan.Data), opts),
+            "body_fat": newDashboardSeries("%", analytics.BodyFatPoints(innerscan.Data), opts),
+            "bmi": newDashboardSeries("", bmiPoints(innerscan.Data), opts),
+        },
+    }
+    body, err := marshalJSON(res)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    writeJSON(w, req, body, time.Time{})
+}
+
+func (s *apiServer) handleCsv(w http.ResponseWriter, req *http.Request) {
+    profile, innerscan, from, to, ok := s.dailyData(w, req)
+    if !ok {
+        return
+    }
+    analytics.ApplyTrend(innerscan, s.runner.option.trendOptions)
+    filename := fmt.Sprintf("%s-%s-%s-%s.csv", AppName, profileLabel(profile), from.Format("20060102"), to.Format("20060102"))
+    w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+    fmt.Fprint(w, healthplanet.CsvPreamble + "\n" + innerscan.ToCsv())
+}
+
+func bmiPoints(data []*healthplanet.InnerscanData) []analytics.Point {
+    points := make([]analytics.Point, 0, len(data))
+    for _, d := range data {
+        if d.BMI > 0 {
+            points = append(points, analytics.Point{Time: d.Date, Value: d.BMI})
+        }
+    }
+    return points
+}
+
+func newDashboardSeries(unit string, points []analytics.Point, opts analytics.TrendOptions) *dashboardSeries {
+    s := &dashboardSeries{Unit: unit, Points: make([]dashboardPoint, len(points))}
+    ewma := analytics.EWMA(points, opts.Alpha)
+    for i, p := range points {
+        s.Points[i] = dashboardPoint{Date: p.Time, Value: p.Value, Trend: ewma[i]}
+    }
+    if n := len(points); n > 0 {
+        since := points[n-1].Time.AddDate(0, 0, -opts.SlopeDays)
+        i := sort.Search(n, func(i int) bool { return !points[i].Time.Before(since) })
+        if slope, _, ok := analytics.Regression(points[i:]); ok {
+            s.Slope = &slope
+        }
+    }
+    return s
+}
@@ -0,0 +1,193 @@
+"use strict";
+
+// Charts of the dashboard, drawn as SVG without any library.
+
+const charts = [
+  {key: "weight", title: "Weight", digits: 2},
+  {key: "body_fat", title: "Body fat", digits: 2},
+  {key: "bmi", title: "BMI", digits: 2},
+];
+
+const width = 900;
+const height = 260;
+const margin = {top: 24, right: 16, bottom: 28, left: 48};
+const svgNS = "http://www.w3.org/2000/svg";
+
+const $ = (id) => document.getElementById(id);
+
+function svg(name, attrs, text) {
+  const el = document.createElementNS(svgNS, name);
+  for (const [k, v] of Object.entries(attrs)) {
+    el.setAttribute(k, v);
+  }
+  if (text !== undefined) {
+    el.textContent = text;
+  }
+  return el;
+}
+
+// niceTicks returns about count round values between min and max.
+function niceTicks(min, max, count) {
+  const raw = (max - min) / count;
+  const magnitude = Math.pow(10, Math.floor(Math.log10(raw)));
+  const step = [1, 2, 5, 10].map((m) => m * magnitude).find((s) => s >= raw);
+  const ticks = [];
+  for (let v = Math.ceil(min / step) * step; v <= max + step / 1e6; v += step) {
+    ticks.push(Number(v.toFixed(10)));
+  }
+  return ticks;
+}
+
+// dateTicks returns at most count days (at midnight UTC) between min and max, in steps of days, weeks or months.
+function dateTicks(min, max, count) {
+  const dayMs = 24 * 3600e3;
+  const span = (max - min) / dayMs;
+  const step = [1, 2, 7, 14, 28, 56, 91, 182, 365, 730].find((s) => span / s <= count) || Math.ceil(span / count);
+  const ticks = [];
+  for (let d = Math.ceil(min / dayMs); d * dayMs <= max; d += step) {
+    ticks.push(d * dayMs);
+  }
+  return ticks;
+}
+
+// The day of the measurement as written by the server, not in the time zone of the browser.
+const day = (p) => p.date.slice(0, 10);
+
+function query() {
+  const params = new URLSearchParams();
+  if ($("profile").value) {
+    params.set("profile", $("profile").value);
+  }
+  if ($("range").value === "custom") {
+    if ($("from").value) {
+      params.set("from", $("from").value);
+    }
+    if ($("to").value) {
+      params.set("to", $("to").value);
+    }
+  } else {
+    params.set("from", $("range").value);
+  }
+  return params.toString();
+}
+
+async function getJSON(url) {
+  const resp = await fetch(url);
+  const body = await resp.json();
+  if (!resp.ok) {
+    throw new Error(body.error || resp.statusText);
+  }
+  return body;
+}
+
+function formatValue(v, unit, digits) {
+  return v.toFixed(digits) + (unit ? " " + unit : "");
+}
+
+function draw(section, chart, series) {
+  section.replaceChildren();
+  const points = series.points;
+  const title = document.createElement("h2");
+  title.textContent = chart.title;
+  if (points.length > 0) {
+    const latest = points[points.length - 1];
+    const small = document.createElement("small");
+    let text = formatValue(latest.value, series.unit, chart.digits) + " on " + day(latest);
+    if (series.slope !== null) {
+      const sign = series.slope > 0 ? "+" : "";
+      text += ", trend " + sign + series.slope.toFixed(2) + (series.unit ? " " + series.unit : "") + "/week";
+    }
+    small.textContent = text;
+    title.append(small);
+  }
+  section.append(title);
+  if (points.length === 0) {
+    const p = document.createElement("p");
+    p.textContent = "No data in the period.";
+    section.append(p);
+    return;
+  }
+
+  const times = points.map((p) => Date.parse(p.date));
+  const values = points.flatMap((p) => [p.value, p.trend]);
+  let [xMin, xMax] = [Math.min(...times), Math.max(...times)];
+  let [yMin, yMax] = [Math.min(...values), Math.max(...values)];
+  if (xMin === xMax) {
+    xMin -= 12 * 3600e3;
+    xMax += 12 * 3600e3;
+  }
+  const pad = Math.max((yMax - yMin) * 0.1, 0.5);
+  yMin -= pad;
+  yMax += pad;
+
+  const x = (t) => margin.left + (t - xMin) / (xMax - xMin) * (width - margin.left - margin.right);
+  const y = (v) => height - margin.bottom - (v - yMin) / (yMax - yMin) * (height - margin.top - margin.bottom);
+
+  const root = svg("svg", {viewBox: `0 0 ${width} ${height}`, role: "img", "aria-label": chart.title});
+
+  for (const v of niceTicks(yMin, yMax, 5)) {
+    root.append(svg("line", {class: "grid", x1: margin.left, x2: width - margin.right, y1: y(v), y2: y(v)}));
+    root.append(svg("text", {x: margin.left - 6, y: y(v) + 4, "text-anchor": "end"}, String(v)));
+  }
+  for (const t of dateTicks(xMin, xMax, 7)) {
+    const label = new Date(t).toISOString().slice(0, 10);
+    root.append(svg("line", {class: "grid", x1: x(t), x2: x(t), y1: margin.top, y2: height - margin.bottom}));
+    root.append(svg("text", {x: x(t), y: height - 8, "text-anchor": "middle"}, label));
+  }
+
+  points.forEach((p, i) => {
+    const dot = svg("circle", {class: "value", cx: x(times[i]), cy: y(p.value), r: 2.5});
+    dot.append(svg("title", {}, day(p) + ": " + formatValue(p.value, series.unit, chart.digits)));
+    root.append(dot);
+  });
+  const path = points.map((p, i) => (i === 0 ? "M" : "L") + x(times[i]).toFixed(1) + "," + y(p.trend).toFixed(1)).join(" ");
+  root.append(svg("path", {class: "trend", d: path}));
+
+  const legend = svg("g", {class: "legend", transform: `translate(${width - margin.right - 170}, 10)`});
+  legend.append(svg("circle", {class: "value-key", cx: 0, cy: 0, r: 3}));
+  legend.append(svg("text", {x: 8, y: 4}, "measured"));
+  legend.append(svg("line", {class: "trend-key", x1: 80, x2: 100, y1: 0, y2: 0}));
+  legend.append(svg("text", {x: 106, y: 4}, "trend (EWMA)"));
+  root.append(legend);
+
+  section.append(root);
+}
+
+async function refresh() {
+  const q = query();
+  $("download").href = "api/csv?" + q;
+  $("status").textContent = "Loading...";
+  try {
+    const data = await getJSON("api/series?" + q);
+    $("status").textContent = data.count === 0 ? `No measurements from ${data.from} to ${data.to}.` : "";
+    for (const chart of charts) {
+      draw($(chart.key), chart, data.series[chart.key]);
+    }
+  } catch (e) {
+    $("status").textContent = "Failed to load the data: " + e.message;
+  }
+}
+
+async function init() {
+  try {
+    const {profiles} = await getJSON("api/profiles");
+    for (const name of profiles) {
+      $("profile").add(new Option(name, name));
+    }
+    $("profile-label").hidden = profiles.length < 2;
+  } catch (e) {
+    $("status").textContent = "Failed to load the profiles: " + e.message;
+    return;
+  }
+  $("range").addEventListener("change", () => {
+    $("custom").hidden = $("range").value !== "custom";
+    refresh();
+  });
+  for (const id of ["profile", "from", "to"]) {
+    $(id).addEventListener("change", refresh);
+  }
+  $("controls").addEventListener("submit", (e) => e.preventDefault());
+  refresh();
+}
+
+init();
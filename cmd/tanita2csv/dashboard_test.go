@@ -0,0 +1,103 @@
+package main
+
+import (
+    "encoding/json"
+    "math"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func newTestDashboard(t *testing.T, weights map[string][]float64) *httptest.Server {
+    t.Helper()
+    handler, err := newTestAPIServer(t, weights).dashboardHandler()
+    if err != nil {
+        t.Fatal(err)
+    }
+    server := httptest.NewServer(handler)
+    t.Cleanup(server.Close)
+    return server
+}
+
+func TestDashboardIndex(t *testing.T) {
+    s := newTestDashboard(t, map[string][]float64{DefaultProfile: {66.4}})
+    for _, path := range []string{"/", "/dashboard.js", "/dashboard.css"} {
+        res, body := apiRequest(t, http.MethodGet, s.URL + path, nil)
+        if res.StatusCode != http.StatusOK || body == "" {
+            t.Errorf("%s: status %d, %d bytes", path, res.StatusCode, len(body))
+        }
+    }
+    res, body := apiRequest(t, http.MethodGet, s.URL + "/", nil)
+    if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") || !strings.Contains(body, "<title>tanita2csv</title>") || !strings.Contains(body, "dashboard.js") {
+        t.Errorf("/ is not the index: %s\n%s", res.Header.Get("Content-Type"), body)
+    }
+    if res, _ := apiRequest(t, http.MethodPost, s.URL + "/api/series", nil); res.StatusCode != http.StatusMethodNotAllowed {
+        t.Errorf("POST: status %d, want 405", res.StatusCode)
+    }
+}
+
+func TestDashboardSeries(t *testing.T) {
+    // 0.2 kg a day is 1.4 kg a week
+    s := newTestDashboard(t, map[string][]float64{DefaultProfile: {66.4, 66.2, 66.0, 65.8}, "kid": {30.1}})
+
+    res, body := apiRequest(t, http.MethodGet, s.URL + "/api/series?profile=default&from=2025-04-01&to=2025-04-30", nil)
+    if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") {
+        t.Fatalf("status %d, %s: %s", res.StatusCode, res.Header.Get("Content-Type"), body)
+    }
+    var got dashboardResponse
+    if err := json.Unmarshal([]byte(body), &got); err != nil {
+        t.Fatal(err)
+    }
+    if got.Profile != "default" || got.From != "2025-04-01" || got.To != "2025-04-30" || got.Count != 4 {
+        t.Errorf("response = %s %s %s %d", got.Profile, got.From, got.To, got.Count)
+    }
+    units := map[string]string{"weight": "kg", "body_fat": "%", "bmi": ""}
+    if len(got.Series) != len(units) {
+        t.Errorf("series = %v, want %v", got.Series, units)
+    }
+    for name, unit := range units {
+        series := got.Series[name]
+        if series == nil || series.Unit != unit || len(series.Points) != 4 || series.Slope == nil {
+            t.Errorf("%s series = %+v", name, series)
+        }
+    }
+
+    weight := got.Series["weight"]
+    if slope := *weight.Slope; math.Abs(slope - -1.4) > 1e-9 {
+        t.Errorf("weight slope = %v, want -1.4", slope)
+    }
+    if slope := *got.Series["body_fat"].Slope; math.Abs(slope) > 1e-9 {
+        t.Errorf("body fat slope = %v, want 0", slope)
+    }
+    // the EWMA with alpha 0.1 per day starts at the first value
+    first, second := weight.Points[0], weight.Points[1]
+    if first.Value != 66.4 || first.Trend != 66.4 || second.Value != 66.2 || math.Abs(second.Trend - 66.38) > 1e-9 || !first.Date.Before(second.Date) {
+        t.Errorf("weight points = %+v %+v", first, second)
+    }
+
+    // the raw JSON has the field names of the UI, and null slope with a single measurement
+    _, body = apiRequest(t, http.MethodGet, s.URL + "/api/series?profile=kid&from=2025-04-01&to=2025-04-30", nil)
+    for _, field := range []string{`"profile": "kid"`, `"count": 1`, `"series": {`, `"points": [`, `"trend": 30.1`, `"slope": null`} {
+        if !strings.Contains(body, field) {
+            t.Errorf("no %s in:\n%s", field, body)
+        }
+    }
+    if res, body := apiRequest(t, http.MethodGet, s.URL + "/api/series", nil); res.StatusCode != http.StatusBadRequest {
+        t.Errorf("without a profile of two: status %d: %s", res.StatusCode, body)
+    }
+}
+
+func TestDashboardCsv(t *testing.T) {
+    s := newTestDashboard(t, map[string][]float64{DefaultProfile: {66.4, 66.2}, "kid": {30.1}})
+    res, body := apiRequest(t, http.MethodGet, s.URL + "/api/csv?profile=kid&from=2025-04-01&to=2025-04-30", nil)
+    if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/csv; charset=utf-8" {
+        t.Fatalf("status %d, %s: %s", res.StatusCode, res.Header.Get("Content-Type"), body)
+    }
+    if got, want := res.Header.Get("Content-Disposition"), `attachment; filename="tanita2csv-kid-20250401-20250430.csv"`; got != want {
+        t.Errorf("Content-Disposition = %s, want %s", got, want)
+    }
+    if !strings.Contains(body, "\n2025-04-01,30.100000,") || strings.Contains(body, "66.4") {
+        t.Errorf("CSV of kid:\n%s", body)
+    }
+}
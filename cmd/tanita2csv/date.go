@@ -0,0 +1,200 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+/*
+Date expressions accepted by -f, -t and -range.
+
+Each expression means a period, -f takes its beginning and -t takes its end.
+
+    2025-04-01            the day
+    2025-04               the month
+    2025                  the year
+    2025-W14              the ISO week (Monday to Sunday)
+    2025-04-01T09:00:00+09:00
+                          the moment (RFC 3339)
+    today, yesterday      the day
+    7d, 12w               the last 7 days (12 weeks) including today, e.g. 7d on a Sunday is from Monday
+    this-week, this-month, this-year
+                          from the beginning of the current week (month, year) to today
+    last-week, last-month, last-year
+                          the previous week (month, year)
+    <expr>..<expr>        from the beginning of the first to the end of the second (only for -range)
+*/
+
+var (
+    relativePattern = regexp.MustCompile(`^(\d+)([dw])$`)
+    isoWeekPattern = regexp.MustCompile(`^(\d{4})-[wW](\d{1,2})$`)
+    monthPattern = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+    yearPattern = regexp.MustCompile(`^(\d{4})$`)
+)
+
+func startOfDay(t time.Time) time.Time {
+    return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// endOfDay returns the last second of the day, as the HealthPlanet API takes the time in seconds.
+func endOfDay(t time.Time) time.Time {
+    return startOfDay(t).AddDate(0, 0, 1).Add(-time.Second)
+}
+
+// startOfISOWeek returns the Monday of the week which t belongs to.
+func startOfISOWeek(t time.Time) time.Time {
+    day := startOfDay(t)
+    return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// parseDateExpr parses a date expression into the period [from, to].
+// Day boundaries and relative expressions are based on now and its location.
+func parseDateExpr(value string, now time.Time) (time.Time, time.Time, error) {
+    loc := now.Location()
+    today := startOfDay(now)
+    expr := strings.ToLower(strings.TrimSpace(value))
+
+    switch expr {
+    case "today":
+        return today, endOfDay(today), nil
+    case "yesterday":
+        day := today.AddDate(0, 0, -1)
+        return day, endOfDay(day), nil
+    case "this-week":
+        return startOfISOWeek(today), endOfDay(today), nil
+    case "last-week":
+        start := startOfISOWeek(today).AddDate(0, 0, -7)
+        return start, endOfDay(start.AddDate(0, 0, 6)), nil
+    case "this-month":
+        return time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, loc), endOfDay(today), nil
+    case "last-month":
+        start := time.Date(today.Year(), today.Month()-1, 1, 0, 0, 0, 0, loc)
+        return start, endOfDay(start.AddDate(0, 1, -1)), nil
+    case "this-year":
+        return time.Date(today.Year(), 1, 1, 0, 0, 0, 0, loc), endOfDay(today), nil
+    case "last-year":
+        start := time.Date(today.Year()-1, 1, 1, 0, 0, 0, 0, loc)
+        return start, endOfDay(start.AddDate(1, 0, -1)), nil
+    }
+
+    if m := relativePattern.FindStringSubmatch(expr); m != nil {
+        n, err := strconv.Atoi(m[1])
+        if err != nil {
+            return time.Time{}, time.Time{}, fmt.Errorf("invalid relative date %q: %w", value, err)
+        }
+        if n == 0 {
+            return time.Time{}, time.Time{}, fmt.Errorf("invalid relative date %q: must be 1 or more", value)
+        }
+        if m[2] == "w" {
+            n *= 7
+        }
+        return today.AddDate(0, 0, -(n - 1)), endOfDay(today), nil
+    }
+
+    if m := isoWeekPattern.FindStringSubmatch(expr); m != nil {
+        year, _ := strconv.Atoi(m[1])
+        week, _ := strconv.Atoi(m[2])
+        // January 4th is always in the first ISO week
+        start := startOfISOWeek(time.Date(year, 1, 4, 0, 0, 0, 0, loc)).AddDate(0, 0, 7*(week-1))
+        if y, w := start.ISOWeek(); week < 1 || y != year || w != week {
+            return time.Time{}, time.Time{}, fmt.Errorf("invalid ISO week %q: %d has no week %d", value, year, week)
+        }
+        return start, endOfDay(start.AddDate(0, 0, 6)), nil
+    }
+
+    if m := monthPattern.FindStringSubmatch(expr); m != nil {
+        start, err := time.ParseInLocation("2006-01", expr, loc)
+        if err != nil {
+            return time.Time{}, time.Time{}, fmt.Errorf("invalid month %q: %w", value, err)
+        }
+        return start, endOfDay(start.AddDate(0, 1, -1)), nil
+    }
+
+    if m := yearPattern.FindStringSubmatch(expr); m != nil {
+        year, _ := strconv.Atoi(m[1])
+        start := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+        return start, endOfDay(start.AddDate(1, 0, -1)), nil
+    }
+
+    if date, err := time.ParseInLocation("2006-01-02", expr, loc); err == nil {
+        return date, endOfDay(date), nil
+    }
+
+    if moment, err := time.Parse(time.RFC3339, strings.TrimSpace(value)); err == nil {
+        return moment, moment, nil
+    }
+
+    return time.Time{}, time.Time{}, fmt.Errorf("invalid date expression %q (e.g. 2025-04-01, 7d, yesterday, last-month, 2025-W14)", value)
+}
+
+// isRelativeDateExpr reports whether the period of the expression depends on when it is resolved, e.g. today and 7d.
+func isRelativeDateExpr(value string) bool {
+    expr := strings.ToLower(strings.TrimSpace(value))
+    switch expr {
+    case "today", "yesterday", "this-week", "last-week", "this-month", "last-month", "this-year", "last-year":
+        return true
+    }
+    return relativePattern.MatchString(expr)
+}
+
+// parseRangeExpr parses a date expression or "<expr>..<expr>" into the period [from, to].
+func parseRangeExpr(value string, now time.Time) (time.Time, time.Time, error) {
+    first, second, ok := strings.Cut(value, "..")
+    if !ok {
+        return parseDateExpr(value, now)
+    }
+    from, _, err := parseDateExpr(first, now)
+    if err != nil {
+        return time.Time{}, time.Time{}, err
+    }
+    _, to, err := parseDateExpr(second, now)
+    if err != nil {
+        return time.Time{}, time.Time{}, err
+    }
+    return from, to, nil
+}
+
+// DateValue is a date expression given by a flag.
+// The expression is validated when it is set, and resolved into time later,
+// because the day boundaries depend on when (and where) it is resolved.
+type DateValue struct {
+    expr string
+    parse func(string, time.Time) (time.Time, time.Time, error)
+}
+
+func NewDateValue(expr string) *DateValue {
+    return &DateValue{expr: expr, parse: parseDateExpr}
+}
+
+func NewRangeValue(expr string) *DateValue {
+    return &DateValue{expr: expr, parse: parseRangeExpr}
+}
+
+func (d *DateValue) String() string {
+    if d == nil {
+        return ""
+    }
+    return d.expr
+}
+
+func (d *DateValue) Set(value string) error {
+    _, _, err := d.parse(value, time.Now())
+    if err != nil {
+        return err
+    }
+    d.expr = value
+    return nil
+}
+
+// IsSet reports whether the value has an expression.
+func (d *DateValue) IsSet() bool {
+    return d.expr != ""
+}
+
+// Resolve returns the period of the expression.
+func (d *DateValue) Resolve(now time.Time) (time.Time, time.Time, error) {
+    return d.parse(d.expr, now)
+}
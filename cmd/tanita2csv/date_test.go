@@ -0,0 +1,92 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func TestParseDateExpr(t *testing.T) {
+    tokyo, err := time.LoadLocation("Asia/Tokyo")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // a Sunday
+    now := time.Date(2025, 4, 13, 15, 4, 5, 0, tokyo)
+    day := func(y int, m time.Month, d int) time.Time {
+        return time.Date(y, m, d, 0, 0, 0, 0, tokyo)
+    }
+    end := func(y int, m time.Month, d int) time.Time {
+        return time.Date(y, m, d, 23, 59, 59, 0, tokyo)
+    }
+
+    tests := []struct {
+        expr string
+        from time.Time
+        to time.Time
+    }{
+        {"today", day(2025, 4, 13), end(2025, 4, 13)},
+        {"yesterday", day(2025, 4, 12), end(2025, 4, 12)},
+        // N days including today
+        {"1d", day(2025, 4, 13), end(2025, 4, 13)},
+        {"7d", day(2025, 4, 7), end(2025, 4, 13)},
+        {"90d", day(2025, 1, 14), end(2025, 4, 13)},
+        {"2w", day(2025, 3, 31), end(2025, 4, 13)},
+        {"this-week", day(2025, 4, 7), end(2025, 4, 13)},
+        {"last-week", day(2025, 3, 31), end(2025, 4, 6)},
+        {"this-month", day(2025, 4, 1), end(2025, 4, 13)},
+        {"last-month", day(2025, 3, 1), end(2025, 3, 31)},
+        {"this-year", day(2025, 1, 1), end(2025, 4, 13)},
+        {"last-year", day(2024, 1, 1), end(2024, 12, 31)},
+        {"2025-W14", day(2025, 3, 31), end(2025, 4, 6)},
+        {"2026-W01", day(2025, 12, 29), end(2026, 1, 4)},
+        {"2024-02", day(2024, 2, 1), end(2024, 2, 29)},
+        {"2024", day(2024, 1, 1), end(2024, 12, 31)},
+        {"2025-04-01", day(2025, 4, 1), end(2025, 4, 1)},
+        {" Today ", day(2025, 4, 13), end(2025, 4, 13)},
+    }
+    for _, tt := range tests {
+        from, to, err := parseDateExpr(tt.expr, now)
+        if err != nil {
+            t.Errorf("parseDateExpr(%q) error = %v", tt.expr, err)
+            continue
+        }
+        if !from.Equal(tt.from) || !to.Equal(tt.to) {
+            t.Errorf("parseDateExpr(%q) = %v .. %v, want %v .. %v", tt.expr, from, to, tt.from, tt.to)
+        }
+    }
+
+    moment, _, err := parseDateExpr("2025-04-01T09:00:00+09:00", now)
+    if err != nil || !moment.Equal(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)) {
+        t.Errorf("parseDateExpr(RFC 3339) = %v, %v", moment, err)
+    }
+
+    for _, expr := range []string{"0d", "0w", "7x", "2025-W54", "2025-13", "tomorrow", ""} {
+        if _, _, err := parseDateExpr(expr, now); err == nil {
+            t.Errorf("parseDateExpr(%q) succeeded, want error", expr)
+        }
+    }
+}
+
+func TestIsRelativeDateExpr(t *testing.T) {
+    for _, expr := range []string{"today", "Yesterday", "7d", "12w", "this-month", "last-year"} {
+        if !isRelativeDateExpr(expr) {
+            t.Errorf("isRelativeDateExpr(%q) = false", expr)
+        }
+    }
+    for _, expr := range []string{"2025-04-01", "2025-04", "2025", "2025-W14", "2025-04-01T09:00:00+09:00"} {
+        if isRelativeDateExpr(expr) {
+            t.Errorf("isRelativeDateExpr(%q) = true", expr)
+        }
+    }
+}
+
+func TestParseRangeExpr(t *testing.T) {
+    now := time.Date(2025, 4, 13, 12, 0, 0, 0, time.UTC)
+    from, to, err := parseRangeExpr("2025-01-01..2025-W10", now)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !from.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2025, 3, 9, 23, 59, 59, 0, time.UTC)) {
+        t.Errorf("parseRangeExpr = %v .. %v", from, to)
+    }
+}
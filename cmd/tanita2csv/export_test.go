@@ -0,0 +1,59 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/archive"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// TestDumpExportFormats checks that the formats of every measurement are not unified per day.
+func TestDumpExportFormats(t *testing.T) {
+    dir := t.TempDir()
+    profile := &Profile{Name: DefaultProfile, ArchiveFile: filepath.Join(dir, "archive.jsonl"), Garmin: &GarminConfig{}}
+    data := testData(66.4, 66.2)
+    // a second measurement on the first day
+    data = append(data, &healthplanet.InnerscanData{Date: data[0].Date.Add(12 * time.Hour), Model: "01000117", Weight: 66.9, BodyFat: 20.7, BMI: 22.6})
+    if _, err := archive.Open(profile.ArchiveFile).Append(&healthplanet.Innerscan{Data: data}, "api"); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        format string
+        rows int
+        marker string // of a row
+    }{
+        {"csv", 2, "\n2025-"},
+        {"fitbit", 2, "\n\"2025-"},
+        {"withings", 3, "\n\"2025-"},
+        {"apple-health", 3, "HKQuantityTypeIdentifierBodyMass\""},
+    }
+    for _, tt := range tests {
+        r := &Runner{
+            config: &Config{},
+            option: &RunOption{
+                source: "archive",
+                format: tt.format,
+                weightUnit: "kg",
+                from: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+                to: time.Date(2025, 4, 2, 23, 59, 59, 0, time.UTC),
+            },
+            outputLoc: time.UTC,
+            logger: discardLogger,
+        }
+        output := filepath.Join(dir, tt.format + ".out")
+        if _, code := r.dump(profile, output, discardLogger); code != 0 {
+            t.Fatalf("%s: dump failed with %d", tt.format, code)
+        }
+        content, err := os.ReadFile(output)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if n := strings.Count(string(content), tt.marker); n != tt.rows {
+            t.Errorf("%s: %d rows, want %d:\n%s", tt.format, n, tt.rows, content)
+        }
+    }
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "path/filepath"
+    "github.com/kamaboko123/tanita2csv/pkg/garmin"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// GarminConfig is the Garmin Connect account which the measurements are uploaded to.
+// It is of each person, so a profile has its own section and does not inherit the top level one.
+type GarminConfig struct {
+    UploadURL string `yaml:"upload_url"`
+    LoginURL string `yaml:"login_url"`          // form login with the username and the password, when the session is missing or expired
+    Username string `yaml:"username"`
+    Password string `yaml:"password"`
+    Cookie string `yaml:"cookie"`               // session cookies copied from a browser, e.g. "SESSIONID=...; JWT=..."
+    Headers map[string]string `yaml:"headers"`
+    StateFile string `yaml:"state_file"`        // default: $XDG_STATE_HOME/tanita2csv/garmin.json (garmin-<profile>.json)
+}
+
+func (g *GarminConfig) enabled() bool {
+    return g != nil && g.UploadURL != ""
+}
+
+// stateFile returns the file keeping the session and the uploaded days of the profile.
+func (g *GarminConfig) stateFile(profileName string) string {
+    if g.StateFile != "" {
+        return g.StateFile
+    }
+    if profileName == DefaultProfile {
+        return filepath.Join(StateDir(), "garmin.json")
+    }
+    return filepath.Join(StateDir(), "garmin-" + profileName + ".json")
+}
+
+func (c *Config) validateGarmin(prefix string, g *GarminConfig, profileName string) []ConfigProblem {
+    if !g.enabled() {
+        return nil
+    }
+    problems := c.checkURL(prefix + "upload_url", g.UploadURL)
+    if g.LoginURL != "" {
+        problems = append(problems, c.checkURL(prefix + "login_url", g.LoginURL)...)
+        problems = append(problems, c.checkRequired(prefix + "username", g.Username)...)
+        problems = append(problems, c.checkRequired(prefix + "password", g.Password)...)
+    } else if g.Cookie == "" {
+        problems = append(problems, c.problem(prefix + "upload_url", "needs login_url or cookie for the session"))
+    }
+    problems = append(problems, c.checkWritable(prefix + "state_file", g.stateFile(profileName))...)
+    return problems
+}
+
+// garminSink uploads the new measurements of the profile to Garmin Connect.
+type garminSink struct {
+    config *GarminConfig
+}
+
+func (s *garminSink) Name() string {
+    return "garmin"
+}
+
+func (s *garminSink) Send(profile *Profile, innerscan *healthplanet.Innerscan, data []*healthplanet.InnerscanData) error {
+    _, err := s.upload(profile, data)
+    return err
+}
+
+// upload uploads the days of the data which are not uploaded yet, keeping the session in the state file.
+func (s *garminSink) upload(profile *Profile, data []*healthplanet.InnerscanData) (*garmin.Result, error) {
+    path := s.config.stateFile(profile.Name)
+    state, err := garmin.LoadState(path)
+    if err != nil {
+        return nil, err
+    }
+
+    client := garmin.NewClient(s.config.UploadURL)
+    client.LoginURL = s.config.LoginURL
+    client.Username = s.config.Username
+    client.Password = s.config.Password
+    client.Headers = s.config.Headers
+    if len(state.Cookies) > 0 {
+        client.SetCookies(state.Cookies)
+    } else {
+        client.SetCookies(garmin.ParseCookies(s.config.Cookie))
+    }
+
+    result, err := garmin.UploadNew(context.Background(), client, state, data)
+    state.Cookies = client.Cookies()
+    if errors.Is(err, garmin.ErrUnauthorized) {
+        // forget the expired session, so that the next run starts from the config
+        state.Cookies = nil
+        if s.config.LoginURL == "" {
+            err = fmt.Errorf("%w (update cookie in the garmin config)", err)
+        }
+    }
+    if saveErr := state.Save(path); saveErr != nil && err == nil {
+        err = fmt.Errorf("failed to save the Garmin state: %w", saveErr)
+    }
+    return result, err
+}
+
+// runUpload uploads the CSV files given by -i, or the measurements of the period, to Garmin Connect.
+// The days uploaded before with the same values are skipped.
+func (r *Runner) runUpload(profile *Profile, logger *slog.Logger) int {
+    if !profile.Garmin.enabled() {
+        logger.Error("Garmin Connect is not configured, set garmin.upload_url in the config (or in the profile)")
+        return 1
+    }
+
+    var data []*healthplanet.InnerscanData
+    if len(r.option.inputs) > 0 {
+        for _, input := range r.option.inputs {
+            innerscan, err := r.readCsv(input)
+            if err != nil {
+                logger.Error("Failed to read input file", "input_file", input, "error", err)
+                return 1
+            }
+            logger.Info("Successfully read input file", "input_file", input, "data_count", len(innerscan.Data))
+            data = append(data, innerscan.WithoutOutliers().Data...)
+        }
+        (&healthplanet.Innerscan{Data: data}).Sort()
+    } else {
+        innerscan, code := r.fetchFiltered(profile, logger)
+        if code != 0 {
+            return code
+        }
+        data = innerscan.WithoutOutliers().Data
+    }
+
+    sink := &garminSink{config: profile.Garmin}
+    result, err := sink.upload(profile, data)
+    if err != nil {
+        logger.Error("Failed to upload to Garmin Connect", "error", err)
+        return 1
+    }
+    if result.Duplicate {
+        logger.Warn("Garmin Connect already has the file, recorded it as uploaded", "data_count", result.Uploaded)
+        fmt.Printf("Garmin Connect already has the %d days, skipped %d days uploaded before\n", result.Uploaded, result.Skipped)
+        return 0
+    }
+    logger.Info("Uploaded to Garmin Connect", "uploaded_count", result.Uploaded, "skipped_count", result.Skipped)
+    fmt.Printf("Uploaded %d days, skipped %d days uploaded before\n", result.Uploaded, result.Skipped)
+    return 0
+}
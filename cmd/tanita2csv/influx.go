@@ -0,0 +1,62 @@
+package main
+
+import (
+    "context"
+    "log/slog"
+    "github.com/kamaboko123/tanita2csv/pkg/influx"
+)
+
+// InfluxConfig is the InfluxDB which influx mode writes the measurements to.
+type InfluxConfig struct {
+    URL string `yaml:"url"`                 // e.g. http://localhost:8086
+    Org string `yaml:"org"`
+    Bucket string `yaml:"bucket"`
+    Token string `yaml:"token"`
+    Measurement string `yaml:"measurement"` // default: innerscan
+}
+
+func (c *Config) validateInflux() []ConfigProblem {
+    if c.InfluxDB.URL == "" {
+        return nil
+    }
+    problems := c.checkURL("influxdb.url", c.InfluxDB.URL)
+    problems = append(problems, c.checkRequired("influxdb.bucket", c.InfluxDB.Bucket)...)
+    if c.InfluxDB.Token != "" {
+        problems = append(problems, c.checkRequired("influxdb.token", c.InfluxDB.Token)...)
+    }
+    return problems
+}
+
+// runInflux writes the measurements of the period in the InfluxDB line protocol,
+// to the file given by -o or to the InfluxDB in the config.
+func (r *Runner) runInflux(profile *Profile, logger *slog.Logger) int {
+    innerscan, code := r.fetchFiltered(profile, logger)
+    if code != 0 {
+        return code
+    }
+    if r.option.metrics {
+        innerscan.CalcMetrics()
+    }
+
+    measurement := r.config.InfluxDB.Measurement
+    if measurement == "" {
+        measurement = influx.DefaultMeasurement
+    }
+    lines := influx.LineProtocol(measurement, map[string]string{"profile": profileLabel(profile)}, innerscan)
+
+    if r.option.output != "" {
+        return r.writeOutput(r.reportPath(profile), lines, logger)
+    }
+    if r.config.InfluxDB.URL == "" {
+        logger.Error("InfluxDB is not configured, set influxdb.url in the config or use -o to write to a file")
+        return 1
+    }
+    c := r.config.InfluxDB
+    err := influx.NewWriter(c.URL, c.Org, c.Bucket, c.Token).Write(context.Background(), lines)
+    if err != nil {
+        logger.Error("Failed to write to InfluxDB", "url", c.URL, "error", err)
+        return 1
+    }
+    logger.Info("Data written to InfluxDB", "url", c.URL, "bucket", c.Bucket, "data_count", len(innerscan.Data))
+    return 0
+}
@@ -4,90 +4,239 @@ import (
     "fmt"
     "log/slog"
     "os"
-    "gopkg.in/yaml.v3"
-    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+    "slices"
+    "strings"
     "time"
+    _ "time/tzdata" // embed the time zone database for platforms without it (e.g. Windows)
     "flag"
+    "github.com/kamaboko123/tanita2csv/pkg/analytics"
+    "github.com/kamaboko123/tanita2csv/pkg/export"
+    "github.com/kamaboko123/tanita2csv/pkg/schedule"
 )
 
 const Version = "1.0.3"
 
-type Config struct {
-    URL          string `yaml:"url"`
-    TokenFile    string `yaml:"token_file"`
-    ClientID     string `yaml:"client_id"`
-    ClientSecret string `yaml:"client_secret"`
+// StringsValue is a flag which can be given multiple times.
+type StringsValue []string
+
+func (s *StringsValue) String() string {
+    if s == nil {
+        return ""
+    }
+    return strings.Join(*s, ",")
+}
+
+func (s *StringsValue) Set(value string) error {
+    *s = append(*s, value)
+    return nil
+}
+
+type RunOption struct {
+    configFile string   // config file path
+    mode string         // auth, dump, import, merge, diff, trend, summary, goal, gaps, report, influx, publish, upload, serve-metrics, serve, dashboard, daemon, config
+    subcommand string   // subcommand of the mode (config: check)
+    dates [3]*DateValue // -f, -t and -range, resolved into from and to after the time zone is known
+    from time.Time      // beginning of the period
+    to   time.Time      // end of the period (inclusive)
+    inputs []string     // input file paths
+    output string       // output file path
+    profile string      // profile name in the config
+    allProfiles bool    // run for every profile in the config
+    source string       // where to read the measurements from: api, archive
+    periodGiven bool    // whether -f, -t or -range is given explicitly
+    format string       // output format of the mode
+    weightUnit string   // unit of the weight in the fitbit, withings and apple-health formats: kg, lb
+    group string        // group of the summary: week, month, year
+    fill string         // method to fill the missing days in dump: "" (no fill), linear, locf
+    trend bool          // add the trend columns to the output
+    metrics bool        // add the derived body composition metrics to the output
+    trendOptions analytics.TrendOptions // parameters of the trend smoothing
+    outliers string     // outlier filter: "" (off), drop, mark, reject
+    outlierOptions analytics.OutlierOptions // parameters of the outlier detection, without the bounds of the profile
+    rejects string      // file path to write the rejected outliers
+    listen string       // address to listen on for the servers
+    interval time.Duration // interval of the fetches of the servers
+    schedule schedule.Schedule // schedule of the runs of daemon mode
+    debug bool          // debug mode
 }
 
-func loadConfig(filePath string) (*Config, error) {
-    content, err := os.ReadFile(filePath)
+// resolveDates resolves -f, -t and -range into the period to dump.
+// -range sets both ends, and -f and -t override each end if given explicitly.
+func resolveDates(f *DateValue, t *DateValue, r *DateValue, now time.Time) (time.Time, time.Time, error) {
+    explicit := map[string]bool{}
+    flag.Visit(func(fl *flag.Flag) {
+        explicit[fl.Name] = true
+    })
+
+    from, _, err := f.Resolve(now)
     if err != nil {
-        return nil, fmt.Errorf("failed to read config file: %w", err)
+        return time.Time{}, time.Time{}, err
     }
-    var config Config
-    err = yaml.Unmarshal(content, &config)
+    _, to, err := t.Resolve(now)
     if err != nil {
-        return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+        return time.Time{}, time.Time{}, err
+    }
+    if r.IsSet() {
+        rangeFrom, rangeTo, err := r.Resolve(now)
+        if err != nil {
+            return time.Time{}, time.Time{}, err
+        }
+        if !explicit["f"] {
+            from = rangeFrom
+        }
+        if !explicit["t"] {
+            to = rangeTo
+        }
     }
-    return &config, nil
+    return from, to, nil
 }
 
-
-type DateValue struct {
-    time.Time
+// writtenFiles returns the kinds of the files in the config which the mode writes, to check them before running:
+// the token and the archive by a fetch from the API, and the state of the sinks by the modes which send to them.
+func (o *RunOption) writtenFiles() []string {
+    switch o.mode {
+    case "auth":
+        return []string{"token_file"}
+    case "import":
+        return []string{"archive_file"}
+    }
+    var files []string
+    if o.source == "api" {
+        files = append(files, "token_file", "archive_file")
+    }
+    switch o.mode {
+    case "dump", "daemon":
+        if o.source == "api" {
+            files = append(files, "dead_letter_file", "state_file")
+        }
+    case "publish":
+        files = append(files, "dead_letter_file", "state_file")
+    case "upload":
+        files = append(files, "state_file")
+    }
+    return files
 }
-type FromDateValue DateValue
-type ToDateValue DateValue
 
-func (d *DateValue) String() string {
-    if d == nil{
-        return ""
-    }
-    return d.Format("2006-01-02")
+// needsPeriod reports whether the mode takes the period by -f, -t and -range.
+func (o *RunOption) needsPeriod() bool {
+    return o.dates[0] != nil
 }
 
-func (f *FromDateValue) Set(value string) error {
-    date, err := time.Parse("2006-01-02", value)
+// resolvePeriod resolves the date flags into from and to, with day boundaries of now's location.
+func (o *RunOption) resolvePeriod(now time.Time) error {
+    from, to, err := resolveDates(o.dates[0], o.dates[1], o.dates[2], now)
     if err != nil {
-        return fmt.Errorf("invalid date format for from date: %w", err)
+        return err
+    }
+    if from.After(to) {
+        return fmt.Errorf("From date cannot be after To date.")
     }
-    f.Time = date
+    o.from = from
+    o.to = to
     return nil
 }
 
-func (t *ToDateValue) Set(value string) error {
-    date, err := time.Parse("2006-01-02", value)
-    if err != nil {
-        return fmt.Errorf("invalid date format for to date: %w", err)
+// exportFormats are the import formats of other platforms, which have only the measurements.
+var exportFormats = []string{"fitbit", "withings", "apple-health"}
+
+// checkExportFormat exits if an option adding columns or rows is used with an export format,
+// as the platform would drop them or import the filled rows as measurements.
+func checkExportFormat(o *RunOption) {
+    if !slices.Contains(exportFormats, o.format) {
+        return
+    }
+    var unsupported []string
+    if o.trend {
+        unsupported = append(unsupported, "-trend")
+    }
+    if o.metrics {
+        unsupported = append(unsupported, "-metrics")
+    }
+    if o.fill != "" {
+        unsupported = append(unsupported, "-fill")
+    }
+    if o.outliers == "mark" {
+        unsupported = append(unsupported, "-outliers mark")
+    }
+    if len(unsupported) > 0 {
+        fmt.Printf("%s cannot be used with -format %s, which has only the measurements.\n", strings.Join(unsupported, ", "), o.format)
+        os.Exit(1)
     }
-    t.Time = date
-    return nil
 }
 
-
-type RunOption struct {
-    configFile string   // config file path
-    mode string         // auth, dump
-    from time.Time      // YYYYMMDD
-    to   time.Time      // YYYYMMDD
-    output string       // output file path
-    debug bool          // debug mode
+// checkFormat exits if the format is not one of the formats of the mode. Empty is the default of the mode.
+func checkFormat(format string, formats ...string) {
+    if format == "" || slices.Contains(formats, format) {
+        return
+    }
+    if len(formats) == 0 {
+        fmt.Println("-format cannot be used in this mode.")
+        os.Exit(1)
+    }
+    options := make([]string, len(formats))
+    for i, f := range formats {
+        options[i] = "-format " + f
+    }
+    fmt.Printf("Invalid format. Use %s or %s\n", strings.Join(options[:len(options)-1], ", "), options[len(options)-1])
+    os.Exit(1)
 }
 
 func getArgs() *RunOption {
     runOption := &RunOption{}
 
-    c := flag.String("c", "config.yml", "Config file path")
+    c := flag.String("c", "", "Config file path (default: ./config.yml, then $XDG_CONFIG_HOME/tanita2csv/config.yml)")
+
+    m := flag.String("m", "", "Mode to run: auth, dump, import (CSV downloaded from the HealthPlanet website), merge (CSV files made by dump), diff (a previous export against HealthPlanet), trend (moving averages and the weekly rate), summary (statistics per week, month or year), goal (progress toward the goals in the config), gaps (days without measurements), report (HTML or SVG charts), influx (write to InfluxDB, or the line protocol to -o), publish (send the latest measurement to the sinks: MQTT, webhooks and Garmin Connect), upload (CSV files or the period to Garmin Connect), serve-metrics (Prometheus exporter), serve (REST API of the archived measurements), dashboard (web UI with charts), daemon (dump on a schedule) or config (config check: validate the config file)")
+
+    f := NewDateValue("90d") // Default is the last 3 months
+    flag.Var(f, "f", "From date for dump mode: YYYY-MM-DD, 7d, 12w, yesterday, last-month, this-year, 2025-W14, RFC 3339, ... Default is 3 months ago from today.")
+
+    t := NewDateValue("today") // Default is today
+    flag.Var(t, "t", "To date for dump mode, in the same format as -f. Default is today.")
+
+    r := NewRangeValue("")
+    flag.Var(r, "range", "Date range for dump mode, setting both -f and -t: e.g. last-month, 2025-W14, 30d, 2025-01-01..2025-03-31. -f and -t override each end.")
+
+    i := &StringsValue{}
+    flag.Var(i, "i", "Input file path for import, merge, diff and upload mode. Can be given multiple times.")
 
-    m := flag.String("m", "", "Mode to run: auth or dump")
+    o := flag.String("o", "", "Output file path, or the output directory for daemon mode. With -all-profiles, \"{profile}\" in the path is replaced with the profile name.")
 
-    f := &FromDateValue{Time: time.Now().AddDate(0, 0, -89)} // Default is 3 months ago
-    flag.Var(f, "f", "From date (YYYY-MM-DD) for dump mode. Default is 3 months ago from today.")
+    p := flag.String("profile", os.Getenv(EnvPrefix + "PROFILE"), "Profile name in the config. Default is the top level settings.")
 
-    t := &ToDateValue{Time: time.Now()} // Default is today
-    flag.Var(t, "t", "To date (YYYY-MM-DD) for dump mode. Default is today.")
+    a := flag.Bool("all-profiles", false, "Run for every profile in the config, writing one output per profile")
 
-    o := flag.String("o", "", "Output file path")
+    format := flag.String("format", "", "Output format: csv, json, fitbit, withings or apple-health for dump and daemon mode, csv or json for merge mode, text or json for diff mode, text, csv or json for trend and summary mode, text or json for goal and gaps mode, html or svg for report mode")
+
+    weightUnit := flag.String("weight-unit", export.UnitKg, "Unit of the weight in the fitbit, withings and apple-health formats: kg or lb, as in the account of the platform")
+
+    trend := flag.Bool("trend", false, "Add the trend columns (WeightSMA, WeightEWMA, WeightSlope) to the output of dump mode")
+
+    metrics := flag.Bool("metrics", false, "Add the derived metrics (fat mass, lean mass, age, BMI category, BMR) to the CSV or JSON output")
+
+    defaultTrend := analytics.DefaultTrendOptions()
+    smaDays := flag.Int("sma-days", defaultTrend.SMADays, "Window of the simple moving average of the weight in days")
+    ewmaAlpha := flag.Float64("ewma-alpha", defaultTrend.Alpha, "Smoothing factor of the exponentially weighted moving average per day (0 < alpha <= 1)")
+    slopeDays := flag.Int("slope-days", defaultTrend.SlopeDays, "Window of the linear regression for the weekly rate in days")
+
+    outliers := flag.String("outliers", "", "Filter the outliers before dump, trend and summary: drop, mark (add Outlier columns) or reject (drop and write them to -rejects). Default is off.")
+    rejects := flag.String("rejects", "", "Output file path of the outliers for -outliers reject")
+
+    defaultOutlier := analytics.DefaultOutlierOptions()
+    outlierWindow := flag.Int("outlier-window", defaultOutlier.WindowDays, "Window of the median absolute deviation of the outlier filter in days (0 to disable)")
+    outlierThreshold := flag.Float64("outlier-threshold", defaultOutlier.Threshold, "Modified z-score over which a weight is an outlier")
+    maxDailyChange := flag.Float64("max-daily-change", defaultOutlier.MaxDailyChange, "Max change of the weight per day in kg for the outlier filter (0 to disable)")
+    maxDailyChangePct := flag.Float64("max-daily-change-pct", defaultOutlier.MaxDailyChangePercent, "Max change of the weight per day in % for the outlier filter (0 to disable)")
+
+    fill := flag.String("fill", "", "Fill the days without measurements between the measurements in dump mode: linear or locf (last observation carried forward). The filled rows are marked as synthetic.")
+
+    listen := flag.String("listen", "", "Address to listen on for serve-metrics mode (default: "+DefaultMetricsListen+") serve mode (default: "+DefaultServeListen+") dashboard mode (default: "+DefaultDashboardListen+") and the health endpoint of daemon mode (default: "+DefaultDaemonListen+")")
+    interval := flag.Duration("interval", DefaultMetricsInterval, "Interval of the fetches from HealthPlanet for serve-metrics, serve and dashboard mode, e.g. 30m, 1h, and of the runs of daemon mode (default: "+DefaultDaemonInterval.String()+")")
+    sched := flag.String("schedule", "", "Cron expression of the runs of daemon mode in the time zone of the config, e.g. \"0 6 * * *\" or @daily, instead of -interval")
+
+    by := flag.String("by", analytics.GroupMonth, "Group of summary mode and the summary table of report mode: week (ISO week), month or year")
+
+    src := flag.String("source", "api", "Where to read the measurements from: api (HealthPlanet, also filling the archive) or archive (local archive, offline)")
 
     d := flag.Bool("v", false, "Debug mode")
     
@@ -103,24 +252,218 @@ func getArgs() *RunOption {
     runOption.configFile = *c
     runOption.debug = *d
     runOption.mode = *m
+    runOption.profile = *p
+    runOption.allProfiles = *a
+    runOption.trend = *trend
+    runOption.metrics = *metrics
+    runOption.trendOptions = analytics.TrendOptions{
+        SMADays: *smaDays,
+        Alpha: *ewmaAlpha,
+        SlopeDays: *slopeDays,
+    }
 
-    switch runOption.mode {
-    case "dump":
-        runOption.from = f.Truncate(time.Hour).Add(-time.Duration(f.Hour()) * time.Hour)
-        runOption.to = t.Truncate(time.Hour).Add(-time.Duration(t.Hour()) * time.Hour).Add(23 * time.Hour + 59 * time.Minute + 59 * time.Second) // End of the day
+    if runOption.trendOptions.SMADays < 1 || runOption.trendOptions.SlopeDays < 1 {
+        fmt.Println("-sma-days and -slope-days must be 1 or more.")
+        os.Exit(1)
+    }
+    if runOption.trendOptions.Alpha <= 0 || runOption.trendOptions.Alpha > 1 {
+        fmt.Println("-ewma-alpha must be more than 0 and 1 or less.")
+        os.Exit(1)
+    }
+
+    if runOption.allProfiles && runOption.profile != "" {
+        fmt.Println("-profile and -all-profiles cannot be used together.")
+        os.Exit(1)
+    }
 
-        if runOption.from.After(runOption.to) {
-            fmt.Println("From date cannot be after To date.")
+    switch runOption.mode {
+    case "dump", "daemon", "trend", "summary", "goal", "gaps", "report", "influx", "publish", "upload":
+        runOption.dates = [3]*DateValue{f, t, r}
+        runOption.output = *o
+        runOption.source = *src
+        runOption.format = *format
+        if runOption.source != "api" && runOption.source != "archive" {
+            fmt.Println("Invalid source. Use -source api or -source archive")
             os.Exit(1)
         }
-        if runOption.to.Sub(runOption.from) > 90*24*time.Hour{
-            fmt.Println("The date range cannot exceed 90 days.(from:", runOption.from, ", to:", runOption.to, ")")
+        runOption.outliers = *outliers
+        runOption.rejects = *rejects
+        runOption.outlierOptions = analytics.OutlierOptions{
+            WindowDays: *outlierWindow,
+            Threshold: *outlierThreshold,
+            MaxDailyChange: *maxDailyChange,
+            MaxDailyChangePercent: *maxDailyChangePct,
+        }
+        if runOption.outliers != "" && runOption.outliers != "drop" && runOption.outliers != "mark" && runOption.outliers != "reject" {
+            fmt.Println("Invalid outlier filter. Use -outliers drop, -outliers mark or -outliers reject")
             os.Exit(1)
         }
+        if (runOption.outliers == "reject") != (runOption.rejects != "") {
+            fmt.Println("-outliers reject and -rejects must be used together.")
+            os.Exit(1)
+        }
+        switch runOption.mode {
+        case "dump", "daemon":
+            checkFormat(runOption.format, "csv", "json", "fitbit", "withings", "apple-health")
+            runOption.weightUnit = *weightUnit
+            if !export.ValidUnit(runOption.weightUnit) {
+                fmt.Println("Invalid weight unit. Use -weight-unit kg or -weight-unit lb")
+                os.Exit(1)
+            }
+        case "goal", "gaps":
+            checkFormat(runOption.format, "text", "json")
+        case "report":
+            checkFormat(runOption.format, "html", "svg")
+            if runOption.format == "svg" && runOption.output == "" {
+                fmt.Println("-format svg needs -o, e.g. -o charts.svg writes charts-weight.svg and charts-body_fat.svg")
+                os.Exit(1)
+            }
+        case "influx", "publish", "upload":
+            checkFormat(runOption.format)
+        default:
+            checkFormat(runOption.format, "text", "csv", "json")
+        }
+        if runOption.mode == "upload" {
+            runOption.inputs = *i
+            if len(runOption.inputs) > 0 && runOption.allProfiles {
+                fmt.Println("-i cannot be used with -all-profiles in upload mode, use -profile instead.")
+                os.Exit(1)
+            }
+        }
+        if runOption.mode == "dump" || runOption.mode == "daemon" {
+            runOption.fill = *fill
+            if runOption.fill != "" && runOption.fill != analytics.FillLinear && runOption.fill != analytics.FillLOCF {
+                fmt.Println("Invalid fill method. Use -fill linear or -fill locf")
+                os.Exit(1)
+            }
+            checkExportFormat(runOption)
+        }
+        if runOption.mode == "daemon" {
+            if runOption.output == "" {
+                fmt.Println("Specify the output directory of daemon mode with -o.")
+                os.Exit(1)
+            }
+            runOption.listen = *listen
+            if runOption.listen == "" {
+                runOption.listen = DefaultDaemonListen
+            }
+            intervalGiven := false
+            flag.Visit(func(fl *flag.Flag) {
+                if fl.Name == "interval" {
+                    intervalGiven = true
+                }
+            })
+            if *sched != "" {
+                if intervalGiven {
+                    fmt.Println("-schedule and -interval cannot be used together.")
+                    os.Exit(1)
+                }
+                cron, err := schedule.ParseCron(*sched)
+                if err != nil {
+                    fmt.Printf("Invalid schedule: %v\n", err)
+                    os.Exit(1)
+                }
+                if cron.Next(time.Now()).IsZero() {
+                    fmt.Printf("The schedule %q never runs.\n", *sched)
+                    os.Exit(1)
+                }
+                runOption.schedule = cron
+            } else {
+                runOption.interval = DefaultDaemonInterval
+                if intervalGiven {
+                    runOption.interval = *interval
+                }
+                if runOption.interval < time.Minute {
+                    fmt.Println("-interval must be 1m or more.")
+                    os.Exit(1)
+                }
+                runOption.schedule = schedule.Every(runOption.interval)
+            }
+        }
+        if runOption.mode == "summary" || runOption.mode == "report" {
+            runOption.group = *by
+            if _, err := analytics.GroupKey(time.Time{}, runOption.group); err != nil {
+                fmt.Println("Invalid group. Use -by week, -by month or -by year")
+                os.Exit(1)
+            }
+        }
+    case "merge", "diff":
+        runOption.dates = [3]*DateValue{f, t, r}
+        runOption.inputs = *i
         runOption.output = *o
+        runOption.source = *src
+        runOption.format = *format
+        flag.Visit(func(fl *flag.Flag) {
+            if fl.Name == "f" || fl.Name == "t" || fl.Name == "range" {
+                runOption.periodGiven = true
+            }
+        })
+        if runOption.mode == "merge" && len(runOption.inputs) == 0 && !runOption.periodGiven {
+            fmt.Println("Nothing to merge. Use -i to specify the CSV files, and -f, -t or -range to merge the data from -source.")
+            os.Exit(1)
+        }
+        if runOption.mode == "diff" && len(runOption.inputs) != 1 {
+            fmt.Println("Specify the previous export to compare with -i.")
+            os.Exit(1)
+        }
+        if runOption.mode == "diff" {
+            checkFormat(runOption.format, "text", "json")
+        } else {
+            checkFormat(runOption.format, "csv", "json")
+        }
+        if runOption.source != "api" && runOption.source != "archive" {
+            fmt.Println("Invalid source. Use -source api or -source archive")
+            os.Exit(1)
+        }
+        if runOption.allProfiles {
+            fmt.Printf("-all-profiles cannot be used in %s mode, use -profile instead.\n", runOption.mode)
+            os.Exit(1)
+        }
+    case "import":
+        runOption.inputs = *i
+        runOption.output = *o
+        if len(runOption.inputs) == 0 {
+            fmt.Println("No input file. Use -i to specify the CSV file downloaded from the HealthPlanet website.")
+            os.Exit(1)
+        }
+        if runOption.allProfiles {
+            fmt.Println("-all-profiles cannot be used in import mode, use -profile instead.")
+            os.Exit(1)
+        }
+    case "serve-metrics", "serve", "dashboard":
+        runOption.listen = *listen
+        runOption.interval = *interval
+        runOption.source = "api"
+        if runOption.mode != "serve-metrics" {
+            runOption.source = *src
+            if runOption.source != "api" && runOption.source != "archive" {
+                fmt.Println("Invalid source. Use -source api or -source archive")
+                os.Exit(1)
+            }
+        }
+        if runOption.listen == "" {
+            switch runOption.mode {
+            case "serve-metrics":
+                runOption.listen = DefaultMetricsListen
+            case "serve":
+                runOption.listen = DefaultServeListen
+            case "dashboard":
+                runOption.listen = DefaultDashboardListen
+            }
+        }
+        if runOption.interval < time.Minute {
+            fmt.Println("-interval must be 1m or more.")
+            os.Exit(1)
+        }
     case "auth":
+    case "config":
+        runOption.subcommand = flag.Arg(0)
+        if runOption.subcommand != "check" {
+            fmt.Println("Invalid config subcommand. Use -m config check")
+            os.Exit(1)
+        }
     default:
-        fmt.Println("Invalid mode. Use -m auth or -m dump")
+        fmt.Println("Invalid mode. Use -m auth, -m dump, -m import, -m merge, -m diff, -m trend, -m summary, -m goal, -m gaps, -m report, -m influx, -m publish, -m upload, -m serve-metrics, -m serve, -m dashboard, -m daemon or -m config check")
         os.Exit(1)
     }
 
@@ -135,83 +478,47 @@ func main() {
         loglevel = slog.LevelDebug
     }
 
-    logger := slog.New(
-        slog.NewTextHandler(
-            os.Stderr,
-            &slog.HandlerOptions{
-                Level: loglevel,
-            },
-        ),
-    )
+    var handler slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: loglevel})
+    if runOption.mode == "daemon" {
+        // the daemon logs every run, as JSON for the log collectors
+        if !runOption.debug {
+            loglevel = slog.LevelInfo
+        }
+        handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: loglevel})
+    }
+    logger := slog.New(handler)
+
+    if runOption.mode == "config" {
+        os.Exit(runConfigCheck(os.Stdout, runOption.configFile))
+    }
 
     // Load config file
-    config, err := loadConfig(runOption.configFile)
+    config, err := loadConfig(runOption.configFile, runOption.writtenFiles()...)
     if err != nil {
         logger.Error("Failed to load config", "error", err)
-        return
+        os.Exit(1)
     }
 
-    // Initialize HealthPlanet Auth
-    auth := healthplanet.NewSimpleAuth(config.URL, config.ClientID, config.ClientSecret, config.TokenFile, logger)
-
-    // check token file existence
-    if runOption.mode == "auth" {
-        logger.Info("Starting authentication process")
-        err = auth.Auth()
-        if err != nil {
-            logger.Error("Failed to authenticate with HealthPlanet, abort.", "error", err)
-            os.Exit(10)
-        }
-        logger.Info("Authentication successful, token file created", "token_file", config.TokenFile)
-        os.Exit(0)
+    apiLoc, queryLoc, outputLoc, err := config.Locations()
+    if err != nil {
+        logger.Error("Failed to load time zones", "error", err)
+        os.Exit(1)
     }
-
-    if runOption.mode == "dump" {
-        _, err = os.Stat(config.TokenFile); if err != nil {
-            logger.Warn("Token file does not exist, please run in auth mode first.", "error", err)
-            os.Exit(1)
-        }
-
-        err = auth.RefreshToken()
+    if runOption.needsPeriod() {
+        err = runOption.resolvePeriod(time.Now().In(queryLoc))
         if err != nil {
-            logger.Error("Failed to refresh token, abort. Please reauthenticate with auth mode.", "error", err)
-            os.Exit(11)
+            fmt.Println(err)
+            os.Exit(1)
         }
+    }
 
-        // Init HealthPlanet Client
-        hpClient := healthplanet.NewClient(config.URL, auth, logger)
-
-        // Get Innerscan Data
-        // Note: between `from` and `to` is limited to 3 month maximum.
-        innerscan, err := hpClient.GetInnerscanData(runOption.from, runOption.to)
-        if err != nil {
-            logger.Error("Failed to get Innerscan data", "error", err)
-            return
-        }
-        logger.Info("Successfully retrieved Innerscan data", "data_count", len(innerscan.Data))
-        if runOption.output != "" {
-            // Write to output file
-            file, err := os.Create(runOption.output)
-            if err != nil {
-                logger.Error("Failed to create output file", "error", err)
-                return
-            }
-            defer file.Close()
-            _, err = file.WriteString("Body\n")
-            if err != nil {
-                logger.Error("Failed to write header to output file", "error", err)
-                return
-            }
-            _, err = file.WriteString(innerscan.ToCsv())
-            if err != nil {
-                logger.Error("Failed to write to output file", "error", err)
-                return
-            }
-            logger.Info("Data written to output file", "output_file", runOption.output)
-        } else {
-            // Print to stdout
-            fmt.Println("Body")
-            fmt.Print(innerscan.ToCsv())
-        }
+    runner := &Runner{
+        config: config,
+        option: runOption,
+        logger: logger,
+        apiLoc: apiLoc,
+        queryLoc: queryLoc,
+        outputLoc: outputLoc,
     }
+    os.Exit(runner.Run())
 }
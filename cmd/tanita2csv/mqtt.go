@@ -0,0 +1,219 @@
+package main
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/json"
+    "fmt"
+    "os"
+    "regexp"
+    "strings"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+    "github.com/kamaboko123/tanita2csv/pkg/mqtt"
+)
+
+const (
+    DefaultMQTTClientID = AppName
+    DefaultMQTTTopic = AppName + "/{profile}/state"
+    DefaultDiscoveryPrefix = "homeassistant"
+)
+
+// MQTTConfig is the MQTT broker which the new measurements are published to, e.g. for Home Assistant.
+type MQTTConfig struct {
+    Broker string `yaml:"broker"`                    // tcp://host:1883, or ssl://host:8883 for TLS
+    Username string `yaml:"username"`
+    Password string `yaml:"password"`
+    ClientID string `yaml:"client_id"`               // default: tanita2csv
+    CAFile string `yaml:"ca_file"`                   // CA certificate (PEM) of the broker, default: system roots
+    InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+    Topic string `yaml:"topic"`                      // state topic, {profile} is the profile (default: tanita2csv/{profile}/state)
+    QoS *int `yaml:"qos"`                            // 0 or 1 (default: 1)
+    Retain *bool `yaml:"retain"`                     // retain the state (default: true)
+    Discovery *bool `yaml:"discovery"`               // announce Home Assistant discovery (default: true)
+    DiscoveryPrefix string `yaml:"discovery_prefix"` // default: homeassistant
+}
+
+func (c *MQTTConfig) qos() byte {
+    if c.QoS == nil {
+        return 1
+    }
+    return byte(*c.QoS)
+}
+
+func (c *MQTTConfig) retain() bool {
+    return c.Retain == nil || *c.Retain
+}
+
+func (c *MQTTConfig) discovery() bool {
+    return c.Discovery == nil || *c.Discovery
+}
+
+func (c *MQTTConfig) stateTopic(profile *Profile) string {
+    topic := c.Topic
+    if topic == "" {
+        topic = DefaultMQTTTopic
+    }
+    return strings.ReplaceAll(topic, "{profile}", profileLabel(profile))
+}
+
+func (c *MQTTConfig) options() (mqtt.Options, error) {
+    opts := mqtt.Options{
+        Broker: c.Broker,
+        ClientID: c.ClientID,
+        Username: c.Username,
+        Password: c.Password,
+    }
+    if opts.ClientID == "" {
+        opts.ClientID = DefaultMQTTClientID
+    }
+    if c.CAFile == "" && !c.InsecureSkipVerify {
+        return opts, nil
+    }
+    opts.TLSConfig = &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+    if c.CAFile != "" {
+        pem, err := os.ReadFile(c.CAFile)
+        if err != nil {
+            return opts, err
+        }
+        opts.TLSConfig.RootCAs = x509.NewCertPool()
+        if !opts.TLSConfig.RootCAs.AppendCertsFromPEM(pem) {
+            return opts, fmt.Errorf("no certificate in %s", c.CAFile)
+        }
+    }
+    return opts, nil
+}
+
+func (c *Config) validateMQTT() []ConfigProblem {
+    m := &c.MQTT
+    if m.Broker == "" {
+        return nil
+    }
+    var problems []ConfigProblem
+    if _, _, err := mqtt.BrokerAddress(m.Broker); err != nil {
+        problems = append(problems, c.problem("mqtt.broker", "%v", err))
+    }
+    if m.QoS != nil && *m.QoS != 0 && *m.QoS != 1 {
+        problems = append(problems, c.problem("mqtt.qos", "must be 0 or 1 (%d)", *m.QoS))
+    }
+    if strings.ContainsAny(m.Topic, "+#") {
+        problems = append(problems, c.problem("mqtt.topic", "wildcards cannot be published to (%q)", m.Topic))
+    }
+    if strings.ContainsAny(m.DiscoveryPrefix, "+#") {
+        problems = append(problems, c.problem("mqtt.discovery_prefix", "wildcards cannot be published to (%q)", m.DiscoveryPrefix))
+    }
+    if m.CAFile != "" {
+        if _, err := m.options(); err != nil {
+            problems = append(problems, c.problem("mqtt.ca_file", "%v", err))
+        }
+    }
+    return problems
+}
+
+// mqttSink publishes each measurement as JSON to the state topic,
+// after the Home Assistant discovery config of the weight, body fat and BMI sensors.
+type mqttSink struct {
+    config *MQTTConfig
+}
+
+func (s *mqttSink) Name() string {
+    return "mqtt"
+}
+
+func (s *mqttSink) Send(profile *Profile, innerscan *healthplanet.Innerscan, data []*healthplanet.InnerscanData) error {
+    opts, err := s.config.options()
+    if err != nil {
+        return err
+    }
+    c, err := mqtt.Dial(opts)
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+
+    stateTopic := s.config.stateTopic(profile)
+    if s.config.discovery() {
+        for _, d := range discoveryConfigs(s.config, profile, stateTopic, data[len(data)-1].Model) {
+            // discovery config is always retained so that Home Assistant finds it after a restart
+            if err := c.Publish(d.topic, d.payload, s.config.qos(), true); err != nil {
+                return fmt.Errorf("failed to publish discovery config to %s: %w", d.topic, err)
+            }
+        }
+    }
+    for _, d := range data {
+        payload, err := json.Marshal(d)
+        if err != nil {
+            return err
+        }
+        if err := c.Publish(stateTopic, payload, s.config.qos(), s.config.retain()); err != nil {
+            return fmt.Errorf("failed to publish to %s: %w", stateTopic, err)
+        }
+    }
+    return nil
+}
+
+// haSensor is the discovery config of a Home Assistant MQTT sensor.
+type haSensor struct {
+    Name string `json:"name"`
+    UniqueID string `json:"unique_id"`
+    StateTopic string `json:"state_topic"`
+    ValueTemplate string `json:"value_template"`
+    JsonAttributesTopic string `json:"json_attributes_topic,omitempty"`
+    Unit string `json:"unit_of_measurement,omitempty"`
+    DeviceClass string `json:"device_class,omitempty"`
+    StateClass string `json:"state_class"`
+    Icon string `json:"icon,omitempty"`
+    Device haDevice `json:"device"`
+}
+
+type haDevice struct {
+    Identifiers []string `json:"identifiers"`
+    Name string `json:"name"`
+    Manufacturer string `json:"manufacturer"`
+    Model string `json:"model,omitempty"`
+}
+
+type discoveryMessage struct {
+    topic string
+    payload []byte
+}
+
+var discoveryIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// discoveryConfigs returns the discovery messages of the sensors of the profile.
+// The topics are <prefix>/sensor/tanita2csv_<profile>/<sensor>/config.
+func discoveryConfigs(config *MQTTConfig, profile *Profile, stateTopic string, model string) []discoveryMessage {
+    prefix := config.DiscoveryPrefix
+    if prefix == "" {
+        prefix = DefaultDiscoveryPrefix
+    }
+    nodeID := AppName + "_" + discoveryIDChars.ReplaceAllString(profileLabel(profile), "_")
+    device := haDevice{
+        Identifiers: []string{nodeID},
+        Name: "Tanita (" + profileLabel(profile) + ")",
+        Manufacturer: "TANITA",
+        Model: model,
+    }
+    sensors := []struct {
+        id string
+        sensor haSensor
+    }{
+        {"weight", haSensor{Name: "Weight", Unit: "kg", DeviceClass: "weight", JsonAttributesTopic: stateTopic}},
+        {"body_fat", haSensor{Name: "Body fat", Unit: "%", Icon: "mdi:percent"}},
+        {"bmi", haSensor{Name: "BMI", Icon: "mdi:human"}},
+    }
+
+    messages := make([]discoveryMessage, 0, len(sensors))
+    for _, s := range sensors {
+        s.sensor.UniqueID = nodeID + "_" + s.id
+        s.sensor.StateTopic = stateTopic
+        s.sensor.ValueTemplate = "{{ value_json." + s.id + " }}"
+        s.sensor.StateClass = "measurement"
+        s.sensor.Device = device
+        payload, _ := json.Marshal(s.sensor)
+        messages = append(messages, discoveryMessage{
+            topic: fmt.Sprintf("%s/sensor/%s/%s/config", prefix, nodeID, s.id),
+            payload: payload,
+        })
+    }
+    return messages
+}
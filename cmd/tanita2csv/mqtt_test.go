@@ -0,0 +1,168 @@
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "log/slog"
+    "path/filepath"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+    "github.com/kamaboko123/tanita2csv/pkg/mqtt/mqtttest"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newTestBroker(t *testing.T) *mqtttest.Broker {
+    t.Helper()
+    b, err := mqtttest.NewBroker("user", "pass")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { b.Close() })
+    return b
+}
+
+// testData returns a measurement per day from 2025-04-01, with the weights.
+func testData(weights ...float64) []*healthplanet.InnerscanData {
+    data := make([]*healthplanet.InnerscanData, len(weights))
+    start := time.Date(2025, 4, 1, 7, 30, 0, 0, time.UTC)
+    for i, w := range weights {
+        data[i] = &healthplanet.InnerscanData{Date: start.AddDate(0, 0, i), Model: "01000117", Weight: w, BodyFat: 20.5, BMI: 22.4}
+    }
+    return data
+}
+
+func TestMQTTSinkDiscovery(t *testing.T) {
+    b := newTestBroker(t)
+    config := &MQTTConfig{Broker: b.URL(), Username: "user", Password: "pass"}
+    profile := &Profile{Name: "alice"}
+    data := testData(66.4, 66.2)
+
+    sink := &mqttSink{config: config}
+    if err := sink.Send(profile, &healthplanet.Innerscan{Data: data}, data); err != nil {
+        t.Fatal(err)
+    }
+
+    retained := b.Retained()
+    for _, id := range []string{"weight", "body_fat", "bmi"} {
+        topic := "homeassistant/sensor/tanita2csv_alice/" + id + "/config"
+        m, ok := retained[topic]
+        if !ok {
+            t.Errorf("no retained discovery config on %s", topic)
+            continue
+        }
+        var sensor haSensor
+        if err := json.Unmarshal([]byte(m.Payload), &sensor); err != nil {
+            t.Fatalf("invalid discovery config on %s: %v", topic, err)
+        }
+        if sensor.StateTopic != "tanita2csv/alice/state" || sensor.ValueTemplate != "{{ value_json." + id + " }}" {
+            t.Errorf("%s: state_topic = %q, value_template = %q", topic, sensor.StateTopic, sensor.ValueTemplate)
+        }
+        if sensor.UniqueID != "tanita2csv_alice_" + id || sensor.StateClass != "measurement" {
+            t.Errorf("%s: unique_id = %q, state_class = %q", topic, sensor.UniqueID, sensor.StateClass)
+        }
+        if sensor.Device.Identifiers[0] != "tanita2csv_alice" || sensor.Device.Model != "01000117" {
+            t.Errorf("%s: device = %+v", topic, sensor.Device)
+        }
+    }
+    if sensor := retained["homeassistant/sensor/tanita2csv_alice/weight/config"]; sensor != nil {
+        var weight haSensor
+        json.Unmarshal([]byte(sensor.Payload), &weight)
+        if weight.Unit != "kg" || weight.DeviceClass != "weight" {
+            t.Errorf("weight sensor: unit = %q, device_class = %q", weight.Unit, weight.DeviceClass)
+        }
+    }
+
+    // each measurement in order on the state topic, the last one retained
+    var states []string
+    for _, m := range b.Messages() {
+        if m.Topic == "tanita2csv/alice/state" {
+            if m.QoS != 1 || !m.Retain {
+                t.Errorf("state published with QoS %d retain %v, want QoS 1 retained", m.QoS, m.Retain)
+            }
+            states = append(states, m.Payload)
+        }
+    }
+    if len(states) != 2 {
+        t.Fatalf("published %d states, want 2", len(states))
+    }
+    var last healthplanet.InnerscanData
+    if err := json.Unmarshal([]byte(retained["tanita2csv/alice/state"].Payload), &last); err != nil || last.Weight != 66.2 {
+        t.Errorf("retained state = %s, want the weight 66.2", retained["tanita2csv/alice/state"].Payload)
+    }
+}
+
+func TestMQTTSinkWithoutDiscovery(t *testing.T) {
+    b := newTestBroker(t)
+    off := false
+    qos := 0
+    config := &MQTTConfig{Broker: b.URL(), Username: "user", Password: "pass", Discovery: &off, QoS: &qos, Retain: &off, Topic: "home/{profile}/scale"}
+    data := testData(66.4)
+
+    sink := &mqttSink{config: config}
+    if err := sink.Send(&Profile{Name: DefaultProfile}, &healthplanet.Innerscan{Data: data}, data); err != nil {
+        t.Fatal(err)
+    }
+    // QoS 0 is not acknowledged, so wait for the broker to handle it
+    deadline := time.Now().Add(2 * time.Second)
+    for len(b.Messages()) == 0 && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+    messages := b.Messages()
+    if len(messages) != 1 || messages[0].Topic != "home/default/scale" || messages[0].QoS != 0 || messages[0].Retain {
+        t.Errorf("messages = %+v, want one QoS 0 message on home/default/scale", messages)
+    }
+}
+
+// stateCount returns the number of the messages published to the state topic of the default profile.
+func stateCount(b *mqtttest.Broker) int {
+    n := 0
+    for _, m := range b.Messages() {
+        if m.Topic == "tanita2csv/default/state" {
+            n++
+        }
+    }
+    return n
+}
+
+func TestDeliver(t *testing.T) {
+    b := newTestBroker(t)
+    r := &Runner{
+        config: &Config{MQTT: MQTTConfig{Broker: b.URL(), Username: "user", Password: "pass"}},
+        option: &RunOption{},
+    }
+    profile := &Profile{Name: DefaultProfile, ArchiveFile: filepath.Join(t.TempDir(), "archive.jsonl"), Garmin: &GarminConfig{}}
+
+    // the first run sends only the latest measurement instead of the history
+    data := testData(66.4, 66.2, 66.0)
+    r.deliver(profile, &healthplanet.Innerscan{Data: data}, discardLogger)
+    if n := stateCount(b); n != 1 {
+        t.Fatalf("first run published %d states, want 1", n)
+    }
+
+    // a measurement is sent once, and again if its values change
+    data = testData(66.4, 66.2, 66.0, 65.8)
+    r.deliver(profile, &healthplanet.Innerscan{Data: data}, discardLogger)
+    r.deliver(profile, &healthplanet.Innerscan{Data: data}, discardLogger)
+    if n := stateCount(b); n != 2 {
+        t.Fatalf("published %d states after the new measurement, want 2", n)
+    }
+    data[0].Weight = 66.5
+    r.deliver(profile, &healthplanet.Innerscan{Data: data}, discardLogger)
+    if n := stateCount(b); n != 3 {
+        t.Fatalf("published %d states after the change, want 3", n)
+    }
+
+    // a failed delivery is retried by the next run
+    b.Close()
+    data = testData(66.4, 66.2, 66.0, 65.8, 65.6)
+    data[0].Weight = 66.5
+    r.deliver(profile, &healthplanet.Innerscan{Data: data}, discardLogger)
+    retry := newTestBroker(t)
+    r.config.MQTT.Broker = retry.URL()
+    r.deliver(profile, &healthplanet.Innerscan{Data: data}, discardLogger)
+    if n := stateCount(retry); n != 1 {
+        t.Errorf("retry published %d states, want 1", n)
+    }
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/archive"
+    "github.com/kamaboko123/tanita2csv/pkg/garmin/garmintest"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// markedRunner returns a runner of -outliers mark on an archive, where a kid stepped on the scale
+// after the real weigh-in of the first day and after the last one.
+func markedRunner(t *testing.T, config *Config) (*Runner, *Profile) {
+    t.Helper()
+    dir := t.TempDir()
+    profile := &Profile{Name: DefaultProfile, ArchiveFile: filepath.Join(dir, "archive.jsonl"), MinWeight: 50, Garmin: &GarminConfig{}}
+    data := testData(66.4, 66.2, 66.0)
+    data = append(data,
+        &healthplanet.InnerscanData{Date: data[0].Date.Add(time.Hour), Model: "01000117", Weight: 33.0, BodyFat: 20.5, BMI: 11.2},
+        &healthplanet.InnerscanData{Date: data[2].Date.Add(time.Hour), Model: "01000117", Weight: 33.1, BodyFat: 20.5, BMI: 11.2})
+    if _, err := archive.Open(profile.ArchiveFile).Append(&healthplanet.Innerscan{Data: data}, "api"); err != nil {
+        t.Fatal(err)
+    }
+    r := &Runner{
+        config: config,
+        option: &RunOption{
+            source: "archive",
+            format: "csv",
+            weightUnit: "kg",
+            outliers: "mark",
+            from: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+            to: time.Date(2025, 4, 3, 23, 59, 59, 0, time.UTC),
+        },
+        outputLoc: time.UTC,
+        logger: discardLogger,
+    }
+    return r, profile
+}
+
+// TestDumpMarkedOutliers checks that the real weigh-in of the day is kept over a later outlier.
+func TestDumpMarkedOutliers(t *testing.T) {
+    r, profile := markedRunner(t, &Config{})
+    output := filepath.Join(t.TempDir(), "dump.csv")
+    if _, code := r.dump(profile, output, discardLogger); code != 0 {
+        t.Fatalf("dump failed with %d", code)
+    }
+    content, err := os.ReadFile(output)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, row := range []string{"2025-04-01,66.400000,", "2025-04-02,66.200000,", "2025-04-03,66.000000,"} {
+        if !strings.Contains(string(content), "\n" + row) {
+            t.Errorf("no row %q in:\n%s", row, content)
+        }
+    }
+    if strings.Contains(string(content), "33.0") || strings.Contains(string(content), "33.1") {
+        t.Errorf("the outliers replace the real weigh-ins:\n%s", content)
+    }
+}
+
+func TestDeliverMarkedOutliers(t *testing.T) {
+    s, requests := newTestReceiver(t, http.StatusNoContent)
+    r := &Runner{config: &Config{Webhooks: []*WebhookConfig{{URL: s.URL}}}, option: &RunOption{}}
+    profile := &Profile{Name: DefaultProfile, ArchiveFile: filepath.Join(t.TempDir(), "archive.jsonl"), Garmin: &GarminConfig{}}
+
+    data := testData(66.4, 66.2, 33.0, 33.1)
+    for _, d := range data {
+        d.Outlier = &healthplanet.OutlierMark{Outlier: d.Weight < 50}
+    }
+    // the first run sends the latest measurement which is not an outlier
+    r.deliver(profile, &healthplanet.Innerscan{Data: data[:3]}, discardLogger)
+    // a new outlier is not sent
+    r.deliver(profile, &healthplanet.Innerscan{Data: data}, discardLogger)
+
+    got := requests()
+    if len(got) != 1 || !strings.Contains(got[0].body, `"weight":66.2`) {
+        t.Errorf("requests = %+v, want only the weight 66.2", got)
+    }
+}
+
+func TestPublishMarkedOutliers(t *testing.T) {
+    s, requests := newTestReceiver(t, http.StatusNoContent)
+    r, profile := markedRunner(t, &Config{Webhooks: []*WebhookConfig{{URL: s.URL}}})
+    if code := r.runPublish(profile, discardLogger); code != 0 {
+        t.Fatalf("publish failed with %d", code)
+    }
+    got := requests()
+    if len(got) != 1 {
+        t.Fatalf("got %d requests, want 1", len(got))
+    }
+    var event struct {
+        Measurement *healthplanet.InnerscanData `json:"measurement"`
+    }
+    if err := json.Unmarshal([]byte(got[0].body), &event); err != nil || event.Measurement == nil || event.Measurement.Weight != 66.0 {
+        t.Errorf("published %s, want the latest weigh-in 66.0", got[0].body)
+    }
+}
+
+func TestUploadMarkedOutliers(t *testing.T) {
+    g := garmintest.NewServer("user", "pass")
+    defer g.Close()
+    config := &GarminConfig{UploadURL: g.UploadURL(), LoginURL: g.LoginURL(), Username: "user", Password: "pass", StateFile: filepath.Join(t.TempDir(), "garmin.json")}
+    r, profile := markedRunner(t, &Config{})
+    profile.Garmin = config
+
+    if code := r.runUpload(profile, discardLogger); code != 0 {
+        t.Fatalf("upload failed with %d", code)
+    }
+    uploads := g.Uploads()
+    if len(uploads) != 1 || uploads[0].Days != 3 {
+        t.Fatalf("uploads = %+v, want 3 days", uploads)
+    }
+    if strings.Contains(uploads[0].Content, "33.") || !strings.Contains(uploads[0].Content, "66.4") {
+        t.Errorf("uploaded the outliers:\n%s", uploads[0].Content)
+    }
+}
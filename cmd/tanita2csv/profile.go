@@ -0,0 +1,175 @@
+package main
+
+import (
+    "fmt"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/analytics"
+)
+
+// Profile is the settings of a HealthPlanet account.
+// Empty client_id and client_secret are inherited from the top level of the config,
+// which allows several accounts to share one registered application.
+// The weight bounds, the goals and the Garmin account are not inherited, as they are of each person.
+type Profile struct {
+    Name string `yaml:"-"`
+    ClientID string `yaml:"client_id"`
+    ClientSecret string `yaml:"client_secret"`
+    TokenFile string `yaml:"token_file"`
+    Output string `yaml:"output"`
+    ArchiveFile string `yaml:"archive_file"`
+    MinWeight float64 `yaml:"min_weight"`
+    MaxWeight float64 `yaml:"max_weight"`
+    GoalWeight float64 `yaml:"goal_weight"`
+    GoalBodyFat float64 `yaml:"goal_body_fat"`
+    GoalDate string `yaml:"goal_date"`
+    Garmin *GarminConfig `yaml:"garmin"`
+}
+
+// DefaultProfile is the name used for the top level settings of the config.
+const DefaultProfile = ""
+
+// ProfileNames returns the names of the profiles in the config in sorted order.
+func (c *Config) ProfileNames() []string {
+    names := make([]string, 0, len(c.Profiles))
+    for name := range c.Profiles {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// Profile returns the effective settings of the profile.
+// DefaultProfile returns the top level settings.
+func (c *Config) Profile(name string) (*Profile, error) {
+    if name == DefaultProfile {
+        return &Profile{
+            Name: DefaultProfile,
+            ClientID: c.ClientID,
+            ClientSecret: c.ClientSecret,
+            TokenFile: c.TokenFile,
+            Output: c.Output,
+            ArchiveFile: c.ArchiveFile,
+            MinWeight: c.MinWeight,
+            MaxWeight: c.MaxWeight,
+            GoalWeight: c.GoalWeight,
+            GoalBodyFat: c.GoalBodyFat,
+            GoalDate: c.GoalDate,
+            Garmin: &c.Garmin,
+        }, nil
+    }
+
+    p, ok := c.Profiles[name]
+    if !ok {
+        return nil, fmt.Errorf("profile %q is not defined in the config (defined: %s)", name, strings.Join(c.ProfileNames(), ", "))
+    }
+    profile := *p
+    profile.Name = name
+    if profile.ClientID == "" {
+        profile.ClientID = c.ClientID
+    }
+    if profile.ClientSecret == "" {
+        profile.ClientSecret = c.ClientSecret
+    }
+    if profile.TokenFile == "" {
+        profile.TokenFile = filepath.Join(StateDir(), "token-"+name+".json")
+    }
+    if profile.ArchiveFile == "" {
+        profile.ArchiveFile = filepath.Join(StateDir(), "archive-"+name+".jsonl")
+    }
+    return &profile, nil
+}
+
+// resolveProfiles resolves the relative paths of the profiles against the config file's directory.
+func (c *Config) resolveProfiles() {
+    for name, p := range c.Profiles {
+        if p == nil {
+            p = &Profile{}
+            c.Profiles[name] = p
+        }
+        p.TokenFile = c.resolvePath(p.TokenFile)
+        p.Output = c.resolvePath(p.Output)
+        p.ArchiveFile = c.resolvePath(p.ArchiveFile)
+        if p.Garmin != nil {
+            p.Garmin.StateFile = c.resolvePath(p.Garmin.StateFile)
+        }
+    }
+}
+
+func (c *Config) validateProfiles() []ConfigProblem {
+    var problems []ConfigProblem
+    for _, name := range c.ProfileNames() {
+        key := "profiles." + name
+        if name == "" || strings.ContainsAny(name, `/\`) {
+            problems = append(problems, c.problem(key, "invalid profile name %q", name))
+            continue
+        }
+        p := c.Profiles[name]
+        problems = append(problems, c.checkInherited(key+".client_id", p.ClientID, "client_id", c.ClientID)...)
+        problems = append(problems, c.checkInherited(key+".client_secret", p.ClientSecret, "client_secret", c.ClientSecret)...)
+
+        profile, _ := c.Profile(name)
+        problems = append(problems, c.checkWritable(key+".token_file", profile.TokenFile)...)
+        problems = append(problems, c.checkWritable(key+".archive_file", profile.ArchiveFile)...)
+        problems = append(problems, c.checkWeightBounds(key+".", p.MinWeight, p.MaxWeight)...)
+        problems = append(problems, c.checkGoals(key+".", p.GoalWeight, p.GoalBodyFat, p.GoalDate)...)
+        problems = append(problems, c.validateGarmin(key+".garmin.", p.Garmin, name)...)
+    }
+    return problems
+}
+
+// checkInherited checks a profile value which falls back to the top level value if not set.
+func (c *Config) checkInherited(key string, value string, parentKey string, parentValue string) []ConfigProblem {
+    if value != "" {
+        return c.checkRequired(key, value)
+    }
+    if parentValue == "" {
+        return []ConfigProblem{c.problem(key, "required but not set in the profile nor as %s at the top level", parentKey)}
+    }
+    return nil
+}
+
+// Goals returns the goals of the profile, with the target date in loc.
+func (p *Profile) Goals(loc *time.Location) ([]analytics.Goal, error) {
+    var date time.Time
+    if p.GoalDate != "" {
+        var err error
+        date, err = time.ParseInLocation("2006-01-02", p.GoalDate, loc)
+        if err != nil {
+            return nil, fmt.Errorf("invalid goal_date: %w", err)
+        }
+    }
+    goals := make([]analytics.Goal, 0, 2)
+    if p.GoalWeight > 0 {
+        goals = append(goals, analytics.Goal{Metric: analytics.GoalWeight, Target: p.GoalWeight, Date: date})
+    }
+    if p.GoalBodyFat > 0 {
+        goals = append(goals, analytics.Goal{Metric: analytics.GoalBodyFat, Target: p.GoalBodyFat, Date: date})
+    }
+    return goals, nil
+}
+
+// outputPath returns the output file of the profile.
+// -o takes precedence over the config. When several profiles are exported at once,
+// -o is used as a template: "{profile}" is replaced with the profile name,
+// or the name is appended to the file name if there is no placeholder.
+// Without -o nor the output of the profile, the profile name with the extension of the format is used.
+func (p *Profile) outputPath(output string, multi bool, format string) string {
+    if output == "" {
+        output = p.Output
+        if output != "" || !multi {
+            return output
+        }
+        return p.Name + formatExtension(format)
+    }
+    if !multi {
+        return output
+    }
+    if strings.Contains(output, "{profile}") {
+        return strings.ReplaceAll(output, "{profile}", p.Name)
+    }
+    ext := filepath.Ext(output)
+    return strings.TrimSuffix(output, ext) + "-" + p.Name + ext
+}
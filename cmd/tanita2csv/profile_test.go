@@ -0,0 +1,36 @@
+package main
+
+import (
+    "testing"
+)
+
+func TestOutputPath(t *testing.T) {
+    tests := []struct {
+        profileOutput string
+        output string
+        multi bool
+        format string
+        want string
+    }{
+        // a single profile writes to stdout by default
+        {"", "", false, "csv", ""},
+        {"kid.csv", "", false, "csv", "kid.csv"},
+        {"kid.csv", "out.csv", false, "csv", "out.csv"},
+        // several profiles write to <profile> with the extension of the format by default
+        {"", "", true, "csv", "kid.csv"},
+        {"", "", true, "json", "kid.json"},
+        {"", "", true, "fitbit", "kid.csv"},
+        {"", "", true, "withings", "kid.csv"},
+        {"", "", true, "apple-health", "kid.xml"},
+        {"own.json", "", true, "json", "own.json"},
+        // -o is a template
+        {"", "out/{profile}.json", true, "json", "out/kid.json"},
+        {"", "out/body.xml", true, "apple-health", "out/body-kid.xml"},
+    }
+    for _, tt := range tests {
+        p := &Profile{Name: "kid", Output: tt.profileOutput}
+        if got := p.outputPath(tt.output, tt.multi, tt.format); got != tt.want {
+            t.Errorf("outputPath(%q, %v, %q) with output %q = %q, want %q", tt.output, tt.multi, tt.format, tt.profileOutput, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+    "log/slog"
+    "path/filepath"
+    "strings"
+    "github.com/kamaboko123/tanita2csv/pkg/report"
+)
+
+// runReport writes the report of the period as one HTML file (default), or the charts as SVG files.
+// The SVG files are named after -o with the chart, e.g. -o charts.svg writes charts-weight.svg and charts-body_fat.svg.
+func (r *Runner) runReport(profile *Profile, logger *slog.Logger) int {
+    innerscan, code := r.fetchFiltered(profile, logger)
+    if code != 0 {
+        return code
+    }
+    innerscan = innerscan.UniqByDay()
+    smaDays := r.option.trendOptions.SMADays
+
+    if r.option.format == "svg" {
+        output := r.reportPath(profile)
+        ext := filepath.Ext(output)
+        base := strings.TrimSuffix(output, ext)
+        if ext == "" {
+            ext = ".svg"
+        }
+        for _, s := range report.Charts(innerscan, smaDays) {
+            code = r.writeOutput(base + "-" + s.Name + ext, s.SVG(), logger)
+            if code != 0 {
+                return code
+            }
+        }
+        return 0
+    }
+
+    content, err := report.HTML(innerscan, report.Options{
+        Title: profileLabel(profile),
+        From: r.option.from,
+        To: r.option.to,
+        Group: r.option.group,
+        SMADays: smaDays,
+    })
+    if err != nil {
+        logger.Error("Failed to make report", "error", err)
+        return 1
+    }
+    return r.writeOutput(r.reportPath(profile), content, logger)
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+    "fmt"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/analytics"
+    "github.com/kamaboko123/tanita2csv/pkg/archive"
+    "github.com/kamaboko123/tanita2csv/pkg/export"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// Runner runs the mode for each profile, holding what is shared between the runs.
+type Runner struct {
+    config *Config
+    option *RunOption
+    logger *slog.Logger
+
+    apiLoc *time.Location
+    queryLoc *time.Location
+    outputLoc *time.Location
+}
+
+// Run runs the mode for the selected profiles and returns the exit code of the last failure.
+func (r *Runner) Run() int {
+    names := []string{r.option.profile}
+    if r.option.allProfiles {
+        names = r.config.ProfileNames()
+        if len(names) == 0 {
+            r.logger.Error("No profiles are defined in the config")
+            return 1
+        }
+    }
+
+    profiles := make([]*Profile, 0, len(names))
+    for _, name := range names {
+        profile, err := r.config.Profile(name)
+        if err != nil {
+            r.logger.Error("Failed to load profile", "error", err)
+            return 1
+        }
+        profiles = append(profiles, profile)
+    }
+
+    // the servers and the daemon run for all profiles at once
+    switch r.option.mode {
+    case "serve-metrics":
+        return r.runServeMetrics(profiles)
+    case "serve":
+        return r.runServe(profiles)
+    case "dashboard":
+        return r.runDashboard(profiles)
+    case "daemon":
+        return r.runDaemon(profiles)
+    }
+
+    exitCode := 0
+    for _, profile := range profiles {
+        logger := r.logger
+        if profile.Name != DefaultProfile {
+            logger = r.logger.With("profile", profile.Name)
+        }
+
+        var code int
+        switch r.option.mode {
+        case "auth":
+            code = r.runAuth(profile, logger)
+        case "dump":
+            code = r.runDump(profile, logger)
+        case "import":
+            code = r.runImport(profile, logger)
+        case "merge":
+            code = r.runMerge(profile, logger)
+        case "diff":
+            code = r.runDiff(profile, logger)
+        case "trend":
+            code = r.runTrend(profile, logger)
+        case "summary":
+            code = r.runSummary(profile, logger)
+        case "goal":
+            code = r.runGoal(profile, logger)
+        case "gaps":
+            code = r.runGaps(profile, logger)
+        case "report":
+            code = r.runReport(profile, logger)
+        case "influx":
+            code = r.runInflux(profile, logger)
+        case "publish":
+            code = r.runPublish(profile, logger)
+        case "upload":
+            code = r.runUpload(profile, logger)
+        }
+        if code != 0 {
+            exitCode = code
+        }
+    }
+    return exitCode
+}
+
+func (r *Runner) runAuth(profile *Profile, logger *slog.Logger) int {
+    // Initialize HealthPlanet Auth
+    auth := healthplanet.NewSimpleAuth(r.config.URL, profile.ClientID, profile.ClientSecret, profile.TokenFile, logger)
+
+    logger.Info("Starting authentication process")
+    if profile.Name != DefaultProfile {
+        fmt.Printf("Authenticate profile %q\n", profile.Name)
+    }
+    err := auth.Auth()
+    if err != nil {
+        logger.Error("Failed to authenticate with HealthPlanet, abort.", "error", err)
+        return 10
+    }
+    logger.Info("Authentication successful, token file created", "token_file", profile.TokenFile)
+    return 0
+}
+
+// newClient returns a HealthPlanet client with a refreshed token.
+func (r *Runner) newClient(profile *Profile, logger *slog.Logger) (*healthplanet.Client, int) {
+    // check token file existence
+    _, err := os.Stat(profile.TokenFile); if err != nil {
+        logger.Warn("Token file does not exist, please run in auth mode first.", "error", err)
+        return nil, 1
+    }
+
+    // Initialize HealthPlanet Auth
+    auth := healthplanet.NewSimpleAuth(r.config.URL, profile.ClientID, profile.ClientSecret, profile.TokenFile, logger)
+
+    err = auth.RefreshToken()
+    if err != nil {
+        logger.Error("Failed to refresh token, abort. Please reauthenticate with auth mode.", "error", err)
+        return nil, 11
+    }
+
+    // Init HealthPlanet Client
+    hpClient := healthplanet.NewClient(r.config.URL, auth, logger)
+    hpClient.APILocation = r.apiLoc
+    hpClient.Location = r.outputLoc
+    return hpClient, 0
+}
+
+// fetch returns all measurements in the period given by the flags from the source.
+func (r *Runner) fetch(profile *Profile, logger *slog.Logger) (*healthplanet.Innerscan, int) {
+    return r.fetchPeriod(profile, r.option.from, r.option.to, logger)
+}
+
+// fetchPeriod returns all measurements between from and to from the source.
+// Measurements fetched from HealthPlanet are also appended to the archive.
+func (r *Runner) fetchPeriod(profile *Profile, from time.Time, to time.Time, logger *slog.Logger) (*healthplanet.Innerscan, int) {
+    if r.option.source == "archive" {
+        a := archive.Open(profile.ArchiveFile)
+        innerscan, err := a.Innerscan(from, to, r.outputLoc)
+        if err != nil {
+            logger.Error("Failed to read archive", "archive_file", a.Path, "error", err)
+            return nil, 1
+        }
+        logger.Info("Successfully read archive", "archive_file", a.Path, "data_count", len(innerscan.Data))
+        return innerscan, 0
+    }
+
+    innerscan, code := r.fetchAPI(profile, from, to, logger)
+    if code != 0 {
+        return nil, code
+    }
+    r.archiveFetched(profile, innerscan, logger)
+    return innerscan, 0
+}
+
+// fetchAPI returns all measurements between from and to from HealthPlanet, without archiving them.
+func (r *Runner) fetchAPI(profile *Profile, from time.Time, to time.Time, logger *slog.Logger) (*healthplanet.Innerscan, int) {
+    hpClient, code := r.newClient(profile, logger)
+    if code != 0 {
+        return nil, code
+    }
+
+    // Get Innerscan Data
+    // Note: a period longer than 3 months is split into multiple requests by the client.
+    innerscan, err := hpClient.GetInnerscanMeasurements(from, to)
+    if err != nil {
+        logger.Error("Failed to get Innerscan data", "error", err)
+        return nil, 1
+    }
+    logger.Info("Successfully retrieved Innerscan data", "data_count", len(innerscan.Data))
+    return innerscan, 0
+}
+
+// archiveFetched appends the measurements fetched from HealthPlanet to the archive of the profile.
+// Failing to archive does not prevent the export, so it is only logged.
+func (r *Runner) archiveFetched(profile *Profile, innerscan *healthplanet.Innerscan, logger *slog.Logger) {
+    a := archive.Open(profile.ArchiveFile)
+    added, err := a.Append(innerscan, "api")
+    if err != nil {
+        logger.Warn("Failed to archive Innerscan data", "archive_file", a.Path, "error", err)
+    } else {
+        logger.Info("Archived Innerscan data", "archive_file", a.Path, "new_count", len(added))
+    }
+}
+
+// fetchFiltered returns the measurements like fetch, applying the outlier filter given by -outliers.
+// The filter works on all measurements before they are unified per day,
+// so that a bogus weigh-in does not replace the real one of the day.
+func (r *Runner) fetchFiltered(profile *Profile, logger *slog.Logger) (*healthplanet.Innerscan, int) {
+    innerscan, code := r.fetch(profile, logger)
+    if code != 0 || r.option.outliers == "" {
+        return innerscan, code
+    }
+
+    opts := r.option.outlierOptions
+    opts.MinWeight = profile.MinWeight
+    opts.MaxWeight = profile.MaxWeight
+
+    if r.option.outliers == "mark" {
+        outliers := analytics.MarkOutliers(innerscan, opts)
+        logger.Info("Marked outliers", "outlier_count", len(outliers))
+        return innerscan, 0
+    }
+
+    filtered, outliers := analytics.FilterOutliers(innerscan, opts)
+    for _, o := range outliers {
+        logger.Warn("Dropped outlier", "date", o.Data.Date, "weight", o.Data.Weight, "reason", o.Reason)
+    }
+    if r.option.outliers == "reject" {
+        rejects := profile.outputPath(r.option.rejects, r.option.allProfiles, "csv")
+        code = r.writeOutput(rejects, analytics.OutliersCsv(outliers), logger)
+        if code != 0 {
+            return nil, code
+        }
+    }
+    return filtered, 0
+}
+
+// writeOutput writes the content to the output file, or to stdout if output is empty.
+func (r *Runner) writeOutput(output string, content string, logger *slog.Logger) int {
+    if output == "" {
+        // Print to stdout
+        fmt.Print(content)
+        return 0
+    }
+
+    // Write to output file
+    err := os.MkdirAll(filepath.Dir(output), 0755)
+    if err != nil {
+        logger.Error("Failed to create output directory", "error", err)
+        return 1
+    }
+    file, err := os.Create(output)
+    if err != nil {
+        logger.Error("Failed to create output file", "error", err)
+        return 1
+    }
+    defer file.Close()
+    _, err = file.WriteString(content)
+    if err != nil {
+        logger.Error("Failed to write to output file", "error", err)
+        return 1
+    }
+    logger.Info("Data written to output file", "output_file", output)
+    return 0
+}
+
+func (r *Runner) runDump(profile *Profile, logger *slog.Logger) int {
+    _, code := r.dump(profile, profile.outputPath(r.option.output, r.option.allProfiles, r.option.format), logger)
+    return code
+}
+
+// dump writes the measurements of the period to the output, and returns the written data.
+func (r *Runner) dump(profile *Profile, output string, logger *slog.Logger) (*healthplanet.Innerscan, int) {
+    innerscan, code := r.fetchFiltered(profile, logger)
+    if code != 0 {
+        return nil, code
+    }
+    if r.option.source == "api" {
+        r.deliver(profile, innerscan, logger)
+    }
+    // withings and apple-health have every measurement, fitbit is unified per day by formatData
+    if r.option.format != "withings" && r.option.format != "apple-health" {
+        innerscan = innerscan.UniqByDay()
+    }
+    if r.option.fill != "" {
+        filled, err := analytics.Resample(innerscan, r.option.fill)
+        if err != nil {
+            logger.Error("Failed to fill missing days", "error", err)
+            return nil, 1
+        }
+        logger.Info("Filled missing days", "method", r.option.fill, "filled_count", len(filled.Data) - len(innerscan.Data))
+        innerscan = filled
+    }
+    if r.option.trend {
+        analytics.ApplyTrend(innerscan, r.option.trendOptions)
+    }
+
+    return innerscan, r.writeData(output, innerscan, logger)
+}
+
+// formatExtension returns the file extension of the output format.
+func formatExtension(format string) string {
+    switch format {
+    case "json":
+        return ".json"
+    case "apple-health":
+        return ".xml"
+    default:
+        return ".csv"
+    }
+}
+
+// formatData converts the data into the output format: csv (default, with the preamble), json,
+// or the import format of fitbit, withings or apple-health with the weight in -weight-unit.
+// The derived metrics are added if -metrics is given, which is not allowed with the import formats (checkExportFormat).
+func (r *Runner) formatData(innerscan *healthplanet.Innerscan) (string, error) {
+    if r.option.metrics {
+        innerscan.CalcMetrics()
+    }
+    switch r.option.format {
+    case "json":
+        return innerscan.ToJson()
+    case "fitbit":
+        return export.FitbitCsv(innerscan.UniqByDay(), r.option.weightUnit), nil
+    case "withings":
+        return export.WithingsCsv(innerscan, r.option.weightUnit), nil
+    case "apple-health":
+        return export.AppleHealthXML(innerscan, export.AppleHealthOptions{
+            Unit: r.option.weightUnit,
+            SourceVersion: Version,
+            ExportDate: time.Now().In(r.outputLoc),
+        })
+    default:
+        return healthplanet.CsvPreamble + "\n" + innerscan.ToCsv(), nil
+    }
+}
+
+// writeData writes the data in the output format.
+func (r *Runner) writeData(output string, innerscan *healthplanet.Innerscan, logger *slog.Logger) int {
+    content, err := r.formatData(innerscan)
+    if err != nil {
+        logger.Error("Failed to convert Innerscan data", "format", r.option.format, "error", err)
+        return 1
+    }
+    return r.writeOutput(output, content, logger)
+}
+
+// runTrend writes the smoothed trend of the weight in the period.
+func (r *Runner) runTrend(profile *Profile, logger *slog.Logger) int {
+    innerscan, code := r.fetchFiltered(profile, logger)
+    if code != 0 {
+        return code
+    }
+    innerscan = innerscan.UniqByDay()
+    analytics.ApplyTrend(innerscan, r.option.trendOptions)
+
+    if r.option.format == "csv" || r.option.format == "json" {
+        return r.writeData(r.reportPath(profile), innerscan, logger)
+    }
+    return r.writeOutput(r.reportPath(profile), analytics.TrendText(innerscan, r.option.trendOptions), logger)
+}
+
+// reportPath returns the output file of the modes other than dump.
+// The output of the profile is for dump, so only -o is used and the default is stdout.
+func (r *Runner) reportPath(profile *Profile) string {
+    if r.option.output == "" {
+        return ""
+    }
+    return profile.outputPath(r.option.output, r.option.allProfiles, r.option.format)
+}
+
+// runSummary writes the statistics of the period per week, month or year.
+func (r *Runner) runSummary(profile *Profile, logger *slog.Logger) int {
+    innerscan, code := r.fetchFiltered(profile, logger)
+    if code != 0 {
+        return code
+    }
+    summaries, err := analytics.Summarize(innerscan.UniqByDay(), r.option.group)
+    if err != nil {
+        logger.Error("Failed to summarize Innerscan data", "error", err)
+        return 1
+    }
+
+    var content string
+    switch r.option.format {
+    case "csv":
+        content = analytics.SummaryCsv(summaries)
+    case "json":
+        content, err = analytics.SummaryJson(summaries)
+        if err != nil {
+            logger.Error("Failed to convert summary to JSON", "error", err)
+            return 1
+        }
+    default:
+        content = analytics.SummaryText(summaries)
+    }
+    return r.writeOutput(r.reportPath(profile), content, logger)
+}
+
+// runImport imports the CSV files downloaded from the HealthPlanet website into the archive,
+// and writes them out in the same format as dump.
+func (r *Runner) runImport(profile *Profile, logger *slog.Logger) int {
+    imported := &healthplanet.Innerscan{
+        Data: make([]*healthplanet.InnerscanData, 0),
+    }
+    for _, input := range r.option.inputs {
+        file, err := os.Open(input)
+        if err != nil {
+            logger.Error("Failed to open input file", "error", err)
+            return 1
+        }
+        innerscan, err := healthplanet.ParseWebCsv(file, r.apiLoc, r.outputLoc)
+        file.Close()
+        if err != nil {
+            logger.Error("Failed to parse input file", "input_file", input, "error", err)
+            return 1
+        }
+        logger.Info("Successfully parsed input file", "input_file", input, "data_count", len(innerscan.Data))
+        imported.Data = append(imported.Data, innerscan.Data...)
+    }
+    imported.Sort()
+
+    // the website CSV has no body information, take it from the archive to calculate BMI
+    a := archive.Open(profile.ArchiveFile)
+    archived, err := a.All(r.outputLoc)
+    if err != nil {
+        logger.Error("Failed to read archive", "archive_file", a.Path, "error", err)
+        return 1
+    }
+    imported.BirthDate = archived.BirthDate
+    imported.Hight = archived.Hight
+    imported.Sex = archived.Sex
+    if imported.Hight == 0 {
+        logger.Warn("Height is unknown, BMI is not calculated. Run dump once to get the height from HealthPlanet.")
+    }
+    imported.CalcBMI()
+
+    added, err := a.Append(imported, "web-csv")
+    if err != nil {
+        logger.Error("Failed to archive imported data", "archive_file", a.Path, "error", err)
+        return 1
+    }
+    logger.Info("Archived imported data", "archive_file", a.Path, "new_count", len(added))
+
+    // the output of the profile is the dump of the API, do not overwrite it
+    return r.writeData(r.reportPath(profile), imported.UniqByDay(), logger)
+}
+
+// readCsv reads a CSV file made by dump.
+func (r *Runner) readCsv(input string) (*healthplanet.Innerscan, error) {
+    file, err := os.Open(input)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    return healthplanet.ParseCsv(file, r.outputLoc)
+}
+
+// runMerge merges the CSV files made by dump, and the data from the source if the period is given.
+// Later inputs win for the same day, and the data from the source is the last.
+func (r *Runner) runMerge(profile *Profile, logger *slog.Logger) int {
+    sources := make([]*healthplanet.MergeSource, 0, len(r.option.inputs) + 1)
+    for _, input := range r.option.inputs {
+        innerscan, err := r.readCsv(input)
+        if err != nil {
+            logger.Error("Failed to read input file", "input_file", input, "error", err)
+            return 1
+        }
+        logger.Info("Successfully read input file", "input_file", input, "data_count", len(innerscan.Data))
+        sources = append(sources, &healthplanet.MergeSource{Name: input, Innerscan: innerscan})
+    }
+    if r.option.periodGiven {
+        innerscan, code := r.fetch(profile, logger)
+        if code != 0 {
+            return code
+        }
+        sources = append(sources, &healthplanet.MergeSource{Name: r.option.source, Innerscan: innerscan})
+    }
+
+    merged, conflicts := healthplanet.Merge(sources)
+    for _, c := range conflicts {
+        logger.Warn("Conflicting values for the same day", "conflict", c.String())
+    }
+    logger.Info("Merged data", "data_count", len(merged.Data), "conflict_count", len(conflicts))
+
+    return r.writeData(r.reportPath(profile), merged, logger)
+}
+
+// runDiff compares a previous export against a fresh fetch of the same period,
+// and returns 2 if there are differences.
+func (r *Runner) runDiff(profile *Profile, logger *slog.Logger) int {
+    input := r.option.inputs[0]
+    previous, err := r.readCsv(input)
+    if err != nil {
+        logger.Error("Failed to read input file", "input_file", input, "error", err)
+        return 1
+    }
+
+    // compare the days in the previous export, unless the period is given
+    from, to := r.option.from, r.option.to
+    if !r.option.periodGiven {
+        if len(previous.Data) == 0 {
+            logger.Error("No data in the input file to decide the period, use -f, -t or -range", "input_file", input)
+            return 1
+        }
+        from = startOfDay(previous.Data[0].Date)
+        to = endOfDay(previous.Data[len(previous.Data)-1].Date)
+    }
+
+    current, code := r.fetchPeriod(profile, from, to, logger)
+    if code != 0 {
+        return code
+    }
+
+    result := healthplanet.Diff(previous, current)
+    var content string
+    switch r.option.format {
+    case "json":
+        content, err = result.ToJson()
+        if err != nil {
+            logger.Error("Failed to convert diff to JSON", "error", err)
+            return 1
+        }
+    default:
+        content = result.ToText()
+    }
+
+    code = r.writeOutput(r.option.output, content, logger)
+    if code != 0 {
+        return code
+    }
+    if result.HasDifferences() {
+        return 2
+    }
+    return 0
+}
+
+// runGoal writes the progress toward the goals of the profile by the trend of the period.
+func (r *Runner) runGoal(profile *Profile, logger *slog.Logger) int {
+    goals, err := profile.Goals(r.queryLoc)
+    if err != nil {
+        logger.Error("Failed to load goals", "error", err)
+        return 1
+    }
+    if len(goals) == 0 {
+        logger.Error("No goals are set, set goal_weight or goal_body_fat in the config")
+        return 1
+    }
+
+    innerscan, code := r.fetchFiltered(profile, logger)
+    if code != 0 {
+        return code
+    }
+    innerscan = innerscan.UniqByDay()
+
+    statuses := make([]*analytics.GoalStatus, 0, len(goals))
+    for _, goal := range goals {
+        status, err := analytics.GoalProgress(innerscan, goal, r.option.trendOptions)
+        if err != nil {
+            logger.Error("Failed to track goal", "metric", goal.Metric, "error", err)
+            return 1
+        }
+        statuses = append(statuses, status)
+    }
+
+    var content string
+    switch r.option.format {
+    case "json":
+        content, err = analytics.GoalJson(statuses)
+        if err != nil {
+            logger.Error("Failed to convert goal to JSON", "error", err)
+            return 1
+        }
+    default:
+        content = analytics.GoalText(statuses)
+    }
+    return r.writeOutput(r.reportPath(profile), content, logger)
+}
+
+// runGaps writes the days without measurements in the period.
+func (r *Runner) runGaps(profile *Profile, logger *slog.Logger) int {
+    innerscan, code := r.fetchFiltered(profile, logger)
+    if code != 0 {
+        return code
+    }
+    report := analytics.FindGaps(innerscan, r.option.from, r.option.to, r.outputLoc)
+
+    var content string
+    switch r.option.format {
+    case "json":
+        var err error
+        content, err = analytics.GapJson(report)
+        if err != nil {
+            logger.Error("Failed to convert gap report to JSON", "error", err)
+            return 1
+        }
+    default:
+        content = analytics.GapText(report)
+    }
+    return r.writeOutput(r.reportPath(profile), content, logger)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/archive"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// captureStdout returns what f prints to stdout.
+func captureStdout(t *testing.T, f func()) string {
+    t.Helper()
+    file, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer file.Close()
+    stdout := os.Stdout
+    os.Stdout = file
+    defer func() { os.Stdout = stdout }()
+    f()
+    content, err := os.ReadFile(file.Name())
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(content)
+}
+
+// TestImportMergeOutput checks that import and merge write to -o or stdout, not to the dump output of the profile.
+func TestImportMergeOutput(t *testing.T) {
+    dir := t.TempDir()
+    dumpOutput := filepath.Join(dir, "dump.csv")
+    if err := os.WriteFile(dumpOutput, []byte("dump\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    webCsv := filepath.Join(dir, "web.csv")
+    if err := os.WriteFile(webCsv, []byte("測定日時,体重(kg),体脂肪率(%)\n2025/04/01 07:30,66.40,20.5\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    exported := filepath.Join(dir, "export.csv")
+    if err := os.WriteFile(exported, []byte("Body\nDate,Weight,BMI,Fat\n2025-04-02,66.2,22.3,20.3\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        mode string
+        inputs []string
+        output string
+        day string
+    }{
+        {"import", []string{webCsv}, "", "2025-04-01"},
+        {"import", []string{webCsv}, filepath.Join(dir, "imported.csv"), "2025-04-01"},
+        {"merge", []string{exported}, "", "2025-04-02"},
+        {"merge", []string{exported}, filepath.Join(dir, "merged.csv"), "2025-04-02"},
+    }
+    for _, tt := range tests {
+        profile := &Profile{Name: DefaultProfile, Output: dumpOutput, ArchiveFile: filepath.Join(dir, "archive.jsonl"), Garmin: &GarminConfig{}}
+        r := &Runner{
+            config: &Config{},
+            option: &RunOption{mode: tt.mode, inputs: tt.inputs, output: tt.output, format: "csv", source: "archive"},
+            apiLoc: time.UTC,
+            outputLoc: time.UTC,
+            logger: discardLogger,
+        }
+        var code int
+        stdout := captureStdout(t, func() {
+            if tt.mode == "import" {
+                code = r.runImport(profile, discardLogger)
+            } else {
+                code = r.runMerge(profile, discardLogger)
+            }
+        })
+        if code != 0 {
+            t.Fatalf("%s -o %q: exit code %d", tt.mode, tt.output, code)
+        }
+
+        written := stdout
+        if tt.output != "" {
+            content, err := os.ReadFile(tt.output)
+            if err != nil {
+                t.Fatal(err)
+            }
+            written = string(content)
+        }
+        if !strings.Contains(written, tt.day) {
+            t.Errorf("%s -o %q: output does not have %s:\n%s", tt.mode, tt.output, tt.day, written)
+        }
+        if content, err := os.ReadFile(dumpOutput); err != nil || string(content) != "dump\n" {
+            t.Errorf("%s -o %q: the dump output is overwritten: %q, %v", tt.mode, tt.output, content, err)
+        }
+    }
+}
+
+// TestDiffExitCode checks that diff returns 2 if the previous export differs from the archive.
+func TestDiffExitCode(t *testing.T) {
+    dir := t.TempDir()
+    profile := &Profile{Name: DefaultProfile, ArchiveFile: filepath.Join(dir, "archive.jsonl"), Garmin: &GarminConfig{}}
+    if _, err := archive.Open(profile.ArchiveFile).Append(&healthplanet.Innerscan{Data: testData(66.4, 66.2)}, "api"); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name string
+        previous string
+        period bool // -f and -t of the two days in the archive
+        code int
+        output string
+    }{
+        {"same", "Date,Weight,BMI,Fat\n2025-04-01,66.4,22.4,20.5\n2025-04-02,66.2,22.4,20.5\n", false, 0, "0 added, 0 removed, 0 changed\n"},
+        {"filled", "Body\nDate,Weight,BMI,Fat,Synthetic\n2025-04-01,66.4,22.4,20.5,false\n2025-04-02,66.2,22.4,20.5,false\n2025-04-03,66.1,22.4,20.5,true\n", false, 0, "0 added, 0 removed, 0 changed\n"},
+        {"changed", "Date,Weight,BMI,Fat\n2025-04-01,66.4,22.4,20.5\n2025-04-02,66.3,22.4,20.5\n", false, 2, "0 added, 0 removed, 1 changed\n"},
+        {"removed", "Date,Weight,BMI,Fat\n2025-04-01,66.4,22.4,20.5\n2025-04-02,66.2,22.4,20.5\n2025-04-03,66.1,22.4,20.5\n", false, 2, "0 added, 1 removed, 0 changed\n"},
+        // only the days of the previous export are compared, unless the period is given
+        {"added", "Date,Weight,BMI,Fat\n2025-04-01,66.4,22.4,20.5\n", false, 0, "0 added, 0 removed, 0 changed\n"},
+        {"added in the period", "Date,Weight,BMI,Fat\n2025-04-01,66.4,22.4,20.5\n", true, 2, "1 added, 0 removed, 0 changed\n"},
+    }
+    for _, tt := range tests {
+        input := filepath.Join(dir, tt.name + ".csv")
+        if err := os.WriteFile(input, []byte(tt.previous), 0644); err != nil {
+            t.Fatal(err)
+        }
+        output := filepath.Join(dir, tt.name + ".diff")
+        r := &Runner{
+            config: &Config{},
+            option: &RunOption{mode: "diff", inputs: []string{input}, output: output, format: "text", source: "archive"},
+            outputLoc: time.UTC,
+            logger: discardLogger,
+        }
+        if tt.period {
+            r.option.periodGiven = true
+            r.option.from = time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+            r.option.to = time.Date(2025, 4, 2, 23, 59, 59, 0, time.UTC)
+        }
+        if code := r.runDiff(profile, discardLogger); code != tt.code {
+            t.Errorf("%s: exit code %d, want %d", tt.name, code, tt.code)
+        }
+        content, err := os.ReadFile(output)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !strings.HasSuffix(string(content), tt.output) {
+            t.Errorf("%s: output = %q, want %q at the end", tt.name, content, tt.output)
+        }
+    }
+}
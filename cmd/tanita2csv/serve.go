@@ -0,0 +1,412 @@
+package main
+
+import (
+    "context"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "os/signal"
+    "sort"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/analytics"
+    "github.com/kamaboko123/tanita2csv/pkg/archive"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+serve mode: a read-only REST API of the measurements, for tools which should not hold the HealthPlanet credentials.
+
+The responses are read from the archive of each profile, which is the on-disk cache of the previous fetches.
+With -source api (default), the measurements of the last metricsLookback are fetched from HealthPlanet every -interval
+and appended to the archive as serve-metrics does. With -source archive, the archive is served as it is,
+e.g. when it is kept up to date by dump from cron.
+
+    GET /v1/profiles
+    GET /v1/measurements?from=&to=&profile=
+    GET /v1/latest?profile=
+    GET /v1/summary?from=&to=&profile=&by=
+
+from and to take the date expressions of -f and -t (default: 90d and today).
+Every request needs one of api_keys in the config, by "Authorization: Bearer <key>" or "X-API-Key: <key>".
+The responses have ETag (hash of the body) for conditional requests, and Last-Modified (modification time of the archive)
+unless the period is relative to today, e.g. the default from=90d.
+*/
+
+const DefaultServeListen = ":9732"
+
+type apiServer struct {
+    runner *Runner
+    profiles map[string]*Profile // key: profile label
+
+    // held while appending the fetched measurements to the archives, so that a request does not read a partially written archive
+    mu sync.RWMutex
+}
+
+// runServe serves the API of the profiles until SIGINT or SIGTERM.
+func (r *Runner) runServe(profiles []*Profile) int {
+    if len(r.config.APIKeys) == 0 {
+        r.logger.Error("No API key is configured, set api_keys in the config")
+        return 1
+    }
+    s := &apiServer{runner: r, profiles: make(map[string]*Profile)}
+    for _, p := range profiles {
+        s.profiles[profileLabel(p)] = p
+    }
+
+    var poll func()
+    if r.option.source == "api" {
+        poll = s.fetchAll
+    }
+    return r.serveHTTP(s.handler(), poll)
+}
+
+// handler returns the handler of the API, with the authentication and read-only checks.
+func (s *apiServer) handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/v1/profiles", s.handleProfiles)
+    mux.HandleFunc("/v1/measurements", s.handleMeasurements)
+    mux.HandleFunc("/v1/latest", s.handleLatest)
+    mux.HandleFunc("/v1/summary", s.handleSummary)
+    return s.authenticate(readOnly(mux))
+}
+
+// serveHTTP serves the handler until SIGINT or SIGTERM.
+// poll, if not nil, runs now and then every -interval in the background.
+func (r *Runner) serveHTTP(handler http.Handler, poll func()) int {
+    r.logger.Info("Serving", "mode", r.option.mode, "listen", r.option.listen, "interval", r.option.interval)
+    var background func(ctx context.Context)
+    if poll != nil {
+        background = func(ctx context.Context) {
+            ticker := time.NewTicker(r.option.interval)
+            defer ticker.Stop()
+            for {
+                poll()
+                select {
+                case <-ctx.Done():
+                    return
+                case <-ticker.C:
+                }
+            }
+        }
+    }
+    return r.serveUntilSignal(handler, background)
+}
+
+// serveUntilSignal serves the handler until SIGINT or SIGTERM, running background (if not nil) meanwhile.
+// On the signal, the context of background is canceled and the shutdown waits for it to return,
+// e.g. for a fetch writing the archive. A second signal exits at once.
+func (r *Runner) serveUntilSignal(handler http.Handler, background func(ctx context.Context)) int {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    server := &http.Server{Addr: r.option.listen, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+    errCh := make(chan error, 1)
+    go func() {
+        errCh <- server.ListenAndServe()
+    }()
+
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        if background != nil {
+            background(ctx)
+        }
+    }()
+
+    code := 0
+    select {
+    case err := <-errCh:
+        r.logger.Error("Failed to serve", "error", err)
+        code = 1
+    case <-ctx.Done():
+    }
+    // restore the default handling, so that a second signal terminates the process
+    stop()
+
+    r.logger.Info("Shutting down")
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        r.logger.Info("Waiting for the running task to finish")
+        <-done
+    }
+    if code != 0 {
+        return code
+    }
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+    defer cancel()
+    if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+        r.logger.Error("Failed to shut down", "error", err)
+        return 1
+    }
+    return 0
+}
+
+// fetchAll fetches the recent measurements of every profile and appends them to the archives.
+// The lock is held only while appending, so that the requests are not blocked by a slow HealthPlanet.
+func (s *apiServer) fetchAll() {
+    now := time.Now()
+    for _, p := range s.profiles {
+        logger := s.runner.logger.With("profile", profileLabel(p))
+        innerscan, code := s.runner.fetchAPI(p, now.Add(-metricsLookback), now, logger)
+        if code != 0 {
+            continue
+        }
+        s.mu.Lock()
+        s.runner.archiveFetched(p, innerscan, logger)
+        s.mu.Unlock()
+    }
+}
+
+// authenticate passes the requests with a valid API key to next.
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        key := req.Header.Get("X-API-Key")
+        if bearer, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok && key == "" {
+            key = bearer
+        }
+        if !s.validKey(key) {
+            w.Header().Set("WWW-Authenticate", `Bearer realm="` + AppName + `"`)
+            writeError(w, http.StatusUnauthorized, "invalid or missing API key")
+            return
+        }
+        next.ServeHTTP(w, req)
+    })
+}
+
+// readOnly passes only GET and HEAD requests to next.
+func readOnly(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        if req.Method != http.MethodGet && req.Method != http.MethodHead {
+            w.Header().Set("Allow", "GET, HEAD")
+            writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+            return
+        }
+        next.ServeHTTP(w, req)
+    })
+}
+
+// validKey compares the key with every configured key in constant time.
+func (s *apiServer) validKey(key string) bool {
+    valid := 0
+    for _, k := range s.runner.config.APIKeys {
+        valid |= subtle.ConstantTimeCompare([]byte(key), []byte(k))
+    }
+    return key != "" && valid == 1
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    body, _ := json.Marshal(map[string]string{"error": message})
+    w.Write(append(body, '\n'))
+}
+
+// writeJSON writes the body with ETag and Last-Modified, answering the conditional requests.
+// A zero modTime has no Last-Modified.
+func writeJSON(w http.ResponseWriter, req *http.Request, body string, modTime time.Time) {
+    hash := sha256.Sum256([]byte(body))
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("ETag", `"` + hex.EncodeToString(hash[:16]) + `"`)
+    w.Header().Set("Cache-Control", "private, no-cache")
+    http.ServeContent(w, req, "", modTime, strings.NewReader(body))
+}
+
+func marshalJSON(v any) (string, error) {
+    data, err := json.MarshalIndent(v, "", "  ")
+    if err != nil {
+        return "", err
+    }
+    return string(data) + "\n", nil
+}
+
+// profile returns the profile of the request, which is optional if only one profile is served.
+func (s *apiServer) profile(w http.ResponseWriter, req *http.Request) (*Profile, bool) {
+    label := req.URL.Query().Get("profile")
+    if label == "" && len(s.profiles) == 1 {
+        for _, p := range s.profiles {
+            return p, true
+        }
+    }
+    if label == "" {
+        writeError(w, http.StatusBadRequest, "profile is required, one of: " + strings.Join(s.labels(), ", "))
+        return nil, false
+    }
+    p, ok := s.profiles[label]
+    if !ok {
+        writeError(w, http.StatusNotFound, fmt.Sprintf("unknown profile %q", label))
+        return nil, false
+    }
+    return p, true
+}
+
+func (s *apiServer) labels() []string {
+    labels := make([]string, 0, len(s.profiles))
+    for label := range s.profiles {
+        labels = append(labels, label)
+    }
+    sort.Strings(labels)
+    return labels
+}
+
+// periodExprs returns the date expressions of the from and to parameters, with the same defaults as -f and -t.
+func periodExprs(req *http.Request) (string, string) {
+    q := req.URL.Query()
+    fromExpr, toExpr := q.Get("from"), q.Get("to")
+    if fromExpr == "" {
+        fromExpr = "90d"
+    }
+    if toExpr == "" {
+        toExpr = "today"
+    }
+    return fromExpr, toExpr
+}
+
+// periodModTime returns the modification time of the response of the period in the request.
+// A relative period (e.g. the default 90d) moves with the day even if the archive is not modified,
+// so it has no modification time, and only the ETag answers the conditional requests.
+func periodModTime(req *http.Request, modTime time.Time) time.Time {
+    fromExpr, toExpr := periodExprs(req)
+    if isRelativeDateExpr(fromExpr) || isRelativeDateExpr(toExpr) {
+        return time.Time{}
+    }
+    return modTime
+}
+
+// period returns the period of the from and to parameters, with the same defaults as -f and -t.
+func (s *apiServer) period(w http.ResponseWriter, req *http.Request) (time.Time, time.Time, bool) {
+    now := time.Now().In(s.runner.queryLoc)
+    fromExpr, toExpr := periodExprs(req)
+    from, _, err := parseDateExpr(fromExpr, now)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "invalid from: " + err.Error())
+        return time.Time{}, time.Time{}, false
+    }
+    _, to, err := parseDateExpr(toExpr, now)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "invalid to: " + err.Error())
+        return time.Time{}, time.Time{}, false
+    }
+    if from.After(to) {
+        writeError(w, http.StatusBadRequest, "from is after to")
+        return time.Time{}, time.Time{}, false
+    }
+    return from, to, true
+}
+
+// read returns the archived measurements of the period and the modification time of the archive.
+func (s *apiServer) read(profile *Profile, from time.Time, to time.Time) (*healthplanet.Innerscan, time.Time, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    a := archive.Open(profile.ArchiveFile)
+    var modTime time.Time
+    if info, err := os.Stat(a.Path); err == nil {
+        modTime = info.ModTime()
+    }
+    innerscan, err := a.Innerscan(from, to, s.runner.outputLoc)
+    return innerscan, modTime, err
+}
+
+func (s *apiServer) handleProfiles(w http.ResponseWriter, req *http.Request) {
+    body, err := marshalJSON(map[string][]string{"profiles": s.labels()})
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    writeJSON(w, req, body, time.Time{})
+}
+
+func (s *apiServer) handleMeasurements(w http.ResponseWriter, req *http.Request) {
+    profile, ok := s.profile(w, req)
+    if !ok {
+        return
+    }
+    from, to, ok := s.period(w, req)
+    if !ok {
+        return
+    }
+    innerscan, modTime, err := s.read(profile, from, to)
+    if err != nil {
+        s.runner.logger.Error("Failed to read archive", "profile", profileLabel(profile), "error", err)
+        writeError(w, http.StatusInternalServerError, "failed to read archive")
+        return
+    }
+    body, err := innerscan.ToJson()
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    writeJSON(w, req, body, periodModTime(req, modTime))
+}
+
+func (s *apiServer) handleLatest(w http.ResponseWriter, req *http.Request) {
+    profile, ok := s.profile(w, req)
+    if !ok {
+        return
+    }
+    innerscan, modTime, err := s.read(profile, time.Time{}, time.Unix(1<<62, 0))
+    if err != nil {
+        s.runner.logger.Error("Failed to read archive", "profile", profileLabel(profile), "error", err)
+        writeError(w, http.StatusInternalServerError, "failed to read archive")
+        return
+    }
+    n := len(innerscan.Data)
+    if n == 0 {
+        writeError(w, http.StatusNotFound, "no measurement")
+        return
+    }
+    body, err := marshalJSON(struct {
+        Profile string `json:"profile"`
+        Measurement *healthplanet.InnerscanData `json:"measurement"`
+    }{profileLabel(profile), innerscan.Data[n-1]})
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    writeJSON(w, req, body, modTime)
+}
+
+func (s *apiServer) handleSummary(w http.ResponseWriter, req *http.Request) {
+    profile, ok := s.profile(w, req)
+    if !ok {
+        return
+    }
+    from, to, ok := s.period(w, req)
+    if !ok {
+        return
+    }
+    group := req.URL.Query().Get("by")
+    if group == "" {
+        group = analytics.GroupMonth
+    }
+    if _, err := analytics.GroupKey(time.Time{}, group); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid by, use week, month or year")
+        return
+    }
+    innerscan, modTime, err := s.read(profile, from, to)
+    if err != nil {
+        s.runner.logger.Error("Failed to read archive", "profile", profileLabel(profile), "error", err)
+        writeError(w, http.StatusInternalServerError, "failed to read archive")
+        return
+    }
+    summaries, err := analytics.Summarize(innerscan.UniqByDay(), group)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    body, err := analytics.SummaryJson(summaries)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
+        return
+    }
+    writeJSON(w, req, body, periodModTime(req, modTime))
+}
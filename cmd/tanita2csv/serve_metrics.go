@@ -0,0 +1,179 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+serve-metrics mode: a Prometheus exporter of the latest measurements.
+
+Every -interval, the measurements of the last metricsLookback are fetched for each profile,
+and /metrics serves the latest one as gauges labeled by the profile, with the metrics of the exporter itself.
+The latest measurement is kept across the fetches, so it does not disappear when nobody weighs in for a while;
+tanita2csv_measurement_age_seconds tells how old it is.
+*/
+
+const (
+    DefaultMetricsListen = ":9731"
+    DefaultMetricsInterval = 30 * time.Minute
+    metricsLookback = 30 * 24 * time.Hour
+)
+
+// profileMetrics is the state of a profile exposed as the metrics.
+type profileMetrics struct {
+    latest *healthplanet.InnerscanData // nil until the first measurement is fetched
+    fetches int
+    fetchErrors int
+    lastSuccess time.Time
+    tokenExpiry time.Time
+}
+
+type metricsServer struct {
+    runner *Runner
+    profiles []*Profile
+
+    mu sync.Mutex
+    state map[string]*profileMetrics // key: profile label
+}
+
+// profileLabel returns the value of the profile label, "default" for the top level settings.
+func profileLabel(p *Profile) string {
+    if p.Name == DefaultProfile {
+        return "default"
+    }
+    return p.Name
+}
+
+// runServeMetrics serves the metrics of the profiles until SIGINT or SIGTERM.
+func (r *Runner) runServeMetrics(profiles []*Profile) int {
+    s := &metricsServer{
+        runner: r,
+        profiles: profiles,
+        state: make(map[string]*profileMetrics),
+    }
+    for _, p := range profiles {
+        s.state[profileLabel(p)] = &profileMetrics{}
+    }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("/metrics", s.handleMetrics)
+    return r.serveHTTP(mux, s.fetchAll)
+}
+
+func (s *metricsServer) fetchAll() {
+    for _, p := range s.profiles {
+        s.fetch(p)
+    }
+}
+
+func (s *metricsServer) fetch(profile *Profile) {
+    logger := s.runner.logger.With("profile", profileLabel(profile))
+
+    now := time.Now()
+    innerscan, code := s.runner.fetchPeriod(profile, now.Add(-metricsLookback), now, logger)
+
+    // the token may be refreshed by the fetch
+    auth := healthplanet.NewSimpleAuth(s.runner.config.URL, profile.ClientID, profile.ClientSecret, profile.TokenFile, logger)
+    expiry, err := auth.TokenExpiry()
+    if err != nil {
+        logger.Warn("Failed to read token expiry", "error", err)
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    m := s.state[profileLabel(profile)]
+    m.fetches++
+    m.tokenExpiry = expiry
+    if code != 0 {
+        m.fetchErrors++
+        return
+    }
+    m.lastSuccess = now
+    if n := len(innerscan.Data); n > 0 {
+        m.latest = innerscan.Data[n-1]
+    }
+}
+
+func (s *metricsServer) handleMetrics(w http.ResponseWriter, req *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    writeMetrics(w, s.state, time.Now())
+}
+
+// metric is a metric family in the Prometheus text format.
+type metric struct {
+    name string
+    kind string // gauge or counter
+    help string
+    value func(m *profileMetrics) (float64, bool) // false if there is no value
+}
+
+var exportedMetrics = []metric{
+    {"tanita2csv_weight_kg", "gauge", "Weight of the latest measurement.", func(m *profileMetrics) (float64, bool) {
+        return latestValue(m, func(d *healthplanet.InnerscanData) float64 { return d.Weight })
+    }},
+    {"tanita2csv_body_fat_percent", "gauge", "Body fat of the latest measurement.", func(m *profileMetrics) (float64, bool) {
+        return latestValue(m, func(d *healthplanet.InnerscanData) float64 { return d.BodyFat })
+    }},
+    {"tanita2csv_bmi", "gauge", "BMI of the latest measurement.", func(m *profileMetrics) (float64, bool) {
+        return latestValue(m, func(d *healthplanet.InnerscanData) float64 { return d.BMI })
+    }},
+    {"tanita2csv_measurement_timestamp_seconds", "gauge", "Unix time of the latest measurement.", func(m *profileMetrics) (float64, bool) {
+        return latestValue(m, func(d *healthplanet.InnerscanData) float64 { return float64(d.Date.Unix()) })
+    }},
+    {"tanita2csv_fetches_total", "counter", "Number of fetches from HealthPlanet.", func(m *profileMetrics) (float64, bool) {
+        return float64(m.fetches), true
+    }},
+    {"tanita2csv_fetch_errors_total", "counter", "Number of failed fetches from HealthPlanet.", func(m *profileMetrics) (float64, bool) {
+        return float64(m.fetchErrors), true
+    }},
+    {"tanita2csv_last_success_timestamp_seconds", "gauge", "Unix time of the last successful fetch.", func(m *profileMetrics) (float64, bool) {
+        return float64(m.lastSuccess.Unix()), !m.lastSuccess.IsZero()
+    }},
+    {"tanita2csv_token_expiry_timestamp_seconds", "gauge", "Unix time when the access token expires.", func(m *profileMetrics) (float64, bool) {
+        return float64(m.tokenExpiry.Unix()), !m.tokenExpiry.IsZero()
+    }},
+}
+
+func latestValue(m *profileMetrics, value func(d *healthplanet.InnerscanData) float64) (float64, bool) {
+    if m.latest == nil {
+        return 0, false
+    }
+    return value(m.latest), true
+}
+
+// writeMetrics writes the metrics of the profiles in the Prometheus text format.
+func writeMetrics(w io.Writer, state map[string]*profileMetrics, now time.Time) {
+    labels := make([]string, 0, len(state))
+    for label := range state {
+        labels = append(labels, label)
+    }
+    sort.Strings(labels)
+
+    families := append([]metric{}, exportedMetrics...)
+    families = append(families, metric{"tanita2csv_measurement_age_seconds", "gauge", "Seconds since the latest measurement.", func(m *profileMetrics) (float64, bool) {
+        return latestValue(m, func(d *healthplanet.InnerscanData) float64 { return now.Sub(d.Date).Seconds() })
+    }})
+
+    for _, f := range families {
+        fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+        for _, label := range labels {
+            if v, ok := f.value(state[label]); ok {
+                fmt.Fprintf(w, "%s{profile=\"%s\"} %g\n", f.name, escapeLabel(label), v)
+            }
+        }
+    }
+}
+
+// escapeLabel escapes the label value for the Prometheus text format.
+func escapeLabel(v string) string {
+    return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+func TestWriteMetrics(t *testing.T) {
+    now := time.Date(2025, 4, 2, 7, 30, 0, 0, time.UTC)
+    state := map[string]*profileMetrics{
+        "default": {
+            latest: &healthplanet.InnerscanData{Date: now.Add(-time.Hour), Weight: 66.4, BodyFat: 20.5, BMI: 22.4},
+            fetches: 3,
+            fetchErrors: 1,
+            lastSuccess: now.Add(-10 * time.Minute),
+            tokenExpiry: time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC),
+        },
+        // nothing is fetched yet, and the label needs escaping
+        `kid "b"`: {fetches: 2, fetchErrors: 2},
+    }
+
+    var b strings.Builder
+    writeMetrics(&b, state, now)
+    out := b.String()
+
+    for _, line := range []string{
+        "# HELP tanita2csv_weight_kg Weight of the latest measurement.\n# TYPE tanita2csv_weight_kg gauge\n",
+        "# HELP tanita2csv_fetch_errors_total Number of failed fetches from HealthPlanet.\n# TYPE tanita2csv_fetch_errors_total counter\n",
+        "# TYPE tanita2csv_token_expiry_timestamp_seconds gauge\n",
+        "\ntanita2csv_weight_kg{profile=\"default\"} 66.4\n",
+        "\ntanita2csv_bmi{profile=\"default\"} 22.4\n",
+        "\ntanita2csv_measurement_age_seconds{profile=\"default\"} 3600\n",
+        "\ntanita2csv_fetches_total{profile=\"default\"} 3\n",
+        "\ntanita2csv_fetch_errors_total{profile=\"default\"} 1\n",
+        "\ntanita2csv_fetch_errors_total{profile=\"kid \\\"b\\\"\"} 2\n",
+        "\ntanita2csv_token_expiry_timestamp_seconds{profile=\"default\"} 1.7460576e+09\n",
+    } {
+        if !strings.Contains(out, line) {
+            t.Errorf("no %q in:\n%s", line, out)
+        }
+    }
+
+    // the profile without a measurement or a token has no such values
+    for _, name := range []string{"tanita2csv_weight_kg", "tanita2csv_last_success_timestamp_seconds", "tanita2csv_token_expiry_timestamp_seconds"} {
+        if strings.Contains(out, name + "{profile=\"kid") {
+            t.Errorf("%s of the profile without data in:\n%s", name, out)
+        }
+    }
+
+    // every family has one HELP and one TYPE line, and the profiles are sorted
+    if n := strings.Count(out, "# HELP "); n != len(exportedMetrics) + 1 || strings.Count(out, "# TYPE ") != n {
+        t.Errorf("%d HELP lines, want %d", n, len(exportedMetrics) + 1)
+    }
+    if strings.Index(out, "tanita2csv_fetches_total{profile=\"default\"}") > strings.Index(out, "tanita2csv_fetches_total{profile=\"kid") {
+        t.Errorf("profiles are not sorted:\n%s", out)
+    }
+}
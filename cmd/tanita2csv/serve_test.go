@@ -0,0 +1,206 @@
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/analytics"
+    "github.com/kamaboko123/tanita2csv/pkg/archive"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// newTestAPIServer returns a server of the archive with the profiles and their weights, which are measured a day apart from 2025-04-01.
+func newTestAPIServer(t *testing.T, weights map[string][]float64) *apiServer {
+    t.Helper()
+    dir := t.TempDir()
+    r := &Runner{
+        config: &Config{APIKeys: []string{"key-1", "key-2"}},
+        option: &RunOption{source: "archive", trendOptions: analytics.DefaultTrendOptions()},
+        queryLoc: time.UTC,
+        outputLoc: time.UTC,
+        logger: discardLogger,
+    }
+    s := &apiServer{runner: r, profiles: make(map[string]*Profile)}
+    for name, w := range weights {
+        p := &Profile{Name: name, ArchiveFile: filepath.Join(dir, name + ".jsonl"), Garmin: &GarminConfig{}}
+        if _, err := archive.Open(p.ArchiveFile).Append(&healthplanet.Innerscan{Data: testData(w...)}, "api"); err != nil {
+            t.Fatal(err)
+        }
+        s.profiles[profileLabel(p)] = p
+    }
+    return s
+}
+
+// newTestAPI returns a test server of the API with the profiles and their archived weights.
+func newTestAPI(t *testing.T, weights map[string][]float64) *httptest.Server {
+    t.Helper()
+    server := httptest.NewServer(newTestAPIServer(t, weights).handler())
+    t.Cleanup(server.Close)
+    return server
+}
+
+func apiRequest(t *testing.T, method string, url string, header map[string]string) (*http.Response, string) {
+    t.Helper()
+    req, err := http.NewRequest(method, url, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for k, v := range header {
+        req.Header.Set(k, v)
+    }
+    res, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer res.Body.Close()
+    body, err := io.ReadAll(res.Body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return res, string(body)
+}
+
+func TestServeAuth(t *testing.T) {
+    s := newTestAPI(t, map[string][]float64{DefaultProfile: {66.4}})
+    tests := []struct {
+        name string
+        header map[string]string
+        status int
+    }{
+        {"no key", nil, http.StatusUnauthorized},
+        {"wrong key", map[string]string{"X-API-Key": "key-3"}, http.StatusUnauthorized},
+        {"prefix of a key", map[string]string{"X-API-Key": "key-"}, http.StatusUnauthorized},
+        {"not bearer", map[string]string{"Authorization": "Basic key-1"}, http.StatusUnauthorized},
+        {"X-API-Key", map[string]string{"X-API-Key": "key-1"}, http.StatusOK},
+        {"bearer", map[string]string{"Authorization": "Bearer key-2"}, http.StatusOK},
+    }
+    for _, tt := range tests {
+        res, body := apiRequest(t, http.MethodGet, s.URL + "/v1/profiles", tt.header)
+        if res.StatusCode != tt.status {
+            t.Errorf("%s: status %d, want %d: %s", tt.name, res.StatusCode, tt.status, body)
+        }
+        if tt.status == http.StatusUnauthorized && (res.Header.Get("WWW-Authenticate") == "" || !strings.Contains(body, `"error"`)) {
+            t.Errorf("%s: no WWW-Authenticate or error: %v %s", tt.name, res.Header, body)
+        }
+    }
+}
+
+func TestServeReadOnly(t *testing.T) {
+    s := newTestAPI(t, map[string][]float64{DefaultProfile: {66.4}})
+    auth := map[string]string{"X-API-Key": "key-1"}
+    for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+        res, body := apiRequest(t, method, s.URL + "/v1/measurements", auth)
+        if res.StatusCode != http.StatusMethodNotAllowed || res.Header.Get("Allow") != "GET, HEAD" {
+            t.Errorf("%s: status %d, Allow %q: %s", method, res.StatusCode, res.Header.Get("Allow"), body)
+        }
+    }
+    // the key is checked first, so that the methods are not told to the clients without a key
+    if res, _ := apiRequest(t, http.MethodPost, s.URL + "/v1/measurements", nil); res.StatusCode != http.StatusUnauthorized {
+        t.Errorf("POST without a key: status %d, want 401", res.StatusCode)
+    }
+    if res, _ := apiRequest(t, http.MethodHead, s.URL + "/v1/latest", auth); res.StatusCode != http.StatusOK {
+        t.Errorf("HEAD: status %d, want 200", res.StatusCode)
+    }
+}
+
+func TestServeConditional(t *testing.T) {
+    s := newTestAPI(t, map[string][]float64{DefaultProfile: {66.4, 66.2}})
+    auth := map[string]string{"X-API-Key": "key-1"}
+    absolute := s.URL + "/v1/measurements?from=2025-04-01&to=2025-04-30"
+
+    res, body := apiRequest(t, http.MethodGet, absolute, auth)
+    etag, lastModified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+    if res.StatusCode != http.StatusOK || etag == "" || lastModified == "" || !strings.Contains(body, "66.2") {
+        t.Fatalf("status %d, ETag %q, Last-Modified %q: %s", res.StatusCode, etag, lastModified, body)
+    }
+
+    tests := []struct {
+        name string
+        url string
+        header map[string]string
+        status int
+    }{
+        {"same ETag", absolute, map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+        {"other ETag", absolute, map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+        {"not modified since", absolute, map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+        {"another period", s.URL + "/v1/measurements?from=2025-04-02&to=2025-04-30", map[string]string{"If-None-Match": etag}, http.StatusOK},
+        // a relative period moves with the day, so it is not answered by the modification time of the archive
+        {"relative period", s.URL + "/v1/measurements?from=2025-04-01&to=today", map[string]string{"If-Modified-Since": lastModified}, http.StatusOK},
+        {"default period", s.URL + "/v1/summary", map[string]string{"If-Modified-Since": lastModified}, http.StatusOK},
+    }
+    for _, tt := range tests {
+        header := map[string]string{"X-API-Key": "key-1"}
+        for k, v := range tt.header {
+            header[k] = v
+        }
+        res, body := apiRequest(t, http.MethodGet, tt.url, header)
+        if res.StatusCode != tt.status {
+            t.Errorf("%s: status %d, want %d: %s", tt.name, res.StatusCode, tt.status, body)
+        }
+        if tt.status == http.StatusNotModified && body != "" {
+            t.Errorf("%s: 304 has a body: %s", tt.name, body)
+        }
+    }
+
+    for _, url := range []string{s.URL + "/v1/measurements", s.URL + "/v1/measurements?from=7d", s.URL + "/v1/summary?from=2025-04&to=this-month"} {
+        if res, _ := apiRequest(t, http.MethodGet, url, auth); res.Header.Get("Last-Modified") != "" {
+            t.Errorf("%s: Last-Modified %q of a relative period", url, res.Header.Get("Last-Modified"))
+        }
+    }
+    if res, _ := apiRequest(t, http.MethodGet, s.URL + "/v1/latest", auth); res.Header.Get("Last-Modified") == "" {
+        t.Errorf("latest has no Last-Modified")
+    }
+}
+
+func TestServeProfile(t *testing.T) {
+    auth := map[string]string{"X-API-Key": "key-1"}
+    latest := func(t *testing.T, url string) (int, string, float64) {
+        res, body := apiRequest(t, http.MethodGet, url, auth)
+        var r struct {
+            Profile string `json:"profile"`
+            Measurement *healthplanet.InnerscanData `json:"measurement"`
+        }
+        if res.StatusCode != http.StatusOK {
+            return res.StatusCode, body, 0
+        }
+        if err := json.Unmarshal([]byte(body), &r); err != nil || r.Measurement == nil {
+            t.Fatalf("%s: %v: %s", url, err, body)
+        }
+        return res.StatusCode, r.Profile, r.Measurement.Weight
+    }
+
+    // profile can be omitted when only one profile is served
+    single := newTestAPI(t, map[string][]float64{DefaultProfile: {66.4, 66.2}})
+    if status, profile, weight := latest(t, single.URL + "/v1/latest"); status != http.StatusOK || profile != "default" || weight != 66.2 {
+        t.Errorf("single profile: %d %s %v, want default 66.2", status, profile, weight)
+    }
+
+    multi := newTestAPI(t, map[string][]float64{DefaultProfile: {66.4, 66.2}, "kid": {30.1}})
+    tests := []struct {
+        query string
+        status int
+        profile string // or the error message
+        weight float64
+    }{
+        {"?profile=default", http.StatusOK, "default", 66.2},
+        {"?profile=kid", http.StatusOK, "kid", 30.1},
+        {"", http.StatusBadRequest, "profile is required, one of: default, kid", 0},
+        {"?profile=dad", http.StatusNotFound, `unknown profile \"dad\"`, 0},
+    }
+    for _, tt := range tests {
+        status, profile, weight := latest(t, multi.URL + "/v1/latest" + tt.query)
+        if status != tt.status || !strings.Contains(profile, tt.profile) || weight != tt.weight {
+            t.Errorf("%q: %d %s %v, want %d %s %v", tt.query, status, profile, weight, tt.status, tt.profile, tt.weight)
+        }
+    }
+
+    res, body := apiRequest(t, http.MethodGet, multi.URL + "/v1/profiles", auth)
+    if res.StatusCode != http.StatusOK || strings.Join(strings.Fields(body), "") != `{"profiles":["default","kid"]}` {
+        t.Errorf("profiles: %d %s", res.StatusCode, body)
+    }
+}
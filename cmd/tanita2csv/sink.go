@@ -0,0 +1,136 @@
+package main
+
+import (
+    "errors"
+    "log/slog"
+    "github.com/kamaboko123/tanita2csv/pkg/archive"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Sinks forward the new measurements to other systems (MQTT, webhooks and Garmin Connect).
+
+dump and daemon mode send the measurements fetched from the API which are pending for each sink,
+so a cron job or the daemon forwards the weigh-ins as they arrive. The deliveries are recorded per sink
+next to the archive (archive.Deliveries), so each measurement is sent once, and a failed delivery is retried by the next run.
+The first run of a sink sends only the latest measurement and records the older ones of the period as delivered,
+instead of sending the whole history; upload mode and the dead letters of the webhooks are for the history.
+The other modes (diff, serve etc.) only read and never send.
+
+The sinks are enabled by their sections in the config. A failing sink is logged and does not fail the mode.
+publish mode sends the latest measurement to the sinks explicitly, e.g. to set up Home Assistant.
+*/
+
+// errDeadLettered is wrapped by the error of a sink which kept the failed measurements for a manual retry,
+// so that they are recorded as delivered and not sent again.
+var errDeadLettered = errors.New("kept in the dead letter file")
+
+type Sink interface {
+    Name() string
+    // Send sends the measurements of the profile, sorted by date.
+    // innerscan has the body information of the profile (height etc.).
+    Send(profile *Profile, innerscan *healthplanet.Innerscan, data []*healthplanet.InnerscanData) error
+}
+
+// sinks returns the sinks of the profile enabled in the config.
+func (r *Runner) sinks(profile *Profile) []Sink {
+    var sinks []Sink
+    if r.config.MQTT.Broker != "" {
+        sinks = append(sinks, &mqttSink{config: &r.config.MQTT})
+    }
+    for i, w := range r.config.Webhooks {
+        sinks = append(sinks, &webhookSink{index: i, config: w})
+    }
+    if profile.Garmin.enabled() {
+        sinks = append(sinks, &garminSink{config: profile.Garmin})
+    }
+    return sinks
+}
+
+// sendToSinks sends the data to every sink, and returns false if any sink failed.
+func (r *Runner) sendToSinks(profile *Profile, innerscan *healthplanet.Innerscan, data []*healthplanet.InnerscanData, logger *slog.Logger) bool {
+    if len(data) == 0 {
+        return true
+    }
+    ok := true
+    for _, s := range r.sinks(profile) {
+        if err := s.Send(profile, innerscan, data); err != nil {
+            logger.Warn("Failed to send to sink", "sink", s.Name(), "error", err)
+            ok = false
+            continue
+        }
+        logger.Info("Sent to sink", "sink", s.Name(), "data_count", len(data))
+    }
+    return ok
+}
+
+// deliver sends the measurements pending for each sink, and records the delivered ones.
+// The measurements marked as outliers are not sent.
+func (r *Runner) deliver(profile *Profile, innerscan *healthplanet.Innerscan, logger *slog.Logger) {
+    innerscan = innerscan.WithoutOutliers()
+    sinks := r.sinks(profile)
+    if len(sinks) == 0 || len(innerscan.Data) == 0 {
+        return
+    }
+    path := archive.DeliveriesPath(profile.ArchiveFile)
+    deliveries, err := archive.LoadDeliveries(path)
+    if err != nil {
+        logger.Warn("Failed to read the deliveries of the sinks", "deliveries_file", path, "error", err)
+        return
+    }
+
+    for _, s := range sinks {
+        var pending []*healthplanet.InnerscanData
+        if deliveries.Known(s.Name()) {
+            pending = deliveries.Pending(s.Name(), innerscan.Data)
+        } else {
+            n := len(innerscan.Data)
+            deliveries.MarkDelivered(s.Name(), innerscan.Data[:n-1])
+            pending = innerscan.Data[n-1:]
+            logger.Info("First run of sink, sending only the latest measurement", "sink", s.Name(), "skipped_count", n-1)
+        }
+        if len(pending) == 0 {
+            continue
+        }
+        err := s.Send(profile, innerscan, pending)
+        if err != nil && !errors.Is(err, errDeadLettered) {
+            logger.Warn("Failed to send to sink, retrying in the next run", "sink", s.Name(), "error", err)
+            continue
+        }
+        deliveries.MarkDelivered(s.Name(), pending)
+        if err != nil {
+            logger.Warn("Failed to send to sink", "sink", s.Name(), "error", err)
+            continue
+        }
+        logger.Info("Sent to sink", "sink", s.Name(), "data_count", len(pending))
+    }
+
+    if err := deliveries.Save(path); err != nil {
+        logger.Warn("Failed to save the deliveries of the sinks", "deliveries_file", path, "error", err)
+    }
+}
+
+// runPublish sends the latest measurement of the period to the sinks.
+func (r *Runner) runPublish(profile *Profile, logger *slog.Logger) int {
+    if len(r.sinks(profile)) == 0 {
+        logger.Error("No sink is configured, set mqtt, webhooks or garmin in the config")
+        return 1
+    }
+    innerscan, code := r.fetchFiltered(profile, logger)
+    if code != 0 {
+        return code
+    }
+    innerscan = innerscan.WithoutOutliers()
+    if len(innerscan.Data) == 0 {
+        logger.Warn("No measurement to publish in the period")
+        return 0
+    }
+    if r.option.metrics {
+        innerscan.CalcMetrics()
+    }
+    latest := innerscan.Data[len(innerscan.Data)-1:]
+    if !r.sendToSinks(profile, innerscan, latest, logger) {
+        return 1
+    }
+    return 0
+}
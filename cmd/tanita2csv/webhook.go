@@ -0,0 +1,140 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "path/filepath"
+    "text/template"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+    "github.com/kamaboko123/tanita2csv/pkg/webhook"
+)
+
+const DefaultDeadLetterFile = "webhook-dead-letter.jsonl"
+
+// WebhookConfig is a URL which the new measurements are POSTed to, e.g. Slack, Discord or ntfy.
+type WebhookConfig struct {
+    URL string `yaml:"url"`
+    Batch bool `yaml:"batch"`                       // one request for all new measurements instead of one per measurement
+    Template string `yaml:"template"`               // Go template of the body (default: JSON)
+    ContentType string `yaml:"content_type"`        // default: application/json
+    Headers map[string]string `yaml:"headers"`
+    Secret string `yaml:"secret"`                   // signs the body with HMAC-SHA256
+    Retries *int `yaml:"retries"`                   // default: 3
+    DeadLetterFile string `yaml:"dead_letter_file"` // default: $XDG_STATE_HOME/tanita2csv/webhook-dead-letter.jsonl
+}
+
+// webhookEvent is the default JSON body and the data of the template.
+// Measurement is set for each measurement, Measurements for a batch.
+type webhookEvent struct {
+    Profile string `json:"profile"`
+    Measurement *healthplanet.InnerscanData `json:"measurement,omitempty"`
+    Measurements []*healthplanet.InnerscanData `json:"measurements,omitempty"`
+}
+
+var webhookFuncs = template.FuncMap{
+    // json encodes the value, e.g. to embed a string in a JSON template
+    "json": func(v any) (string, error) {
+        b, err := json.Marshal(v)
+        return string(b), err
+    },
+}
+
+func (w *WebhookConfig) template() (*template.Template, error) {
+    if w.Template == "" {
+        return nil, nil
+    }
+    return template.New("webhook").Funcs(webhookFuncs).Parse(w.Template)
+}
+
+func (w *WebhookConfig) deadLetterFile() string {
+    if w.DeadLetterFile == "" {
+        return filepath.Join(StateDir(), DefaultDeadLetterFile)
+    }
+    return w.DeadLetterFile
+}
+
+func (c *Config) validateWebhooks() []ConfigProblem {
+    var problems []ConfigProblem
+    for i, w := range c.Webhooks {
+        prefix := fmt.Sprintf("webhooks[%d].", i)
+        problems = append(problems, c.checkURL(prefix + "url", w.URL)...)
+        if _, err := w.template(); err != nil {
+            problems = append(problems, c.problem(prefix + "template", "invalid template: %v", err))
+        }
+        if w.Retries != nil && *w.Retries < 0 {
+            problems = append(problems, c.problem(prefix + "retries", "must be 0 or more (%d)", *w.Retries))
+        }
+        problems = append(problems, c.checkWritable(prefix + "dead_letter_file", w.deadLetterFile())...)
+    }
+    return problems
+}
+
+// webhookSink POSTs the measurements to the URL. Failed deliveries are appended to the dead letter file.
+type webhookSink struct {
+    index int // in the webhooks of the config
+    config *WebhookConfig
+}
+
+// Name returns the key in the config, as the URL of a webhook is often a secret.
+func (s *webhookSink) Name() string {
+    return fmt.Sprintf("webhooks[%d]", s.index)
+}
+
+func (s *webhookSink) Send(profile *Profile, innerscan *healthplanet.Innerscan, data []*healthplanet.InnerscanData) error {
+    var events []*webhookEvent
+    if s.config.Batch {
+        events = append(events, &webhookEvent{Profile: profileLabel(profile), Measurements: data})
+    } else {
+        for _, d := range data {
+            events = append(events, &webhookEvent{Profile: profileLabel(profile), Measurement: d})
+        }
+    }
+
+    sender := webhook.NewSender(s.config.URL, s.config.Secret)
+    if s.config.ContentType != "" {
+        sender.ContentType = s.config.ContentType
+    }
+    sender.Headers = s.config.Headers
+    if s.config.Retries != nil {
+        sender.Retries = *s.config.Retries
+    }
+
+    var failed int
+    var lastErr error
+    for _, e := range events {
+        body, err := s.body(e)
+        if err != nil {
+            return err
+        }
+        attempts, err := sender.Send(context.Background(), body)
+        if err == nil {
+            continue
+        }
+        failed++
+        lastErr = err
+        if err := webhook.AppendDeadLetter(s.config.deadLetterFile(), webhook.NewDeadLetter(sender, body, attempts, err)); err != nil {
+            return fmt.Errorf("failed to write dead letter: %w", err)
+        }
+    }
+    if failed > 0 {
+        return fmt.Errorf("%d of %d deliveries failed and were written to %s: %w (%w)", failed, len(events), s.config.deadLetterFile(), lastErr, errDeadLettered)
+    }
+    return nil
+}
+
+func (s *webhookSink) body(e *webhookEvent) ([]byte, error) {
+    tmpl, err := s.config.template()
+    if err != nil {
+        return nil, err
+    }
+    if tmpl == nil {
+        return json.Marshal(e)
+    }
+    var b bytes.Buffer
+    if err := tmpl.Execute(&b, e); err != nil {
+        return nil, fmt.Errorf("failed to execute template: %w", err)
+    }
+    return b.Bytes(), nil
+}
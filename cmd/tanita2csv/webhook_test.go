@@ -0,0 +1,148 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+    "github.com/kamaboko123/tanita2csv/pkg/webhook"
+)
+
+type webhookRequest struct {
+    signature string
+    contentType string
+    body string
+}
+
+// newTestReceiver returns a webhook receiver which responds with the status, and the received requests.
+func newTestReceiver(t *testing.T, status int) (*httptest.Server, func() []webhookRequest) {
+    var mu sync.Mutex
+    var requests []webhookRequest
+    s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        body, _ := io.ReadAll(req.Body)
+        mu.Lock()
+        requests = append(requests, webhookRequest{req.Header.Get(webhook.SignatureHeader), req.Header.Get("Content-Type"), string(body)})
+        mu.Unlock()
+        w.WriteHeader(status)
+    }))
+    t.Cleanup(s.Close)
+    return s, func() []webhookRequest {
+        mu.Lock()
+        defer mu.Unlock()
+        return append([]webhookRequest{}, requests...)
+    }
+}
+
+func TestWebhookSink(t *testing.T) {
+    s, requests := newTestReceiver(t, http.StatusNoContent)
+    profile := &Profile{Name: "alice"}
+    data := testData(66.4, 66.2)
+
+    sink := &webhookSink{config: &WebhookConfig{URL: s.URL, Secret: "secret"}}
+    if err := sink.Send(profile, &healthplanet.Innerscan{Data: data}, data); err != nil {
+        t.Fatal(err)
+    }
+    got := requests()
+    if len(got) != 2 {
+        t.Fatalf("got %d requests, want one per measurement", len(got))
+    }
+    for i, req := range got {
+        if !webhook.Verify("secret", []byte(req.body), req.signature) {
+            t.Errorf("request %d: signature %q does not verify the body", i, req.signature)
+        }
+        var event struct {
+            Profile string `json:"profile"`
+            Measurement *healthplanet.InnerscanData `json:"measurement"`
+        }
+        if err := json.Unmarshal([]byte(req.body), &event); err != nil {
+            t.Fatalf("request %d: invalid body %s: %v", i, req.body, err)
+        }
+        if event.Profile != "alice" || event.Measurement == nil || event.Measurement.Weight != data[i].Weight {
+            t.Errorf("request %d: body = %s", i, req.body)
+        }
+    }
+}
+
+func TestWebhookSinkBatchTemplate(t *testing.T) {
+    s, requests := newTestReceiver(t, http.StatusOK)
+    data := testData(66.4, 66.2)
+    config := &WebhookConfig{
+        URL: s.URL,
+        Batch: true,
+        Template: `{"text":{{ json (printf "%s: %d measurements" .Profile (len .Measurements)) }}}`,
+        ContentType: "application/vnd.test+json",
+    }
+
+    sink := &webhookSink{config: config}
+    if err := sink.Send(&Profile{Name: "alice"}, &healthplanet.Innerscan{Data: data}, data); err != nil {
+        t.Fatal(err)
+    }
+    got := requests()
+    if len(got) != 1 {
+        t.Fatalf("got %d requests, want one for the batch", len(got))
+    }
+    if got[0].body != `{"text":"alice: 2 measurements"}` || got[0].contentType != config.ContentType || got[0].signature != "" {
+        t.Errorf("request = %+v", got[0])
+    }
+}
+
+func TestWebhookSinkDeadLetter(t *testing.T) {
+    s, requests := newTestReceiver(t, http.StatusServiceUnavailable)
+    deadLetterFile := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+    retries := 0
+    config := &WebhookConfig{URL: s.URL, Retries: &retries, DeadLetterFile: deadLetterFile}
+    data := testData(66.4, 66.2)
+
+    sink := &webhookSink{config: config}
+    err := sink.Send(&Profile{Name: "alice"}, &healthplanet.Innerscan{Data: data}, data)
+    if !errors.Is(err, errDeadLettered) || !strings.Contains(err.Error(), "2 of 2 deliveries failed") {
+        t.Fatalf("Send = %v, want the dead lettered error", err)
+    }
+    if n := len(requests()); n != 2 {
+        t.Errorf("got %d requests, want 2 without retries", n)
+    }
+
+    content, err := os.ReadFile(deadLetterFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+    if len(lines) != 2 {
+        t.Fatalf("got %d dead letters, want 2", len(lines))
+    }
+    for i, line := range lines {
+        d := &webhook.DeadLetter{}
+        if err := json.Unmarshal([]byte(line), d); err != nil {
+            t.Fatalf("invalid dead letter %s: %v", line, err)
+        }
+        if d.URL != s.URL || d.Attempts != 1 || !strings.Contains(d.Error, "503") || !strings.Contains(d.Body, fmt.Sprintf(`"weight":%v`, data[i].Weight)) {
+            t.Errorf("dead letter %d = %+v", i, d)
+        }
+    }
+}
+
+func TestDeliverWebhookDeadLettered(t *testing.T) {
+    s, requests := newTestReceiver(t, http.StatusBadRequest)
+    retries := 0
+    r := &Runner{
+        config: &Config{Webhooks: []*WebhookConfig{{URL: s.URL, Retries: &retries, DeadLetterFile: filepath.Join(t.TempDir(), "dead-letter.jsonl")}}},
+        option: &RunOption{},
+    }
+    profile := &Profile{Name: DefaultProfile, ArchiveFile: filepath.Join(t.TempDir(), "archive.jsonl"), Garmin: &GarminConfig{}}
+
+    // the dead lettered measurement is not sent again by the next run
+    data := testData(66.4)
+    r.deliver(profile, &healthplanet.Innerscan{Data: data}, discardLogger)
+    r.deliver(profile, &healthplanet.Innerscan{Data: data}, discardLogger)
+    if n := len(requests()); n != 1 {
+        t.Errorf("got %d requests, want 1", n)
+    }
+}
@@ -3,3 +3,5 @@ module github.com/kamaboko123/tanita2csv
 go 1.21
 
 require gopkg.in/yaml.v3 v3.0.1
+
+require golang.org/x/text v0.22.0
@@ -0,0 +1,192 @@
+package analytics
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Gaps (days without measurements) and resampling into a daily series.
+
+The days are calendar days in the location of the measurement dates.
+FindGaps lists the missing days of a period as runs of consecutive days,
+and Resample fills the missing days between measurements with synthetic rows for tools which expect a regular series:
+
+  - linear: interpolates the values linearly in time between the measurements around the gap
+  - locf: carries the last observation forward
+
+Only the days between the first and the last measurements are filled, nothing is extrapolated.
+The rows marked as outliers (MarkOutliers) are kept as they are, but they are not the measurements to fill from:
+the days around an outlier are filled from the measurements around it.
+*/
+
+const (
+    FillLinear = "linear"
+    FillLOCF = "locf"
+)
+
+type Gap struct {
+    From string `json:"from"` // first missing day, YYYY-MM-DD
+    To string `json:"to"`     // last missing day, YYYY-MM-DD
+    Days int `json:"days"`
+}
+
+type GapReport struct {
+    From string `json:"from"` // first day of the period, YYYY-MM-DD
+    To string `json:"to"`     // last day of the period, YYYY-MM-DD
+    Days int `json:"days"`
+    MeasuredDays int `json:"measured_days"`
+    MissingDays int `json:"missing_days"`
+    LongestGap int `json:"longest_gap"`        // days
+    LongestStreak int `json:"longest_streak"`  // consecutive measured days
+    Gaps []*Gap `json:"gaps"`
+}
+
+// nextDay returns the same wall-clock time of the next calendar day.
+func nextDay(t time.Time) time.Time {
+    return t.AddDate(0, 0, 1)
+}
+
+// FindGaps returns the missing days between from and to, in the days of loc.
+func FindGaps(innerscan *healthplanet.Innerscan, from time.Time, to time.Time, loc *time.Location) *GapReport {
+    measured := make(map[string]bool, len(innerscan.Data))
+    for _, d := range innerscan.Data {
+        measured[d.Date.In(loc).Format("2006-01-02")] = true
+    }
+
+    first := from.In(loc)
+    first = time.Date(first.Year(), first.Month(), first.Day(), 12, 0, 0, 0, loc)
+    last := to.In(loc).Format("2006-01-02")
+    report := &GapReport{
+        From: first.Format("2006-01-02"),
+        To: last,
+        Gaps: make([]*Gap, 0),
+    }
+
+    var gap *Gap
+    streak := 0
+    for day := first; day.Format("2006-01-02") <= last; day = nextDay(day) {
+        key := day.Format("2006-01-02")
+        report.Days++
+        if measured[key] {
+            report.MeasuredDays++
+            gap = nil
+            streak++
+            report.LongestStreak = max(report.LongestStreak, streak)
+            continue
+        }
+        report.MissingDays++
+        streak = 0
+        if gap == nil {
+            gap = &Gap{From: key}
+            report.Gaps = append(report.Gaps, gap)
+        }
+        gap.To = key
+        gap.Days++
+        report.LongestGap = max(report.LongestGap, gap.Days)
+    }
+    return report
+}
+
+// Resample returns a copy with one row per day between the first and the last measurements,
+// filling the missing days by the method (FillLinear or FillLOCF). The filled rows are marked as synthetic.
+// The data must have one measurement per day (Innerscan.UniqByDay) sorted by date.
+func Resample(innerscan *healthplanet.Innerscan, method string) (*healthplanet.Innerscan, error) {
+    if method != FillLinear && method != FillLOCF {
+        return nil, fmt.Errorf("unknown fill method %q (use linear or locf)", method)
+    }
+    ret := &healthplanet.Innerscan{
+        BirthDate: innerscan.BirthDate,
+        Hight: innerscan.Hight,
+        Sex: innerscan.Sex,
+        Data: make([]*healthplanet.InnerscanData, 0, len(innerscan.Data)),
+    }
+    // next[i] is the first measurement which is not an outlier at or after i
+    next := make([]*healthplanet.InnerscanData, len(innerscan.Data))
+    var anchor *healthplanet.InnerscanData
+    for i := len(innerscan.Data) - 1; i >= 0; i-- {
+        if !innerscan.Data[i].IsOutlier() {
+            anchor = innerscan.Data[i]
+        }
+        next[i] = anchor
+    }
+
+    var prev *healthplanet.InnerscanData // the last measurement which is not an outlier
+    for i, d := range innerscan.Data {
+        if i > 0 && prev != nil && next[i] != nil {
+            last := innerscan.Data[i-1]
+            for day := nextDay(last.Date); day.Format("2006-01-02") < d.Day(); day = nextDay(day) {
+                ret.Data = append(ret.Data, fill(prev, next[i], day, method))
+            }
+        }
+        ret.Data = append(ret.Data, d)
+        if !d.IsOutlier() {
+            prev = d
+        }
+    }
+    return ret, nil
+}
+
+// fill returns the synthetic data at the time between prev and next.
+func fill(prev *healthplanet.InnerscanData, next *healthplanet.InnerscanData, at time.Time, method string) *healthplanet.InnerscanData {
+    d := &healthplanet.InnerscanData{
+        Date: at,
+        Weight: prev.Weight,
+        BodyFat: prev.BodyFat,
+        BMI: prev.BMI,
+        Synthetic: true,
+    }
+    if method == FillLinear {
+        ratio := at.Sub(prev.Date).Hours() / next.Date.Sub(prev.Date).Hours()
+        d.Weight = interpolate(prev.Weight, next.Weight, ratio)
+        d.BodyFat = interpolate(prev.BodyFat, next.BodyFat, ratio)
+        d.BMI = interpolate(prev.BMI, next.BMI, ratio)
+    }
+    return d
+}
+
+// interpolate returns the value at ratio between a and b, keeping a missing (0) value missing.
+func interpolate(a float64, b float64, ratio float64) float64 {
+    if a == 0 || b == 0 {
+        return 0
+    }
+    return a + (b - a) * ratio
+}
+
+// GapText returns the report in a human readable form.
+func GapText(r *GapReport) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "Period: %s .. %s (%s)\n", r.From, r.To, dayCount(r.Days))
+    fmt.Fprintf(&b, "Measured: %s, missing: %s\n", dayCount(r.MeasuredDays), dayCount(r.MissingDays))
+    fmt.Fprintf(&b, "Longest streak: %s, longest gap: %s\n", dayCount(r.LongestStreak), dayCount(r.LongestGap))
+    if len(r.Gaps) == 0 {
+        return b.String()
+    }
+    b.WriteString("\nGaps:\n")
+    for _, g := range r.Gaps {
+        days := g.From
+        if g.From != g.To {
+            days += " .. " + g.To
+        }
+        fmt.Fprintf(&b, "  %-24s  %s\n", days, dayCount(g.Days))
+    }
+    return b.String()
+}
+
+func dayCount(n int) string {
+    if n == 1 {
+        return "1 day"
+    }
+    return fmt.Sprintf("%d days", n)
+}
+
+func GapJson(r *GapReport) (string, error) {
+    data, err := json.MarshalIndent(r, "", "  ")
+    if err != nil {
+        return "", err
+    }
+    return string(data) + "\n", nil
+}
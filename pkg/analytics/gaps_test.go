@@ -0,0 +1,86 @@
+package analytics
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// resampled returns the rows as "day weight" with "*" for the synthetic rows.
+func resampled(data []*healthplanet.InnerscanData) string {
+    rows := make([]string, 0, len(data))
+    for _, d := range data {
+        row := fmt.Sprintf("%s %.2f", d.Day(), d.Weight)
+        if d.Synthetic {
+            row += "*"
+        }
+        rows = append(rows, row)
+    }
+    return strings.Join(rows, ", ")
+}
+
+func TestResample(t *testing.T) {
+    start := time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC)
+    tests := []struct {
+        name string
+        weights []float64
+        outliers []int // indexes of the weights marked as outliers
+        method string
+        want string
+    }{
+        {"linear", []float64{70, 0, 0, 67}, nil, FillLinear,
+            "2025-04-01 70.00, 2025-04-02 69.00*, 2025-04-03 68.00*, 2025-04-04 67.00"},
+        {"locf", []float64{70, 0, 0, 67}, nil, FillLOCF,
+            "2025-04-01 70.00, 2025-04-02 70.00*, 2025-04-03 70.00*, 2025-04-04 67.00"},
+        {"no gap", []float64{70, 69}, nil, FillLinear, "2025-04-01 70.00, 2025-04-02 69.00"},
+        // the outlier is kept, and the days around it are filled from 70 to 66
+        {"outlier in a gap", []float64{70, 0, 95, 0, 66}, []int{2}, FillLinear,
+            "2025-04-01 70.00, 2025-04-02 69.00*, 2025-04-03 95.00, 2025-04-04 67.00*, 2025-04-05 66.00"},
+        {"outlier in a gap locf", []float64{70, 0, 95, 0, 66}, []int{2}, FillLOCF,
+            "2025-04-01 70.00, 2025-04-02 70.00*, 2025-04-03 95.00, 2025-04-04 70.00*, 2025-04-05 66.00"},
+        // nothing is extrapolated from an outlier at the ends
+        {"outliers at the ends", []float64{95, 0, 70, 0, 68, 0, 30}, []int{0, 6}, FillLinear,
+            "2025-04-01 95.00, 2025-04-03 70.00, 2025-04-04 69.00*, 2025-04-05 68.00, 2025-04-07 30.00"},
+    }
+    for _, tt := range tests {
+        innerscan := dailyData(start, tt.weights...)
+        for _, i := range tt.outliers {
+            for _, d := range innerscan.Data {
+                if d.Date.Equal(start.AddDate(0, 0, i)) {
+                    d.Outlier = &healthplanet.OutlierMark{Outlier: true}
+                }
+            }
+        }
+        filled, err := Resample(innerscan, tt.method)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got := resampled(filled.Data); got != tt.want {
+            t.Errorf("%s: Resample = %s, want %s", tt.name, got, tt.want)
+        }
+    }
+
+    if _, err := Resample(dailyData(start, 70), "spline"); err == nil {
+        t.Errorf("Resample with an unknown method succeeded")
+    }
+}
+
+func TestFindGaps(t *testing.T) {
+    start := time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC)
+    innerscan := dailyData(start, 70, 0, 0, 69, 68, 0, 67)
+    report := FindGaps(innerscan, start, start.AddDate(0, 0, 7), time.UTC)
+    if report.Days != 8 || report.MeasuredDays != 4 || report.MissingDays != 4 || report.LongestGap != 2 || report.LongestStreak != 2 {
+        t.Errorf("report = %+v", report)
+    }
+    want := []Gap{{"2025-04-02", "2025-04-03", 2}, {"2025-04-06", "2025-04-06", 1}, {"2025-04-08", "2025-04-08", 1}}
+    if len(report.Gaps) != len(want) {
+        t.Fatalf("got %d gaps, want %d", len(report.Gaps), len(want))
+    }
+    for i, g := range report.Gaps {
+        if *g != want[i] {
+            t.Errorf("gap %d = %+v, want %+v", i, *g, want[i])
+        }
+    }
+}
@@ -0,0 +1,173 @@
+package analytics
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Goal tracking of the weight and the body fat.
+
+The progress is judged by the trend, not by the last measurement which bounces day by day:
+the current value is the EWMA and the rate is the regression slope of the last SlopeDays days (TrendOptions).
+The goal may be below or above the current value (losing or gaining),
+and it is reached when the trend is within goalTolerance of the target.
+
+The projected date is when the trend reaches the target at the current rate,
+which is known only if the trend is moving toward the target.
+With a target date, the goal is on pace if the projected date is not after it.
+*/
+
+const (
+    GoalWeight = "weight"
+    GoalBodyFat = "body_fat"
+)
+
+// maxProjectionWeeks is the limit of the projection, a slower rate has no projected date.
+const maxProjectionWeeks = 520
+
+// goalTolerance is the distance to the target in kg or % within which the goal is reached.
+const goalTolerance = 0.1
+
+type Goal struct {
+    Metric string      // GoalWeight or GoalBodyFat
+    Target float64     // kg or %
+    Date time.Time     // target date, zero if not set
+}
+
+type GoalStatus struct {
+    Metric string `json:"metric"`
+    Unit string `json:"unit"`
+    AsOf string `json:"as_of"`                          // day of the last measurement, YYYY-MM-DD
+    Current float64 `json:"current"`                    // trend (EWMA) at the last measurement
+    Target float64 `json:"target"`
+    Remaining float64 `json:"remaining"`                // target - current
+    Rate float64 `json:"rate"`                          // per week
+    RateDays int `json:"rate_days"`                     // window of the rate in days
+    Reached bool `json:"reached"`
+    ProjectedDate string `json:"projected_date,omitempty"` // YYYY-MM-DD, empty if not moving toward the target
+    TargetDate string `json:"target_date,omitempty"`       // YYYY-MM-DD
+    RequiredRate float64 `json:"required_rate,omitempty"`  // per week to reach the target on the target date
+    OnPace bool `json:"on_pace"`
+}
+
+// BodyFatPoints returns the body fat of the data which has it.
+func BodyFatPoints(data []*healthplanet.InnerscanData) []Point {
+    points := make([]Point, 0, len(data))
+    for _, d := range data {
+        if d.BodyFat > 0 {
+            points = append(points, Point{Time: d.Date, Value: d.BodyFat})
+        }
+    }
+    return points
+}
+
+// GoalProgress returns the progress toward the goal with the data sorted by date.
+// The data marked as outliers are not counted.
+func GoalProgress(innerscan *healthplanet.Innerscan, goal Goal, opts TrendOptions) (*GoalStatus, error) {
+    innerscan = innerscan.WithoutOutliers()
+    var points []Point
+    var unit string
+    switch goal.Metric {
+    case GoalWeight:
+        points, unit = WeightPoints(innerscan.Data), "kg"
+    case GoalBodyFat:
+        points, unit = BodyFatPoints(innerscan.Data), "%"
+    default:
+        return nil, fmt.Errorf("unknown goal metric %q", goal.Metric)
+    }
+    if len(points) == 0 {
+        return nil, fmt.Errorf("no %s data to track the goal", goal.Metric)
+    }
+
+    last := points[len(points)-1]
+    ewma := EWMA(points, opts.Alpha)
+    rate, _, _ := Regression(points[inWindow(points, len(points)-1, opts.SlopeDays):])
+
+    s := &GoalStatus{
+        Metric: goal.Metric,
+        Unit: unit,
+        AsOf: last.Time.Format("2006-01-02"),
+        Current: ewma[len(ewma)-1],
+        Target: goal.Target,
+        Rate: rate,
+        RateDays: opts.SlopeDays,
+    }
+    s.Remaining = s.Target - s.Current
+    s.Reached = math.Abs(s.Remaining) <= goalTolerance
+
+    var projected time.Time
+    if !s.Reached && rate != 0 && math.Signbit(rate) == math.Signbit(s.Remaining) {
+        if weeks := s.Remaining / rate; weeks <= maxProjectionWeeks {
+            projected = last.Time.Add(time.Duration(weeks * float64(week)))
+            s.ProjectedDate = projected.Format("2006-01-02")
+        }
+    }
+
+    if goal.Date.IsZero() {
+        s.OnPace = s.Reached || !projected.IsZero()
+        return s, nil
+    }
+    s.TargetDate = goal.Date.Format("2006-01-02")
+    if s.Reached {
+        s.OnPace = true
+        return s, nil
+    }
+    if weeks := goal.Date.Sub(last.Time).Hours() / week.Hours(); weeks > 0 {
+        s.RequiredRate = s.Remaining / weeks
+    }
+    // the target date is a day, so reaching it on the day is on pace
+    s.OnPace = !projected.IsZero() && projected.Format("2006-01-02") <= s.TargetDate
+    return s, nil
+}
+
+// GoalText returns the statuses in a human readable form.
+func GoalText(statuses []*GoalStatus) string {
+    var b strings.Builder
+    for _, s := range statuses {
+        name := "Weight"
+        if s.Metric == GoalBodyFat {
+            name = "Body fat"
+        }
+        fmt.Fprintf(&b, "%s: %.2f %s as of %s, goal %.2f %s", name, s.Current, s.Unit, s.AsOf, s.Target, s.Unit)
+        if s.Reached {
+            b.WriteString(", reached\n")
+            continue
+        }
+        fmt.Fprintf(&b, ", %+.2f %s to go\n", s.Remaining, s.Unit)
+        fmt.Fprintf(&b, "  Rate: %+.2f %s/week (last %d days)\n", s.Rate, s.Unit, s.RateDays)
+        projected := s.ProjectedDate
+        switch {
+        case projected != "":
+        case s.Rate != 0 && math.Signbit(s.Rate) == math.Signbit(s.Remaining):
+            projected = fmt.Sprintf("more than %d years at the current rate", maxProjectionWeeks / 52)
+        default:
+            projected = "not moving toward the goal"
+        }
+        fmt.Fprintf(&b, "  Projected: %s\n", projected)
+        if s.TargetDate != "" {
+            pace := "behind pace"
+            if s.OnPace {
+                pace = "on pace"
+            }
+            fmt.Fprintf(&b, "  Target date: %s, %s", s.TargetDate, pace)
+            if s.RequiredRate != 0 {
+                fmt.Fprintf(&b, " (needs %+.2f %s/week)", s.RequiredRate, s.Unit)
+            }
+            b.WriteString("\n")
+        }
+    }
+    return b.String()
+}
+
+func GoalJson(statuses []*GoalStatus) (string, error) {
+    data, err := json.MarshalIndent(statuses, "", "  ")
+    if err != nil {
+        return "", err
+    }
+    return string(data) + "\n", nil
+}
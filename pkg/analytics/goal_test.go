@@ -0,0 +1,134 @@
+package analytics
+
+import (
+    "math"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+func TestGoalProgress(t *testing.T) {
+    start := time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC)
+    // -0.1 kg per day (-0.7 kg per week) to 69.3 kg on 2025-04-08
+    losing := dailyData(start, 70, 69.9, 69.8, 69.7, 69.6, 69.5, 69.4, 69.3)
+    // the EWMA follows the last value with alpha 1
+    opts := TrendOptions{SMADays: 7, Alpha: 1, SlopeDays: 28}
+    date := func(s string) time.Time {
+        d, _ := time.Parse("2006-01-02", s)
+        return d
+    }
+
+    tests := []struct {
+        name string
+        innerscan *healthplanet.Innerscan
+        goal Goal
+        reached bool
+        projected string
+        onPace bool
+        requiredRate float64
+    }{
+        // 3.5 kg to go at 0.7 kg per week is 5 weeks
+        {"projected", losing, Goal{Metric: GoalWeight, Target: 65.8}, false, "2025-05-13", true, 0},
+        {"on pace", losing, Goal{Metric: GoalWeight, Target: 65.8, Date: date("2025-05-20")}, false, "2025-05-13", true, -3.5 / (date("2025-05-20").Sub(start.AddDate(0, 0, 7)).Hours() / 168)},
+        {"on the target date", losing, Goal{Metric: GoalWeight, Target: 65.8, Date: date("2025-05-13")}, false, "2025-05-13", true, -3.5 / (date("2025-05-13").Sub(start.AddDate(0, 0, 7)).Hours() / 168)},
+        {"behind", losing, Goal{Metric: GoalWeight, Target: 65.8, Date: date("2025-05-01")}, false, "2025-05-13", false, -3.5 / (date("2025-05-01").Sub(start.AddDate(0, 0, 7)).Hours() / 168)},
+        {"moving away", losing, Goal{Metric: GoalWeight, Target: 72}, false, "", false, 0},
+        {"moving away with a date", losing, Goal{Metric: GoalWeight, Target: 72, Date: date("2025-06-01")}, false, "", false, 2.7 / (date("2025-06-01").Sub(start.AddDate(0, 0, 7)).Hours() / 168)},
+        {"already reached", losing, Goal{Metric: GoalWeight, Target: 69.35}, true, "", true, 0},
+        {"reached with a past date", losing, Goal{Metric: GoalWeight, Target: 69.35, Date: date("2025-04-01")}, true, "", true, 0},
+        {"body fat reached", losing, Goal{Metric: GoalBodyFat, Target: 20}, true, "", true, 0},
+        // the rate needs two measurements
+        {"single measurement", dailyData(start, 70), Goal{Metric: GoalWeight, Target: 65}, false, "", false, 0},
+        // 1 kg to go at 0.0007 kg per week is more than 10 years
+        {"too slow", dailyData(start, 70, 69.9999), Goal{Metric: GoalWeight, Target: 69}, false, "", false, 0},
+    }
+    for _, tt := range tests {
+        s, err := GoalProgress(tt.innerscan, tt.goal, opts)
+        if err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+            continue
+        }
+        if s.Reached != tt.reached || s.ProjectedDate != tt.projected || s.OnPace != tt.onPace || math.Abs(s.RequiredRate - tt.requiredRate) > 1e-9 {
+            t.Errorf("%s: reached %v, projected %q, on pace %v, required rate %v, want %v, %q, %v, %v",
+                tt.name, s.Reached, s.ProjectedDate, s.OnPace, s.RequiredRate, tt.reached, tt.projected, tt.onPace, tt.requiredRate)
+        }
+    }
+
+    s, err := GoalProgress(losing, Goal{Metric: GoalWeight, Target: 65.8}, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if s.AsOf != "2025-04-08" || math.Abs(s.Current - 69.3) > 1e-9 || math.Abs(s.Remaining + 3.5) > 1e-9 || math.Abs(s.Rate + 0.7) > 1e-9 || s.RateDays != 28 || s.Unit != "kg" {
+        t.Errorf("status = %+v", s)
+    }
+}
+
+func TestGoalProgressNoData(t *testing.T) {
+    tests := []struct {
+        name string
+        innerscan *healthplanet.Innerscan
+        goal Goal
+    }{
+        {"no data", &healthplanet.Innerscan{}, Goal{Metric: GoalWeight, Target: 65}},
+        {"no body fat", &healthplanet.Innerscan{Data: []*healthplanet.InnerscanData{{Date: time.Now(), Weight: 70}}}, Goal{Metric: GoalBodyFat, Target: 18}},
+        {"unknown metric", dailyData(time.Now(), 70), Goal{Metric: "bmi", Target: 22}},
+    }
+    for _, tt := range tests {
+        if s, err := GoalProgress(tt.innerscan, tt.goal, DefaultTrendOptions()); err == nil {
+            t.Errorf("%s: GoalProgress() = %+v, want an error", tt.name, s)
+        }
+    }
+}
+
+func TestGoalText(t *testing.T) {
+    start := time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC)
+    losing := dailyData(start, 70, 69.9, 69.8, 69.7, 69.6, 69.5, 69.4, 69.3)
+    opts := TrendOptions{SMADays: 7, Alpha: 1, SlopeDays: 28}
+    progress := func(goal Goal) *GoalStatus {
+        s, err := GoalProgress(losing, goal, opts)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return s
+    }
+
+    text := GoalText([]*GoalStatus{
+        progress(Goal{Metric: GoalWeight, Target: 65.8, Date: time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)}),
+        progress(Goal{Metric: GoalWeight, Target: 72}),
+        progress(Goal{Metric: GoalBodyFat, Target: 20}),
+    })
+    for _, line := range []string{
+        "Weight: 69.30 kg as of 2025-04-08, goal 65.80 kg, -3.50 kg to go\n",
+        "  Rate: -0.70 kg/week (last 28 days)\n",
+        "  Projected: 2025-05-13\n",
+        "  Target date: 2025-05-01, behind pace (needs -1.08 kg/week)\n",
+        "  Projected: not moving toward the goal\n",
+        "Body fat: 20.00 % as of 2025-04-08, goal 20.00 %, reached\n",
+    } {
+        if !strings.Contains(text, line) {
+            t.Errorf("GoalText() does not contain %q:\n%s", line, text)
+        }
+    }
+}
+
+// TestGoalProgressOutliers checks that the measurements marked as outliers do not move the trend.
+func TestGoalProgressOutliers(t *testing.T) {
+    start := time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC)
+    goal := Goal{Metric: GoalWeight, Target: 60}
+    opts := DefaultTrendOptions()
+
+    clean, err := GoalProgress(dailyData(start, 66.4, 66.2, 66.0), goal, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    marked := dailyData(start, 66.4, 66.2, 66.0, 33.0)
+    MarkOutliers(marked, OutlierOptions{MinWeight: 50})
+    got, err := GoalProgress(marked, goal, opts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got.AsOf != clean.AsOf || got.Current != clean.Current || got.Rate != clean.Rate {
+        t.Errorf("GoalProgress() with an outlier = %s %v %v, want %s %v %v", got.AsOf, got.Current, got.Rate, clean.AsOf, clean.Current, clean.Rate)
+    }
+}
@@ -0,0 +1,193 @@
+package analytics
+
+import (
+    "encoding/csv"
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Outlier detection of the weight.
+
+Validate accepts any weight > 0, so a kid stepping on the scale or a weigh-in holding a suitcase is exported as is.
+A measurement is an outlier if any of the following rules (each disabled by 0) flags it, checked in order:
+
+  - Bounds: the weight is out of MinWeight..MaxWeight.
+  - MAD: the modified z-score 0.6745 * |weight - median| / MAD exceeds Threshold,
+    where median and MAD (median absolute deviation) are of the measurements within WindowDays days centered on it.
+  - Daily change: the change from the previous measurement which is not an outlier
+    exceeds MaxDailyChange kg or MaxDailyChangePercent % per day (at least one day).
+*/
+
+type OutlierOptions struct {
+    WindowDays int                 // window of the MAD in days
+    Threshold float64              // modified z-score to flag
+    MaxDailyChange float64         // max change per day in kg
+    MaxDailyChangePercent float64  // max change per day in %
+    MinWeight float64              // lower bound of the weight in kg
+    MaxWeight float64              // upper bound of the weight in kg
+}
+
+func DefaultOutlierOptions() OutlierOptions {
+    return OutlierOptions{
+        WindowDays: 14,
+        Threshold: 3.5, // Iglewicz and Hoaglin
+        MaxDailyChange: 2,
+    }
+}
+
+const (
+    // minimum number of measurements in the window to use the MAD
+    madMinCount = 5
+    // lower limit of the MAD, so that a stable weight does not flag the usual daily fluctuation
+    madFloor = 0.3
+)
+
+// Outlier is a measurement flagged by DetectOutliers with the reason.
+type Outlier struct {
+    Data *healthplanet.InnerscanData
+    Reason string
+}
+
+// DetectOutliers returns the outliers of the data in order. The data must be sorted by date.
+func DetectOutliers(data []*healthplanet.InnerscanData, opts OutlierOptions) []*Outlier {
+    reasons := make([]string, len(data))
+    points := WeightPoints(data)
+
+    for i, d := range data {
+        switch {
+        case opts.MinWeight > 0 && d.Weight < opts.MinWeight:
+            reasons[i] = fmt.Sprintf("weight %.2f kg is below %.2f kg", d.Weight, opts.MinWeight)
+        case opts.MaxWeight > 0 && d.Weight > opts.MaxWeight:
+            reasons[i] = fmt.Sprintf("weight %.2f kg is above %.2f kg", d.Weight, opts.MaxWeight)
+        }
+    }
+
+    if opts.WindowDays > 0 && opts.Threshold > 0 {
+        for i := range points {
+            if reasons[i] != "" {
+                continue
+            }
+            window := centeredWindow(points, reasons, i, opts.WindowDays)
+            if len(window) < madMinCount {
+                continue
+            }
+            m := median(window)
+            deviations := make([]float64, len(window))
+            for j, v := range window {
+                deviations[j] = math.Abs(v - m)
+            }
+            mad := math.Max(median(deviations), madFloor)
+            if z := 0.6745 * math.Abs(points[i].Value - m) / mad; z > opts.Threshold {
+                reasons[i] = fmt.Sprintf("weight %.2f kg is far from the median %.2f kg (modified z-score %.1f)", points[i].Value, m, z)
+            }
+        }
+    }
+
+    if opts.MaxDailyChange > 0 || opts.MaxDailyChangePercent > 0 {
+        prev := -1
+        for i := range points {
+            if reasons[i] != "" {
+                continue
+            }
+            if prev >= 0 {
+                days := math.Max(points[i].Time.Sub(points[prev].Time).Hours() / 24, 1)
+                change := points[i].Value - points[prev].Value
+                percent := change / points[prev].Value * 100
+                switch {
+                case opts.MaxDailyChange > 0 && math.Abs(change) > opts.MaxDailyChange * days:
+                    reasons[i] = fmt.Sprintf("weight changed %+.2f kg in %.1f days", change, days)
+                case opts.MaxDailyChangePercent > 0 && math.Abs(percent) > opts.MaxDailyChangePercent * days:
+                    reasons[i] = fmt.Sprintf("weight changed %+.1f%% in %.1f days", percent, days)
+                }
+                if reasons[i] != "" {
+                    continue
+                }
+            }
+            prev = i
+        }
+    }
+
+    outliers := make([]*Outlier, 0)
+    for i, reason := range reasons {
+        if reason != "" {
+            outliers = append(outliers, &Outlier{Data: data[i], Reason: reason})
+        }
+    }
+    return outliers
+}
+
+// centeredWindow returns the values within days days centered on points[i], except the ones out of bounds.
+func centeredWindow(points []Point, reasons []string, i int, days int) []float64 {
+    half := time.Duration(days) * day / 2
+    values := make([]float64, 0)
+    for j, p := range points {
+        if reasons[j] != "" && j != i {
+            continue
+        }
+        if d := p.Time.Sub(points[i].Time); d >= -half && d <= half {
+            values = append(values, p.Value)
+        }
+    }
+    return values
+}
+
+func median(values []float64) float64 {
+    sorted := append([]float64{}, values...)
+    sort.Float64s(sorted)
+    n := len(sorted)
+    if n % 2 == 1 {
+        return sorted[n/2]
+    }
+    return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// FilterOutliers returns a copy without the outliers, and the outliers.
+func FilterOutliers(innerscan *healthplanet.Innerscan, opts OutlierOptions) (*healthplanet.Innerscan, []*Outlier) {
+    outliers := DetectOutliers(innerscan.Data, opts)
+    flagged := make(map[*healthplanet.InnerscanData]bool, len(outliers))
+    for _, o := range outliers {
+        flagged[o.Data] = true
+    }
+    ret := &healthplanet.Innerscan{
+        BirthDate: innerscan.BirthDate,
+        Hight: innerscan.Hight,
+        Sex: innerscan.Sex,
+        Data: make([]*healthplanet.InnerscanData, 0, len(innerscan.Data)),
+    }
+    for _, d := range innerscan.Data {
+        if !flagged[d] {
+            ret.Data = append(ret.Data, d)
+        }
+    }
+    return ret, outliers
+}
+
+// MarkOutliers sets the outlier flag to every data, and returns the outliers.
+func MarkOutliers(innerscan *healthplanet.Innerscan, opts OutlierOptions) []*Outlier {
+    for _, d := range innerscan.Data {
+        d.Outlier = &healthplanet.OutlierMark{}
+    }
+    outliers := DetectOutliers(innerscan.Data, opts)
+    for _, o := range outliers {
+        o.Data.Outlier = &healthplanet.OutlierMark{Outlier: true, Reason: o.Reason}
+    }
+    return outliers
+}
+
+// OutliersCsv returns the outliers in CSV with the time of the measurement and the reason.
+func OutliersCsv(outliers []*Outlier) string {
+    var b strings.Builder
+    w := csv.NewWriter(&b)
+    w.Write([]string{"Date", "Model", "Weight", "BMI", "Fat", "Reason"})
+    for _, o := range outliers {
+        d := o.Data
+        w.Write([]string{d.Date.Format("2006-01-02 15:04:05"), d.Model, formatCsvFloat(d.Weight), formatCsvFloat(d.BMI), formatCsvFloat(d.BodyFat), o.Reason})
+    }
+    w.Flush()
+    return b.String()
+}
@@ -0,0 +1,75 @@
+package analytics
+
+import (
+    "encoding/csv"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+func TestDetectOutliers(t *testing.T) {
+    start := time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC)
+    tests := []struct {
+        name string
+        weights []float64
+        opts OutlierOptions
+        want []int // indexes of the outliers
+        reason string
+    }{
+        {"stable", []float64{66.4, 66.2, 66.5, 66.3, 66.1, 66.4, 66.2}, DefaultOutlierOptions(), nil, ""},
+        {"holding a suitcase", []float64{66.4, 66.2, 66.5, 85.0, 66.3, 66.1, 66.4}, DefaultOutlierOptions(), []int{3}, "modified z-score"},
+        {"kid on the scale", []float64{66.4, 25.0, 66.2}, OutlierOptions{MinWeight: 40}, []int{1}, "below 40.00 kg"},
+        {"above bound", []float64{66.4, 120.0}, OutlierOptions{MaxWeight: 100}, []int{1}, "above 100.00 kg"},
+        // the change is from the previous measurement which is not an outlier
+        {"daily change", []float64{66.4, 70.0, 66.6, 66.8}, OutlierOptions{MaxDailyChange: 2}, []int{1}, "changed +3.60 kg in 1.0 days"},
+        {"daily change percent", []float64{66.4, 62.0}, OutlierOptions{MaxDailyChangePercent: 5}, []int{1}, "changed -6.6%"},
+    }
+    for _, tt := range tests {
+        innerscan := dailyData(start, tt.weights...)
+        outliers := DetectOutliers(innerscan.Data, tt.opts)
+        if len(outliers) != len(tt.want) {
+            t.Errorf("%s: got %d outliers, want %d", tt.name, len(outliers), len(tt.want))
+            continue
+        }
+        for i, o := range outliers {
+            if o.Data != innerscan.Data[tt.want[i]] {
+                t.Errorf("%s: outlier %d is %v kg, want %v kg", tt.name, i, o.Data.Weight, tt.weights[tt.want[i]])
+            }
+            if !strings.Contains(o.Reason, tt.reason) {
+                t.Errorf("%s: reason = %q, want %q in it", tt.name, o.Reason, tt.reason)
+            }
+        }
+    }
+}
+
+func TestFilterAndMarkOutliers(t *testing.T) {
+    innerscan := dailyData(time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC), 66.4, 25.0, 66.2)
+    opts := OutlierOptions{MinWeight: 40}
+
+    filtered, outliers := FilterOutliers(innerscan, opts)
+    if len(filtered.Data) != 2 || len(outliers) != 1 || len(innerscan.Data) != 3 {
+        t.Errorf("FilterOutliers kept %d and dropped %d of %d", len(filtered.Data), len(outliers), len(innerscan.Data))
+    }
+
+    MarkOutliers(innerscan, opts)
+    for i, d := range innerscan.Data {
+        if d.Outlier == nil || d.Outlier.Outlier != (i == 1) {
+            t.Errorf("data %d: outlier mark = %+v", i, d.Outlier)
+        }
+    }
+}
+
+func TestOutliersCsv(t *testing.T) {
+    outliers := []*Outlier{
+        {Data: &healthplanet.InnerscanData{Date: time.Date(2025, 4, 1, 7, 30, 0, 0, time.UTC), Model: "01000117", Weight: 85, BMI: 28.7, BodyFat: 20.5}, Reason: `weight 85.00 kg is far from the "usual", by a lot`},
+    }
+    records, err := csv.NewReader(strings.NewReader(OutliersCsv(outliers))).ReadAll()
+    if err != nil {
+        t.Fatalf("OutliersCsv is not valid CSV: %v", err)
+    }
+    want := []string{"2025-04-01 07:30:00", "01000117", "85.000000", "28.700000", "20.500000", outliers[0].Reason}
+    if len(records) != 2 || strings.Join(records[1], "|") != strings.Join(want, "|") {
+        t.Errorf("OutliersCsv = %q, want the header and %q", records, want)
+    }
+}
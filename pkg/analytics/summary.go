@@ -0,0 +1,258 @@
+package analytics
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Summary statistics of the measurements per ISO week, month or year.
+
+For each group, count, min, max, mean and the change from the first to the last measurement
+are reported for the weight, the body fat and BMI.
+A missing body fat or BMI (0, e.g. imported without the height) is not counted.
+
+The mean of a few measurements is not reliable, so a group with less than MinReliableCount
+measurements has a note with the 95% confidence interval of the mean weight.
+The interval is the Student's t interval, which widens for small samples
+in the same spirit as the Wilson interval does for proportions.
+*/
+
+const (
+    GroupWeek = "week"
+    GroupMonth = "month"
+    GroupYear = "year"
+)
+
+// MinReliableCount is the number of measurements under which a group has a confidence note.
+const MinReliableCount = 5
+
+type Stats struct {
+    Count int `json:"count"`
+    Min float64 `json:"min"`
+    Max float64 `json:"max"`
+    Mean float64 `json:"mean"`
+    Change float64 `json:"change"` // last - first
+}
+
+type Summary struct {
+    Group string `json:"group"` // e.g. 2025-W14, 2025-03 or 2025
+    From string `json:"from"`   // first measurement day, YYYY-MM-DD
+    To string `json:"to"`       // last measurement day, YYYY-MM-DD
+    Weight Stats `json:"weight"`
+    BodyFat Stats `json:"body_fat"`
+    BMI Stats `json:"bmi"`
+    Note string `json:"note,omitempty"`
+}
+
+// GroupKey returns the group of the date: YYYY-Www (ISO week), YYYY-MM or YYYY.
+func GroupKey(date time.Time, group string) (string, error) {
+    switch group {
+    case GroupWeek:
+        year, week := date.ISOWeek()
+        return fmt.Sprintf("%04d-W%02d", year, week), nil
+    case GroupMonth:
+        return date.Format("2006-01"), nil
+    case GroupYear:
+        return date.Format("2006"), nil
+    }
+    return "", fmt.Errorf("unknown group %q (use week, month or year)", group)
+}
+
+// newStats returns the statistics of the values in order, ignoring the missing (0) values.
+func newStats(values []float64) Stats {
+    s := Stats{}
+    first, last := 0.0, 0.0
+    sum := 0.0
+    for _, v := range values {
+        if v == 0 {
+            continue
+        }
+        if s.Count == 0 {
+            s.Min, s.Max, first = v, v, v
+        }
+        s.Count++
+        s.Min = math.Min(s.Min, v)
+        s.Max = math.Max(s.Max, v)
+        sum += v
+        last = v
+    }
+    if s.Count > 0 {
+        s.Mean = sum / float64(s.Count)
+        s.Change = last - first
+    }
+    return s
+}
+
+// tCritical returns the two-sided 95% critical value of Student's t distribution.
+func tCritical(df int) float64 {
+    table := []float64{
+        12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+        2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+        2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+    }
+    if df < 1 {
+        return math.Inf(1)
+    }
+    if df <= len(table) {
+        return table[df-1]
+    }
+    return 1.96
+}
+
+// MeanInterval returns the half width of the 95% confidence interval of the mean of the values.
+// ok is false for less than 2 values.
+func MeanInterval(values []float64) (float64, bool) {
+    n := len(values)
+    if n < 2 {
+        return 0, false
+    }
+    mean := 0.0
+    for _, v := range values {
+        mean += v
+    }
+    mean /= float64(n)
+    variance := 0.0
+    for _, v := range values {
+        variance += (v - mean) * (v - mean)
+    }
+    variance /= float64(n - 1)
+    return tCritical(n-1) * math.Sqrt(variance / float64(n)), true
+}
+
+// confidenceNote returns the note for a group with few measurements, or "".
+func confidenceNote(weights []float64) string {
+    n := len(weights)
+    if n >= MinReliableCount {
+        return ""
+    }
+    interval, ok := MeanInterval(weights)
+    if !ok {
+        return "single measurement, no confidence interval"
+    }
+    return fmt.Sprintf("few measurements (n=%d), mean weight ±%.2f kg (95%%)", n, interval)
+}
+
+// Summarize returns the summary of the data per group in order. The data must be sorted by date.
+// The data marked as outliers are not counted.
+func Summarize(innerscan *healthplanet.Innerscan, group string) ([]*Summary, error) {
+    innerscan = innerscan.WithoutOutliers()
+    summaries := make([]*Summary, 0)
+    start := 0
+    for start < len(innerscan.Data) {
+        key, err := GroupKey(innerscan.Data[start].Date, group)
+        if err != nil {
+            return nil, err
+        }
+        end := start + 1
+        for end < len(innerscan.Data) {
+            k, _ := GroupKey(innerscan.Data[end].Date, group)
+            if k != key {
+                break
+            }
+            end++
+        }
+        summaries = append(summaries, summarizeGroup(key, innerscan.Data[start:end]))
+        start = end
+    }
+    return summaries, nil
+}
+
+// SummarizeAll returns the summary of all data as one group named key, or nil for no data.
+func SummarizeAll(innerscan *healthplanet.Innerscan, key string) *Summary {
+    innerscan = innerscan.WithoutOutliers()
+    if len(innerscan.Data) == 0 {
+        return nil
+    }
+    return summarizeGroup(key, innerscan.Data)
+}
+
+func summarizeGroup(key string, data []*healthplanet.InnerscanData) *Summary {
+    weights := make([]float64, 0, len(data))
+    bodyFats := make([]float64, 0, len(data))
+    bmis := make([]float64, 0, len(data))
+    for _, d := range data {
+        weights = append(weights, d.Weight)
+        bodyFats = append(bodyFats, d.BodyFat)
+        bmis = append(bmis, d.BMI)
+    }
+    return &Summary{
+        Group: key,
+        From: data[0].Day(),
+        To: data[len(data)-1].Day(),
+        Weight: newStats(weights),
+        BodyFat: newStats(bodyFats),
+        BMI: newStats(bmis),
+        Note: confidenceNote(weights),
+    }
+}
+
+// SummaryText returns the summaries as a table, with the notes below it.
+func SummaryText(summaries []*Summary) string {
+    if len(summaries) == 0 {
+        return "No data\n"
+    }
+    var b strings.Builder
+    fmt.Fprintf(&b, "%-8s  %3s  %-27s  %-27s  %s\n", "Group", "N", "Weight min/max/mean/chg", "Fat min/max/mean/chg", "BMI min/max/mean/chg")
+    for _, s := range summaries {
+        fmt.Fprintf(&b, "%-8s  %3d  %-27s  %-27s  %s\n", s.Group, s.Weight.Count, s.Weight.text(), s.BodyFat.text(), s.BMI.text())
+    }
+    notes := false
+    for _, s := range summaries {
+        if s.Note == "" {
+            continue
+        }
+        if !notes {
+            b.WriteString("\n")
+            notes = true
+        }
+        fmt.Fprintf(&b, "%s: %s\n", s.Group, s.Note)
+    }
+    return b.String()
+}
+
+func (s Stats) text() string {
+    if s.Count == 0 {
+        return "-"
+    }
+    return fmt.Sprintf("%.1f/%.1f/%.2f/%+.2f", s.Min, s.Max, s.Mean, s.Change)
+}
+
+// SummaryCsv returns the summaries in CSV, one row per group.
+func SummaryCsv(summaries []*Summary) string {
+    var b strings.Builder
+    w := csv.NewWriter(&b)
+    header := []string{"Group", "From", "To"}
+    for _, name := range []string{"Weight", "Fat", "BMI"} {
+        header = append(header, name+"Count", name+"Min", name+"Max", name+"Mean", name+"Change")
+    }
+    w.Write(append(header, "Note"))
+    for _, s := range summaries {
+        row := []string{s.Group, s.From, s.To}
+        for _, st := range []Stats{s.Weight, s.BodyFat, s.BMI} {
+            row = append(row, strconv.Itoa(st.Count), formatCsvFloat(st.Min), formatCsvFloat(st.Max), formatCsvFloat(st.Mean), formatCsvFloat(st.Change))
+        }
+        w.Write(append(row, s.Note))
+    }
+    w.Flush()
+    return b.String()
+}
+
+// formatCsvFloat formats the value as the CSV of the measurements does.
+func formatCsvFloat(v float64) string {
+    return strconv.FormatFloat(v, 'f', 6, 64)
+}
+
+func SummaryJson(summaries []*Summary) (string, error) {
+    data, err := json.MarshalIndent(summaries, "", "  ")
+    if err != nil {
+        return "", err
+    }
+    return string(data) + "\n", nil
+}
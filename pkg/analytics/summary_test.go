@@ -0,0 +1,109 @@
+package analytics
+
+import (
+    "encoding/csv"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// dailyData returns a measurement per day from the start, with the weights (0 is no measurement that day).
+func dailyData(start time.Time, weights ...float64) *healthplanet.Innerscan {
+    innerscan := &healthplanet.Innerscan{}
+    for i, w := range weights {
+        if w == 0 {
+            continue
+        }
+        innerscan.Data = append(innerscan.Data, &healthplanet.InnerscanData{Date: start.AddDate(0, 0, i), Weight: w, BodyFat: 20, BMI: 22})
+    }
+    return innerscan
+}
+
+func TestSummarize(t *testing.T) {
+    // Monday 2025-03-31 to Sunday 2025-04-06 is 2025-W14
+    innerscan := dailyData(time.Date(2025, 3, 30, 7, 0, 0, 0, time.UTC), 70, 69, 68, 0, 67, 66, 65, 64, 63)
+    summaries, err := Summarize(innerscan, GroupWeek)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []struct {
+        group string
+        from string
+        to string
+        count int
+        mean float64
+        change float64
+    }{
+        {"2025-W13", "2025-03-30", "2025-03-30", 1, 70, 0},
+        {"2025-W14", "2025-03-31", "2025-04-06", 6, 66.5, -5},
+        {"2025-W15", "2025-04-07", "2025-04-07", 1, 63, 0},
+    }
+    if len(summaries) != len(want) {
+        t.Fatalf("got %d summaries, want %d", len(summaries), len(want))
+    }
+    for i, w := range want {
+        s := summaries[i]
+        if s.Group != w.group || s.From != w.from || s.To != w.to || s.Weight.Count != w.count || s.Weight.Mean != w.mean || s.Weight.Change != w.change {
+            t.Errorf("summary %d = %s %s..%s n=%d mean=%v change=%v, want %+v", i, s.Group, s.From, s.To, s.Weight.Count, s.Weight.Mean, s.Weight.Change, w)
+        }
+    }
+    if summaries[0].Note != "single measurement, no confidence interval" {
+        t.Errorf("note of a single measurement = %q", summaries[0].Note)
+    }
+}
+
+func TestSummaryCsv(t *testing.T) {
+    innerscan := dailyData(time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC), 66.4, 66.2)
+    summaries, err := Summarize(innerscan, GroupMonth)
+    if err != nil {
+        t.Fatal(err)
+    }
+    summaries = append(summaries, &Summary{Group: "2025-05", From: "2025-05-01", To: "2025-05-01", Note: `a "quoted" note, with a comma`})
+
+    records, err := csv.NewReader(strings.NewReader(SummaryCsv(summaries))).ReadAll()
+    if err != nil {
+        t.Fatalf("SummaryCsv is not valid CSV: %v", err)
+    }
+    if len(records) != 3 || len(records[0]) != 19 || records[0][18] != "Note" {
+        t.Fatalf("SummaryCsv has %d rows, header %v", len(records), records[0])
+    }
+    row := records[1]
+    if row[0] != "2025-04" || row[3] != "2" || row[6] != "66.300000" {
+        t.Errorf("row = %v, want 2025-04 with 2 weights of mean 66.300000", row)
+    }
+    // the note as it is, not escaped as a Go string
+    if row[18] != summaries[0].Note || !strings.Contains(row[18], "±") {
+        t.Errorf("note = %q, want %q", row[18], summaries[0].Note)
+    }
+    if records[2][18] != summaries[1].Note {
+        t.Errorf("note = %q, want %q", records[2][18], summaries[1].Note)
+    }
+}
+
+// TestSummarizeOutliers checks that the measurements marked as outliers are not counted.
+func TestSummarizeOutliers(t *testing.T) {
+    innerscan := dailyData(time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC), 66.4, 33.0, 66.0)
+    MarkOutliers(innerscan, OutlierOptions{MinWeight: 50})
+
+    summaries, err := Summarize(innerscan, GroupMonth)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(summaries) != 1 || summaries[0].Weight.Count != 2 || summaries[0].Weight.Min != 66 || summaries[0].Weight.Mean != 66.2 {
+        t.Errorf("Summarize() = %+v, want 2 measurements without the outlier", summaries[0].Weight)
+    }
+    if all := SummarizeAll(innerscan, "all"); all == nil || all.Weight.Count != 2 {
+        t.Errorf("SummarizeAll() = %+v, want 2 measurements", all)
+    }
+
+    // a group of only outliers has no summary
+    outliers := dailyData(time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC), 33.0)
+    MarkOutliers(outliers, OutlierOptions{MinWeight: 50})
+    if summaries, err := Summarize(outliers, GroupMonth); err != nil || len(summaries) != 0 {
+        t.Errorf("Summarize() of only outliers = %v, %v, want none", summaries, err)
+    }
+    if all := SummarizeAll(outliers, "all"); all != nil {
+        t.Errorf("SummarizeAll() of only outliers = %+v, want nil", all)
+    }
+}
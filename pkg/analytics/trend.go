@@ -0,0 +1,191 @@
+package analytics
+
+import (
+    "fmt"
+    "math"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Trend smoothing of the weight.
+
+Daily scale weight bounces by a kilogram with water and meals, so the trend is what matters.
+Three indicators are calculated for each measurement, using only the measurements up to it:
+
+  - SMA: simple moving average of the measurements in the last SMADays days.
+  - EWMA: exponentially weighted moving average, as the trend line of The Hacker's Diet
+    (trend = previous trend + Alpha * (weight - previous trend)).
+    Alpha is per day, so a gap of n days applies 1 - (1 - Alpha)^n.
+  - Slope: slope of the least-squares linear regression of the measurements in the last SlopeDays days, in kg/week.
+
+The windows are in calendar days, so that missing days do not stretch them.
+
+The rows marked as outliers (MarkOutliers) and the synthetic rows filled by Resample are not measurements to trust,
+so they are not the inputs of the indicators. They have the trend of the last measurement before them,
+and no trend before the first measurement.
+*/
+
+type TrendOptions struct {
+    SMADays int       // window of the simple moving average in days
+    Alpha float64     // smoothing factor of the exponentially weighted moving average per day
+    SlopeDays int     // window of the linear regression in days
+}
+
+func DefaultTrendOptions() TrendOptions {
+    return TrendOptions{
+        SMADays: 7,
+        Alpha: 0.1, // The Hacker's Diet
+        SlopeDays: 28,
+    }
+}
+
+const day = 24 * time.Hour
+const week = 7 * day
+
+// Point is a value at a time.
+type Point struct {
+    Time time.Time
+    Value float64
+}
+
+// WeightPoints returns the weights of the data.
+func WeightPoints(data []*healthplanet.InnerscanData) []Point {
+    points := make([]Point, 0, len(data))
+    for _, d := range data {
+        points = append(points, Point{Time: d.Date, Value: d.Weight})
+    }
+    return points
+}
+
+// inWindow returns the index of the first point within days days before points[i] (inclusive).
+func inWindow(points []Point, i int, days int) int {
+    start := points[i].Time.Add(-time.Duration(days) * day)
+    j := i
+    for j > 0 && points[j-1].Time.After(start) {
+        j--
+    }
+    return j
+}
+
+// SMA returns the simple moving average of the points in the last days days at each point.
+// The points must be sorted by time.
+func SMA(points []Point, days int) []float64 {
+    ret := make([]float64, len(points))
+    for i := range points {
+        sum := 0.0
+        start := inWindow(points, i, days)
+        for _, p := range points[start : i+1] {
+            sum += p.Value
+        }
+        ret[i] = sum / float64(i+1-start)
+    }
+    return ret
+}
+
+// EWMA returns the exponentially weighted moving average at each point, starting from the first value.
+// alpha is the smoothing factor per day. The points must be sorted by time.
+func EWMA(points []Point, alpha float64) []float64 {
+    ret := make([]float64, len(points))
+    for i, p := range points {
+        if i == 0 {
+            ret[i] = p.Value
+            continue
+        }
+        days := p.Time.Sub(points[i-1].Time).Hours() / 24
+        a := 1 - math.Pow(1 - alpha, math.Max(days, 0))
+        ret[i] = ret[i-1] + a * (p.Value - ret[i-1])
+    }
+    return ret
+}
+
+// Regression returns the slope (per week) and the intercept (at the time of the last point)
+// of the least-squares linear regression of the points.
+// ok is false if the slope cannot be decided, e.g. less than 2 points or all at the same time.
+func Regression(points []Point) (slope float64, intercept float64, ok bool) {
+    if len(points) < 2 {
+        return 0, 0, false
+    }
+    origin := points[len(points)-1].Time
+    var sumX, sumY, sumXX, sumXY float64
+    for _, p := range points {
+        x := p.Time.Sub(origin).Hours() / week.Hours()
+        sumX += x
+        sumY += p.Value
+        sumXX += x * x
+        sumXY += x * p.Value
+    }
+    n := float64(len(points))
+    denominator := n * sumXX - sumX * sumX
+    if math.Abs(denominator) < 1e-12 {
+        return 0, 0, false
+    }
+    slope = (n * sumXY - sumX * sumY) / denominator
+    intercept = (sumY - slope * sumX) / n
+    return slope, intercept, true
+}
+
+// Slopes returns the regression slope (per week) of the points in the last days days at each point.
+func Slopes(points []Point, days int) []float64 {
+    ret := make([]float64, len(points))
+    for i := range points {
+        slope, _, _ := Regression(points[inWindow(points, i, days) : i+1])
+        ret[i] = slope
+    }
+    return ret
+}
+
+// ApplyTrend sets the trend of the weight to each data. The data must be sorted by date.
+func ApplyTrend(innerscan *healthplanet.Innerscan, opts TrendOptions) {
+    inputs := make([]*healthplanet.InnerscanData, 0, len(innerscan.Data))
+    for _, d := range innerscan.Data {
+        if !d.Synthetic && !d.IsOutlier() {
+            inputs = append(inputs, d)
+        }
+    }
+    points := WeightPoints(inputs)
+    sma := SMA(points, opts.SMADays)
+    ewma := EWMA(points, opts.Alpha)
+    slopes := Slopes(points, opts.SlopeDays)
+
+    var last *healthplanet.Trend
+    i := 0
+    for _, d := range innerscan.Data {
+        if i < len(inputs) && d == inputs[i] {
+            last = &healthplanet.Trend{
+                SMA: sma[i],
+                EWMA: ewma[i],
+                Slope: slopes[i],
+            }
+            i++
+        }
+        d.Trend = nil
+        if last != nil {
+            trend := *last
+            d.Trend = &trend
+        }
+    }
+}
+
+// TrendText returns the trend of the data as a table with the latest trend at the end.
+// The data must have the trend set by ApplyTrend.
+func TrendText(innerscan *healthplanet.Innerscan, opts TrendOptions) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "%-10s  %7s  %7s  %7s  %12s\n", "Date", "Weight", fmt.Sprintf("SMA%dd", opts.SMADays), "EWMA", "Slope(kg/w)")
+    for _, d := range innerscan.Data {
+        if d.Trend == nil {
+            continue
+        }
+        fmt.Fprintf(&b, "%-10s  %7.2f  %7.2f  %7.2f  %+12.2f\n", d.Day(), d.Weight, d.Trend.SMA, d.Trend.EWMA, d.Trend.Slope)
+    }
+    if len(innerscan.Data) == 0 {
+        b.WriteString("No data\n")
+        return b.String()
+    }
+    latest := innerscan.Data[len(innerscan.Data)-1]
+    if latest.Trend != nil {
+        fmt.Fprintf(&b, "\nTrend at %s: %.2f kg, %+.2f kg/week (last %d days)\n", latest.Day(), latest.Trend.EWMA, latest.Trend.Slope, opts.SlopeDays)
+    }
+    return b.String()
+}
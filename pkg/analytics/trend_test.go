@@ -0,0 +1,62 @@
+package analytics
+
+import (
+    "math"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+func TestTrendIndicators(t *testing.T) {
+    start := time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC)
+    // 1 kg/week down, the second day missing
+    points := WeightPoints(dailyData(start, 70, 0, 70 - 2.0/7, 70 - 3.0/7).Data)
+
+    sma := SMA(points, 2)
+    if math.Abs(sma[1] - (70 - 2.0/7)) > 1e-9 || math.Abs(sma[2] - (70 - 2.5/7)) > 1e-9 {
+        t.Errorf("SMA = %v", sma)
+    }
+    ewma := EWMA(points, 0.5)
+    if ewma[0] != 70 || math.Abs(ewma[1] - (70 - 0.75 * 2.0/7)) > 1e-9 {
+        t.Errorf("EWMA = %v", ewma)
+    }
+    slopes := Slopes(points, 28)
+    if slopes[0] != 0 || math.Abs(slopes[2] + 1) > 1e-9 {
+        t.Errorf("Slopes = %v, want -1 kg/week", slopes)
+    }
+}
+
+func TestApplyTrendExcludesOutliersAndSynthetic(t *testing.T) {
+    start := time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC)
+    innerscan := dailyData(start, 78, 0, 95, 0, 78)
+    MarkOutliers(innerscan, OutlierOptions{MaxWeight: 90})
+    filled, err := Resample(innerscan, FillLinear)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ApplyTrend(filled, DefaultTrendOptions())
+
+    for _, d := range filled.Data {
+        if d.Weight != 78 && d.Weight != 95 {
+            t.Errorf("%s: weight %v is filled from the outlier", d.Day(), d.Weight)
+        }
+        if d.Trend == nil {
+            t.Fatalf("%s: no trend", d.Day())
+        }
+        if d.Trend.SMA != 78 || d.Trend.EWMA != 78 || d.Trend.Slope != 0 {
+            t.Errorf("%s: trend = %+v, want 78 kg flat", d.Day(), *d.Trend)
+        }
+    }
+}
+
+func TestApplyTrendBeforeFirstMeasurement(t *testing.T) {
+    innerscan := dailyData(time.Date(2025, 4, 1, 7, 0, 0, 0, time.UTC), 95, 70, 69)
+    innerscan.Data[0].Outlier = &healthplanet.OutlierMark{Outlier: true}
+    ApplyTrend(innerscan, DefaultTrendOptions())
+    if innerscan.Data[0].Trend != nil {
+        t.Errorf("outlier before the first measurement has trend %+v", *innerscan.Data[0].Trend)
+    }
+    if trend := innerscan.Data[2].Trend; trend == nil || trend.SMA != 69.5 || math.Abs(trend.Slope + 7) > 1e-9 {
+        t.Errorf("trend = %+v, want SMA 69.5 and -7 kg/week", trend)
+    }
+}
@@ -0,0 +1,245 @@
+package archive
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Archive is a local append-only store of the measurements.
+
+HealthPlanet keeps only a limited history, so every fetched measurement is appended to a JSONL file
+(one JSON record per line) to keep the full history independent of the account and the API.
+
+The records are keyed by the measurement timestamp and the device model.
+A record is appended only when its key is new or its measurement values have changed,
+and the last record of the same key wins when the archive is read.
+
+Usage:
+```
+a := archive.Open("archive.jsonl")
+added, err := a.Append(innerscan, "api")
+...
+innerscan, err := a.Innerscan(from, to, time.Local)
+```
+*/
+
+type Record struct {
+    Date time.Time `json:"date"`
+    Model string `json:"model"`
+    Weight float64 `json:"weight"`
+    BodyFat float64 `json:"body_fat"`
+    BMI float64 `json:"bmi"`
+
+    // body information at the measurement, to rebuild the Innerscan offline
+    BirthDate string `json:"birth_date,omitempty"` // YYYY-MM-DD
+    Height float64 `json:"height,omitempty"`
+    Sex string `json:"sex,omitempty"`
+
+    // metadata
+    Source string `json:"source,omitempty"` // where the measurement came from, e.g. "api"
+    ArchivedAt time.Time `json:"archived_at"`
+}
+
+// Key returns the key of the record: the measurement timestamp and the device model.
+func (r *Record) Key() string {
+    return key(r.Date, r.Model)
+}
+
+// DataKey returns the key of the measurement in the archive.
+func DataKey(d *healthplanet.InnerscanData) string {
+    return key(d.Date, d.Model)
+}
+
+func key(date time.Time, model string) string {
+    return date.UTC().Format(time.RFC3339) + " " + model
+}
+
+// sameValues reports whether the records have the same measurement values.
+// The body information is not compared, as a change of the height on HealthPlanet would append the whole history again;
+// the next measurement records the new one.
+func (r *Record) sameValues(o *Record) bool {
+    return r.Weight == o.Weight && r.BodyFat == o.BodyFat && r.BMI == o.BMI
+}
+
+func NewRecord(innerscan *healthplanet.Innerscan, d *healthplanet.InnerscanData, source string) *Record {
+    r := &Record{
+        Date: d.Date,
+        Model: d.Model,
+        Weight: d.Weight,
+        BodyFat: d.BodyFat,
+        BMI: d.BMI,
+        Height: innerscan.Hight,
+        Sex: innerscan.Sex,
+        Source: source,
+    }
+    if !innerscan.BirthDate.IsZero() {
+        r.BirthDate = innerscan.BirthDate.Format("2006-01-02")
+    }
+    return r
+}
+
+func (r *Record) ToInnerscanData(loc *time.Location) *healthplanet.InnerscanData {
+    return &healthplanet.InnerscanData{
+        Date: r.Date.In(loc),
+        Model: r.Model,
+        Weight: r.Weight,
+        BodyFat: r.BodyFat,
+        BMI: r.BMI,
+    }
+}
+
+type Archive struct {
+    Path string
+}
+
+func Open(path string) *Archive {
+    return &Archive{Path: path}
+}
+
+// Load reads all records, keeping the last one for each key, sorted by date.
+// A missing archive file is treated as empty.
+func (a *Archive) Load() ([]*Record, error) {
+    f, err := os.Open(a.Path)
+    if errors.Is(err, os.ErrNotExist) {
+        return []*Record{}, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    records := make(map[string]*Record)
+    scanner := bufio.NewScanner(f)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    line := 0
+    for scanner.Scan() {
+        line++
+        if len(scanner.Bytes()) == 0 {
+            continue
+        }
+        r := &Record{}
+        err = json.Unmarshal(scanner.Bytes(), r)
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse archive %s line %d: %w", a.Path, line, err)
+        }
+        records[r.Key()] = r
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+
+    ret := make([]*Record, 0, len(records))
+    for _, r := range records {
+        ret = append(ret, r)
+    }
+    sort.Slice(ret, func(i, j int) bool {
+        if !ret[i].Date.Equal(ret[j].Date) {
+            return ret[i].Date.Before(ret[j].Date)
+        }
+        return ret[i].Model < ret[j].Model
+    })
+    return ret, nil
+}
+
+// Append appends the measurements which are not in the archive yet or whose values have changed,
+// and returns them.
+func (a *Archive) Append(innerscan *healthplanet.Innerscan, source string) ([]*healthplanet.InnerscanData, error) {
+    existing, err := a.Load()
+    if err != nil {
+        return nil, err
+    }
+    known := make(map[string]*Record, len(existing))
+    for _, r := range existing {
+        known[r.Key()] = r
+    }
+
+    now := time.Now()
+    added := make([]*healthplanet.InnerscanData, 0)
+    var lines []byte
+    for _, d := range innerscan.Data {
+        r := NewRecord(innerscan, d, source)
+        if old, ok := known[r.Key()]; ok && old.sameValues(r) {
+            continue
+        }
+        r.ArchivedAt = now
+        line, err := json.Marshal(r)
+        if err != nil {
+            return nil, err
+        }
+        lines = append(append(lines, line...), '\n')
+        added = append(added, d)
+    }
+    if len(lines) == 0 {
+        return added, nil
+    }
+
+    err = os.MkdirAll(filepath.Dir(a.Path), 0700)
+    if err != nil {
+        return nil, err
+    }
+    f, err := os.OpenFile(a.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    _, err = f.Write(lines)
+    if err != nil {
+        return nil, err
+    }
+    return added, nil
+}
+
+// All returns all archived measurements with dates in loc.
+func (a *Archive) All(loc *time.Location) (*healthplanet.Innerscan, error) {
+    return a.Innerscan(time.Time{}, time.Unix(1<<62, 0), loc)
+}
+
+// Innerscan returns the archived measurements between from and to (inclusive) with dates in loc.
+// The body information (height etc.) is taken from the latest record which has it.
+func (a *Archive) Innerscan(from time.Time, to time.Time, loc *time.Location) (*healthplanet.Innerscan, error) {
+    records, err := a.Load()
+    if err != nil {
+        return nil, err
+    }
+
+    innerscan := &healthplanet.Innerscan{
+        Data: make([]*healthplanet.InnerscanData, 0),
+    }
+    for i, r := range records {
+        if r.Date.Before(from) || r.Date.After(to) {
+            continue
+        }
+        // a measurement imported without the device model is the same as the one from the API at the same time
+        if r.Model == "" && i+1 < len(records) && records[i+1].Date.Equal(r.Date) {
+            continue
+        }
+        innerscan.Data = append(innerscan.Data, r.ToInnerscanData(loc))
+    }
+
+    // imported records may have no body information
+    for i := len(records) - 1; i >= 0; i-- {
+        latest := records[i]
+        if latest.Height == 0 {
+            continue
+        }
+        innerscan.Hight = latest.Height
+        innerscan.Sex = latest.Sex
+        if latest.BirthDate != "" {
+            birthDate, err := time.Parse("2006-01-02", latest.BirthDate)
+            if err != nil {
+                return nil, fmt.Errorf("failed to parse birth date in archive: %w", err)
+            }
+            innerscan.BirthDate = birthDate
+        }
+        break
+    }
+    return innerscan, nil
+}
@@ -0,0 +1,171 @@
+package archive
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+var day = time.Date(2025, 4, 1, 7, 30, 0, 0, time.UTC)
+
+func data(days int, model string, weight float64) *healthplanet.InnerscanData {
+    return &healthplanet.InnerscanData{Date: day.AddDate(0, 0, days), Model: model, Weight: weight, BodyFat: 20.5, BMI: 22.4}
+}
+
+func innerscan(data ...*healthplanet.InnerscanData) *healthplanet.Innerscan {
+    return &healthplanet.Innerscan{
+        BirthDate: time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC),
+        Hight: 172,
+        Sex: "male",
+        Data: data,
+    }
+}
+
+func countLines(t *testing.T, path string) int {
+    t.Helper()
+    content, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return strings.Count(string(content), "\n")
+}
+
+func TestAppend(t *testing.T) {
+    tests := []struct {
+        name string
+        data []*healthplanet.InnerscanData
+        added int
+        lines int
+    }{
+        {"new", []*healthplanet.InnerscanData{data(0, "01000117", 66.4), data(1, "01000117", 66.2)}, 2, 2},
+        {"same values", []*healthplanet.InnerscanData{data(0, "01000117", 66.4), data(1, "01000117", 66.2)}, 0, 2},
+        {"changed value", []*healthplanet.InnerscanData{data(0, "01000117", 66.4), data(1, "01000117", 66.3)}, 1, 3},
+        {"another model at the same time", []*healthplanet.InnerscanData{data(0, "", 66.4)}, 1, 4},
+        {"new day", []*healthplanet.InnerscanData{data(2, "01000117", 66.0)}, 1, 5},
+    }
+    a := Open(filepath.Join(t.TempDir(), "sub", "archive.jsonl"))
+    for _, tt := range tests {
+        added, err := a.Append(innerscan(tt.data...), "api")
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        if len(added) != tt.added {
+            t.Errorf("%s: added %d, want %d", tt.name, len(added), tt.added)
+        }
+        if lines := countLines(t, a.Path); lines != tt.lines {
+            t.Errorf("%s: %d lines, want %d", tt.name, lines, tt.lines)
+        }
+    }
+}
+
+func TestLoad(t *testing.T) {
+    a := Open(filepath.Join(t.TempDir(), "archive.jsonl"))
+
+    records, err := a.Load()
+    if err != nil || len(records) != 0 {
+        t.Fatalf("Load() of a missing archive = %v, %v, want empty", records, err)
+    }
+
+    // the last record of the same key wins, the records are sorted by date and model
+    for _, d := range [][]*healthplanet.InnerscanData{
+        {data(1, "01000117", 66.2), data(0, "01000117", 66.4)},
+        {data(1, "01000117", 66.3)},
+        {data(0, "", 66.4)},
+    } {
+        if _, err := a.Append(innerscan(d...), "api"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    records, err = a.Load()
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []struct {
+        date time.Time
+        model string
+        weight float64
+    }{
+        {day, "", 66.4},
+        {day, "01000117", 66.4},
+        {day.AddDate(0, 0, 1), "01000117", 66.3},
+    }
+    if len(records) != len(want) {
+        t.Fatalf("Load() = %d records, want %d", len(records), len(want))
+    }
+    for i, w := range want {
+        r := records[i]
+        if !r.Date.Equal(w.date) || r.Model != w.model || r.Weight != w.weight {
+            t.Errorf("record %d = %s %q %v, want %s %q %v", i, r.Date, r.Model, r.Weight, w.date, w.model, w.weight)
+        }
+    }
+
+    // a broken line is reported with its line number
+    f, err := os.OpenFile(a.Path, os.O_APPEND|os.O_WRONLY, 0600)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f.WriteString("\n{broken\n")
+    f.Close()
+    if _, err := a.Load(); err == nil || !strings.Contains(err.Error(), "line 6") {
+        t.Errorf("Load() of a broken archive = %v, want an error at line 6", err)
+    }
+}
+
+func TestInnerscan(t *testing.T) {
+    tokyo, err := time.LoadLocation("Asia/Tokyo")
+    if err != nil {
+        t.Fatal(err)
+    }
+    a := Open(filepath.Join(t.TempDir(), "archive.jsonl"))
+    // the imported records have no body information and may have no model
+    imported := &healthplanet.Innerscan{Data: []*healthplanet.InnerscanData{data(0, "", 66.4), data(3, "", 65.9)}}
+    if _, err := a.Append(imported, "import"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := a.Append(innerscan(data(0, "01000117", 66.4), data(1, "01000117", 66.2), data(2, "01000117", 66.0)), "api"); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name string
+        from time.Time
+        to time.Time
+        weights []float64
+    }{
+        // the imported record at the same time as the one from the API is skipped
+        {"all", time.Time{}, day.AddDate(1, 0, 0), []float64{66.4, 66.2, 66.0, 65.9}},
+        {"inclusive", day.AddDate(0, 0, 1), day.AddDate(0, 0, 2), []float64{66.2, 66.0}},
+        {"after", day.AddDate(0, 0, 1).Add(time.Second), day.AddDate(0, 0, 3), []float64{66.0, 65.9}},
+        {"none", day.AddDate(0, 0, 4), day.AddDate(0, 0, 5), nil},
+    }
+    for _, tt := range tests {
+        got, err := a.Innerscan(tt.from, tt.to, tokyo)
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        if len(got.Data) != len(tt.weights) {
+            t.Errorf("%s: %d data, want %d", tt.name, len(got.Data), len(tt.weights))
+            continue
+        }
+        for i, w := range tt.weights {
+            if got.Data[i].Weight != w {
+                t.Errorf("%s: data %d weight = %v, want %v", tt.name, i, got.Data[i].Weight, w)
+            }
+            if got.Data[i].Date.Location() != tokyo {
+                t.Errorf("%s: data %d in %s, want Asia/Tokyo", tt.name, i, got.Data[i].Date.Location())
+            }
+        }
+        // the body information is of the latest record which has it
+        if got.Hight != 172 || got.Sex != "male" || !got.BirthDate.Equal(time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC)) {
+            t.Errorf("%s: body information = %v %q %s", tt.name, got.Hight, got.Sex, got.BirthDate)
+        }
+    }
+
+    all, err := a.All(time.UTC)
+    if err != nil || len(all.Data) != 4 {
+        t.Errorf("All() = %v, %v, want 4 data", all, err)
+    }
+}
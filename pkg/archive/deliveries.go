@@ -0,0 +1,108 @@
+package archive
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Deliveries records the measurements delivered to each sink (MQTT, webhooks etc.), by the key of the archive.
+
+A measurement is pending for a sink until the sink takes it, so a failed delivery is retried by the next run,
+and a measurement is sent again only if its values change. The body information (height etc.) is not part of the values,
+so editing the profile on HealthPlanet does not send the history again.
+The deliveries of an archive are kept next to it, e.g. archive.sinks.json for archive.jsonl.
+
+Usage:
+```
+path := archive.DeliveriesPath(a.Path)
+deliveries, err := archive.LoadDeliveries(path)
+pending := deliveries.Pending("mqtt", innerscan.Data)
+... send pending ...
+deliveries.MarkDelivered("mqtt", pending)
+err = deliveries.Save(path)
+```
+*/
+
+type Deliveries struct {
+    Sinks map[string]map[string]string `json:"sinks"` // sink name -> key of the measurement -> delivered values
+}
+
+// DeliveriesPath returns the deliveries file of the archive.
+func DeliveriesPath(archivePath string) string {
+    return strings.TrimSuffix(archivePath, filepath.Ext(archivePath)) + ".sinks.json"
+}
+
+// LoadDeliveries reads the deliveries file, or returns empty deliveries if it does not exist.
+func LoadDeliveries(path string) (*Deliveries, error) {
+    d := &Deliveries{Sinks: map[string]map[string]string{}}
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return d, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(data, d); err != nil {
+        return nil, fmt.Errorf("invalid deliveries file %s: %w", path, err)
+    }
+    if d.Sinks == nil {
+        d.Sinks = map[string]map[string]string{}
+    }
+    return d, nil
+}
+
+// Save writes the deliveries file.
+func (d *Deliveries) Save(path string) error {
+    data, err := json.Marshal(d)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return err
+    }
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, path)
+}
+
+// Known reports whether anything has been recorded for the sink, i.e. it is not the first run of the sink.
+func (d *Deliveries) Known(sink string) bool {
+    _, ok := d.Sinks[sink]
+    return ok
+}
+
+// Pending returns the data which are not delivered to the sink yet, or whose values have changed since.
+func (d *Deliveries) Pending(sink string, data []*healthplanet.InnerscanData) []*healthplanet.InnerscanData {
+    delivered := d.Sinks[sink]
+    pending := make([]*healthplanet.InnerscanData, 0)
+    for _, m := range data {
+        if delivered[DataKey(m)] != deliveredValues(m) {
+            pending = append(pending, m)
+        }
+    }
+    return pending
+}
+
+// MarkDelivered records the data as delivered to the sink.
+func (d *Deliveries) MarkDelivered(sink string, data []*healthplanet.InnerscanData) {
+    delivered, ok := d.Sinks[sink]
+    if !ok {
+        delivered = map[string]string{}
+        d.Sinks[sink] = delivered
+    }
+    for _, m := range data {
+        delivered[DataKey(m)] = deliveredValues(m)
+    }
+}
+
+func deliveredValues(m *healthplanet.InnerscanData) string {
+    return fmt.Sprintf("%g,%g,%g", m.Weight, m.BodyFat, m.BMI)
+}
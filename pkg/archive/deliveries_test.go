@@ -0,0 +1,111 @@
+package archive
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+func TestDeliveriesPath(t *testing.T) {
+    tests := []struct {
+        archive string
+        want string
+    }{
+        {"archive.jsonl", "archive.sinks.json"},
+        {"/var/lib/tanita2csv/kid.jsonl", "/var/lib/tanita2csv/kid.sinks.json"},
+        {"archive", "archive.sinks.json"},
+    }
+    for _, tt := range tests {
+        if got := DeliveriesPath(tt.archive); got != tt.want {
+            t.Errorf("DeliveriesPath(%q) = %q, want %q", tt.archive, got, tt.want)
+        }
+    }
+}
+
+func TestPending(t *testing.T) {
+    d0, d1 := data(0, "01000117", 66.4), data(1, "01000117", 66.2)
+    changed := data(1, "01000117", 66.3)
+    other := data(1, "", 66.2)
+
+    deliveries := &Deliveries{Sinks: map[string]map[string]string{}}
+    if deliveries.Known("mqtt") {
+        t.Errorf("Known() of a new sink = true")
+    }
+    deliveries.MarkDelivered("mqtt", []*healthplanet.InnerscanData{d0, d1})
+    if !deliveries.Known("mqtt") || deliveries.Known("webhook:0") {
+        t.Errorf("Known() after MarkDelivered = %v, %v, want true, false", deliveries.Known("mqtt"), deliveries.Known("webhook:0"))
+    }
+    // a sink with nothing delivered yet is known after the first run
+    deliveries.MarkDelivered("garmin", nil)
+    if !deliveries.Known("garmin") {
+        t.Errorf("Known() after MarkDelivered of nothing = false")
+    }
+
+    tests := []struct {
+        name string
+        sink string
+        data []*healthplanet.InnerscanData
+        pending []*healthplanet.InnerscanData
+    }{
+        {"delivered", "mqtt", []*healthplanet.InnerscanData{d0, d1}, nil},
+        {"changed values", "mqtt", []*healthplanet.InnerscanData{d0, changed}, []*healthplanet.InnerscanData{changed}},
+        {"other model", "mqtt", []*healthplanet.InnerscanData{other}, []*healthplanet.InnerscanData{other}},
+        {"other sink", "webhook:0", []*healthplanet.InnerscanData{d0, d1}, []*healthplanet.InnerscanData{d0, d1}},
+    }
+    for _, tt := range tests {
+        got := deliveries.Pending(tt.sink, tt.data)
+        if len(got) != len(tt.pending) {
+            t.Errorf("%s: Pending() = %d data, want %d", tt.name, len(got), len(tt.pending))
+            continue
+        }
+        for i := range got {
+            if got[i] != tt.pending[i] {
+                t.Errorf("%s: pending %d = %+v, want %+v", tt.name, i, *got[i], *tt.pending[i])
+            }
+        }
+    }
+}
+
+func TestDeliveriesSave(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "state", "archive.sinks.json")
+
+    deliveries, err := LoadDeliveries(path)
+    if err != nil || deliveries.Known("mqtt") {
+        t.Fatalf("LoadDeliveries() of a missing file = %v, %v, want empty", deliveries, err)
+    }
+    d0 := data(0, "01000117", 66.4)
+    deliveries.MarkDelivered("mqtt", []*healthplanet.InnerscanData{d0})
+    if err := deliveries.Save(path); err != nil {
+        t.Fatal(err)
+    }
+    // written to a temporary file which is renamed
+    if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+        t.Errorf("temporary file is left: %v", err)
+    }
+
+    loaded, err := LoadDeliveries(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if pending := loaded.Pending("mqtt", []*healthplanet.InnerscanData{d0}); len(pending) != 0 {
+        t.Errorf("Pending() after reloading = %d data, want 0", len(pending))
+    }
+
+    // the file is replaced as a whole
+    loaded.MarkDelivered("webhook:0", []*healthplanet.InnerscanData{d0})
+    if err := loaded.Save(path); err != nil {
+        t.Fatal(err)
+    }
+    reloaded, err := LoadDeliveries(path)
+    if err != nil || !reloaded.Known("mqtt") || !reloaded.Known("webhook:0") {
+        t.Errorf("LoadDeliveries() after saving again = %v, %v", reloaded, err)
+    }
+
+    if err := os.WriteFile(path, []byte("{broken"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := LoadDeliveries(path); err == nil {
+        t.Errorf("LoadDeliveries() of a broken file succeeded")
+    }
+}
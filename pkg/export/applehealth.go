@@ -0,0 +1,120 @@
+package export
+
+import (
+    "encoding/xml"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+const (
+    AppleHealthSourceName = "tanita2csv"
+    appleHealthDateFormat = "2006-01-02 15:04:05 -0700"
+
+    BodyMassType = "HKQuantityTypeIdentifierBodyMass"
+    BodyFatPercentageType = "HKQuantityTypeIdentifierBodyFatPercentage"
+    BodyMassIndexType = "HKQuantityTypeIdentifierBodyMassIndex"
+)
+
+type AppleHealthOptions struct {
+    Unit string            // of the body mass: kg or lb
+    SourceVersion string   // version of tanita2csv in the records
+    ExportDate time.Time   // zero is now
+    Locale string          // default: en_US
+}
+
+type appleValue struct {
+    Value string `xml:"value,attr"`
+}
+
+type appleMe struct {
+    DateOfBirth string `xml:"HKCharacteristicTypeIdentifierDateOfBirth,attr"`
+    BiologicalSex string `xml:"HKCharacteristicTypeIdentifierBiologicalSex,attr"`
+}
+
+type appleRecord struct {
+    Type string `xml:"type,attr"`
+    SourceName string `xml:"sourceName,attr"`
+    SourceVersion string `xml:"sourceVersion,attr,omitempty"`
+    Unit string `xml:"unit,attr"`
+    CreationDate string `xml:"creationDate,attr"`
+    StartDate string `xml:"startDate,attr"`
+    EndDate string `xml:"endDate,attr"`
+    Value string `xml:"value,attr"`
+}
+
+type appleHealthData struct {
+    XMLName xml.Name `xml:"HealthData"`
+    Locale string `xml:"locale,attr"`
+    ExportDate appleValue `xml:"ExportDate"`
+    Me appleMe `xml:"Me"`
+    Records []appleRecord `xml:"Record"`
+}
+
+// appleBiologicalSex returns the HKBiologicalSex of the sex of HealthPlanet.
+func appleBiologicalSex(sex string) string {
+    switch sex {
+    case "male":
+        return "HKBiologicalSexMale"
+    case "female":
+        return "HKBiologicalSexFemale"
+    }
+    return "HKBiologicalSexNotSet"
+}
+
+// AppleHealthXML returns the data as export.xml of Apple Health, with a record of each value of each measurement:
+//
+//     <Record type="HKQuantityTypeIdentifierBodyMass" sourceName="tanita2csv" unit="kg" ... value="66.46"></Record>
+//     <Record type="HKQuantityTypeIdentifierBodyFatPercentage" sourceName="tanita2csv" unit="%" ... value="0.2062"></Record>
+//     <Record type="HKQuantityTypeIdentifierBodyMassIndex" sourceName="tanita2csv" unit="count" ... value="22.46"></Record>
+//
+// As in HealthKit, the body fat percentage is a fraction (0.2062 for 20.62%) and BMI has the unit "count".
+// The dates are of the measurement, with the offset of its location. The birth date and the sex are in the Me element.
+func AppleHealthXML(innerscan *healthplanet.Innerscan, opts AppleHealthOptions) (string, error) {
+    if opts.ExportDate.IsZero() {
+        opts.ExportDate = time.Now()
+    }
+    if opts.Locale == "" {
+        opts.Locale = "en_US"
+    }
+    if opts.Unit == "" {
+        opts.Unit = UnitKg
+    }
+
+    data := &appleHealthData{
+        Locale: opts.Locale,
+        ExportDate: appleValue{opts.ExportDate.Format(appleHealthDateFormat)},
+        Me: appleMe{BiologicalSex: appleBiologicalSex(innerscan.Sex)},
+    }
+    if !innerscan.BirthDate.IsZero() {
+        data.Me.DateOfBirth = innerscan.BirthDate.Format("2006-01-02")
+    }
+
+    for _, d := range innerscan.Data {
+        date := d.Date.Format(appleHealthDateFormat)
+        record := func(typ string, unit string, value string) {
+            data.Records = append(data.Records, appleRecord{
+                Type: typ,
+                SourceName: AppleHealthSourceName,
+                SourceVersion: opts.SourceVersion,
+                Unit: unit,
+                CreationDate: date,
+                StartDate: date,
+                EndDate: date,
+                Value: value,
+            })
+        }
+        record(BodyMassType, opts.Unit, formatRounded(convertWeight(d.Weight, opts.Unit), 2))
+        if d.BodyFat != 0 {
+            record(BodyFatPercentageType, "%", formatRounded(d.BodyFat / 100, 4))
+        }
+        if d.BMI != 0 {
+            record(BodyMassIndexType, "count", formatRounded(d.BMI, 2))
+        }
+    }
+
+    body, err := xml.MarshalIndent(data, "", " ")
+    if err != nil {
+        return "", err
+    }
+    return xml.Header + string(body) + "\n", nil
+}
@@ -0,0 +1,52 @@
+package export
+
+import (
+    "math"
+    "strconv"
+)
+
+/*
+Exports of the measurements in the formats which other platforms import.
+
+    FitbitCsv       the body section of the Fitbit data export (Date,Weight,BMI,Fat), one row per day
+    WithingsCsv     weight.csv of the Withings data export, with the fat mass in the weight unit
+    AppleHealthXML  export.xml of Apple Health, BodyMass, BodyFatPercentage and BodyMassIndex records
+
+Each follows the conventions of the platform: the weight in the unit of the account (kg or lb),
+the body fat in percent (Fitbit), as mass (Withings) or as a fraction (Apple Health),
+and the dates in the format of the platform in the location of the data.
+The missing (0) values are left out as the platform does.
+
+Usage:
+```
+content := export.FitbitCsv(innerscan.UniqByDay(), export.UnitLb)
+content := export.WithingsCsv(innerscan, export.UnitKg)
+content, err := export.AppleHealthXML(innerscan, export.AppleHealthOptions{Unit: export.UnitKg, ExportDate: time.Now()})
+```
+*/
+
+const (
+    UnitKg = "kg"
+    UnitLb = "lb"
+
+    kgPerLb = 0.45359237
+)
+
+// ValidUnit reports whether the unit is a weight unit of the exports.
+func ValidUnit(unit string) bool {
+    return unit == UnitKg || unit == UnitLb
+}
+
+// convertWeight converts the weight in kg into the unit.
+func convertWeight(kg float64, unit string) float64 {
+    if unit == UnitLb {
+        return kg / kgPerLb
+    }
+    return kg
+}
+
+// formatRounded formats the value rounded to the digits, without trailing zeros, e.g. 66.5 for 66.50.
+func formatRounded(v float64, digits int) string {
+    p := math.Pow(10, float64(digits))
+    return strconv.FormatFloat(math.Round(v * p) / p, 'f', -1, 64)
+}
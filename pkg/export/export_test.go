@@ -0,0 +1,109 @@
+package export
+
+import (
+    "encoding/xml"
+    "flag"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// testInnerscan returns measurements in Tokyo: two on 2025-04-01, one without the body fat, and one after a missing day.
+func testInnerscan(t *testing.T) *healthplanet.Innerscan {
+    tokyo, err := time.LoadLocation("Asia/Tokyo")
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &healthplanet.Innerscan{
+        BirthDate: time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC),
+        Hight: 172,
+        Sex: "female",
+        Data: []*healthplanet.InnerscanData{
+            {Date: time.Date(2025, 4, 1, 7, 32, 0, 0, tokyo), Model: "01000117", Weight: 66.46, BodyFat: 20.62, BMI: 22.46},
+            {Date: time.Date(2025, 4, 1, 22, 5, 0, 0, tokyo), Model: "01000117", Weight: 67.1, BodyFat: 20.9, BMI: 22.68},
+            {Date: time.Date(2025, 4, 2, 7, 30, 0, 0, tokyo), Model: "01000117", Weight: 66.2, BMI: 22.38},
+            {Date: time.Date(2025, 4, 4, 6, 58, 0, 0, tokyo), Model: "01000117", Weight: 65.95, BodyFat: 20.4, BMI: 22.29},
+        },
+    }
+}
+
+// checkGolden compares the content with testdata/name byte for byte, or writes it with -update.
+func checkGolden(t *testing.T, name string, content string) {
+    t.Helper()
+    path := filepath.Join("testdata", name)
+    if *update {
+        if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+            t.Fatal(err)
+        }
+        return
+    }
+    want, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if content != string(want) {
+        t.Errorf("%s differs from the golden file:\n%s\nwant:\n%s", name, content, want)
+    }
+}
+
+func TestExportGolden(t *testing.T) {
+    exportDate := time.Date(2025, 4, 5, 9, 0, 0, 0, time.FixedZone("JST", 9 * 60 * 60))
+    for _, unit := range []string{UnitKg, UnitLb} {
+        innerscan := testInnerscan(t)
+        checkGolden(t, "fitbit-" + unit + ".golden", FitbitCsv(innerscan.UniqByDay(), unit))
+        checkGolden(t, "withings-" + unit + ".golden", WithingsCsv(innerscan, unit))
+        content, err := AppleHealthXML(innerscan, AppleHealthOptions{Unit: unit, SourceVersion: "1.0.0", ExportDate: exportDate})
+        if err != nil {
+            t.Fatal(err)
+        }
+        checkGolden(t, "apple-health-" + unit + ".golden", content)
+    }
+}
+
+func TestAppleHealthDefaults(t *testing.T) {
+    innerscan := &healthplanet.Innerscan{Data: []*healthplanet.InnerscanData{{Date: time.Date(2025, 4, 1, 7, 30, 0, 0, time.UTC), Weight: 66.4}}}
+    before := time.Now().Truncate(time.Second)
+    content, err := AppleHealthXML(innerscan, AppleHealthOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    data := &appleHealthData{}
+    if err := xml.Unmarshal([]byte(content), data); err != nil {
+        t.Fatal(err)
+    }
+    exportDate, err := time.Parse(appleHealthDateFormat, data.ExportDate.Value)
+    if err != nil || exportDate.Before(before) || exportDate.After(time.Now()) {
+        t.Errorf("export date = %s, want now", data.ExportDate.Value)
+    }
+    if data.Locale != "en_US" || data.Me.BiologicalSex != "HKBiologicalSexNotSet" || data.Me.DateOfBirth != "" {
+        t.Errorf("locale = %q, me = %+v", data.Locale, data.Me)
+    }
+    if len(data.Records) != 1 || data.Records[0].Unit != UnitKg || data.Records[0].Value != "66.4" || data.Records[0].SourceVersion != "" {
+        t.Errorf("records = %+v, want the body mass in kg only", data.Records)
+    }
+}
+
+func TestConvertWeight(t *testing.T) {
+    tests := []struct {
+        kg float64
+        unit string
+        want string
+    }{
+        {66.46, UnitKg, "66.46"},
+        {66.46, UnitLb, "146.52"},
+        {0.45359237, UnitLb, "1"},
+        {100, UnitLb, "220.46"},
+    }
+    for _, tt := range tests {
+        if got := formatRounded(convertWeight(tt.kg, tt.unit), 2); got != tt.want {
+            t.Errorf("%v kg in %s = %s, want %s", tt.kg, tt.unit, got, tt.want)
+        }
+    }
+    if !ValidUnit(UnitKg) || !ValidUnit(UnitLb) || ValidUnit("st") {
+        t.Errorf("ValidUnit accepts kg and lb only")
+    }
+}
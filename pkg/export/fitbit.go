@@ -0,0 +1,29 @@
+package export
+
+import (
+    "fmt"
+    "strings"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// FitbitCsv returns the data in the body section of the Fitbit data export, which fitbit.com imports:
+//
+//     Body
+//     Date,Weight,BMI,Fat
+//     "2025-04-01","146.5","22.46","20.6"
+//
+// The weight is in the unit of the Fitbit account (kg with 2 decimals, lb with 1), the fat is in percent and "0.0" if unknown.
+// Fitbit keeps one weight per day, so the data should be unified per day (Innerscan.UniqByDay).
+func FitbitCsv(innerscan *healthplanet.Innerscan, unit string) string {
+    weightFormat := "%.2f"
+    if unit == UnitLb {
+        weightFormat = "%.1f"
+    }
+
+    var b strings.Builder
+    b.WriteString("Body\nDate,Weight,BMI,Fat\n")
+    for _, d := range innerscan.Data {
+        fmt.Fprintf(&b, "\"%s\",\"" + weightFormat + "\",\"%.2f\",\"%.1f\"\n", d.Date.Format("2006-01-02"), convertWeight(d.Weight, unit), d.BMI, d.BodyFat)
+    }
+    return b.String()
+}
@@ -0,0 +1,28 @@
+package export
+
+import (
+    "fmt"
+    "strings"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// WithingsCsv returns the data in the layout of weight.csv of the Withings data export, which Withings imports:
+//
+//     Date,"Weight (kg)","Fat mass (kg)","Bone mass (kg)","Muscle mass (kg)","Hydration (kg)",Comments
+//     "2025-04-01 07:32:00",66.46,13.7,,,,
+//
+// Every measurement is a row with its time. Withings has the fat as mass, so it is calculated from the body fat percentage
+// and left empty if unknown. The masses are in the unit (kg or lb), which is also in the header.
+// The bone and muscle masses and the hydration are not measured by Innerscan and left empty.
+func WithingsCsv(innerscan *healthplanet.Innerscan, unit string) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "Date,\"Weight (%[1]s)\",\"Fat mass (%[1]s)\",\"Bone mass (%[1]s)\",\"Muscle mass (%[1]s)\",\"Hydration (%[1]s)\",Comments\n", unit)
+    for _, d := range innerscan.Data {
+        fatMass := ""
+        if d.BodyFat != 0 {
+            fatMass = formatRounded(convertWeight(d.Weight * d.BodyFat / 100, unit), 2)
+        }
+        fmt.Fprintf(&b, "\"%s\",%s,%s,,,,\n", d.Date.Format("2006-01-02 15:04:05"), formatRounded(convertWeight(d.Weight, unit), 2), fatMass)
+    }
+    return b.String()
+}
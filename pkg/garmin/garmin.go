@@ -0,0 +1,306 @@
+package garmin
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime/multipart"
+    "net/http"
+    "net/http/cookiejar"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Upload of the measurements to Garmin Connect, instead of the "Import Data" page of the web UI.
+
+Client POSTs the CSV of dump (Csv) to the upload endpoint as a multipart form with the field "file",
+in the session of the cookies. The session is either given (e.g. copied from a browser) or made by a form login:
+the username and the password are POSTed to the login URL when the upload is unauthorized (401 or 403),
+and the upload is retried once.
+
+State keeps the session cookies and the uploaded days between the runs. UploadNew uploads only the days
+which are not uploaded with the same values, so that a day is not imported twice;
+409 (the server has the same file) is also taken as uploaded.
+
+Uploader is what UploadNew needs, so that it can be run against garmintest.Server or another service.
+
+Usage:
+```
+state, err := garmin.LoadState("garmin.json")
+c := garmin.NewClient("https://example.com/upload")
+c.SetCookies(state.Cookies)
+result, err := garmin.UploadNew(ctx, c, state, innerscan.Data)
+state.Cookies = c.Cookies()
+err = state.Save("garmin.json")
+```
+*/
+
+type Uploader interface {
+    // Upload uploads the content as a file named filename.
+    // It returns ErrDuplicate if the server already has the file.
+    Upload(ctx context.Context, filename string, content []byte) error
+}
+
+var (
+    ErrDuplicate = errors.New("[Garmin]the file is already uploaded")
+    ErrUnauthorized = errors.New("[Garmin]unauthorized, the session is missing or expired")
+)
+
+// StatusError is the error of an unexpected response.
+type StatusError struct {
+    StatusCode int
+    Status string
+    Body string
+}
+
+func (e *StatusError) Error() string {
+    if e.Body == "" {
+        return "[Garmin]" + e.Status
+    }
+    return fmt.Sprintf("[Garmin]%s: %s", e.Status, e.Body)
+}
+
+// Cookie is a session cookie kept in State.
+type Cookie struct {
+    Name string `json:"name"`
+    Value string `json:"value"`
+}
+
+// ParseCookies parses a Cookie header value, e.g. "SESSIONID=abc; JWT=def".
+func ParseCookies(header string) []Cookie {
+    req := &http.Request{Header: http.Header{"Cookie": {header}}}
+    var cookies []Cookie
+    for _, c := range req.Cookies() {
+        cookies = append(cookies, Cookie{Name: c.Name, Value: c.Value})
+    }
+    return cookies
+}
+
+type Client struct {
+    UploadURL string
+    LoginURL string             // form login, empty if the session is given by the cookies
+    Username string
+    Password string
+    Headers map[string]string   // additional headers of the requests
+    HTTPClient *http.Client     // keeps the cookies in its Jar
+}
+
+func NewClient(uploadURL string) *Client {
+    jar, _ := cookiejar.New(nil)
+    return &Client{
+        UploadURL: uploadURL,
+        HTTPClient: &http.Client{Timeout: 60 * time.Second, Jar: jar},
+    }
+}
+
+// Cookies returns the cookies of the session sent to the upload URL.
+func (c *Client) Cookies() []Cookie {
+    u, err := url.Parse(c.UploadURL)
+    if err != nil {
+        return nil
+    }
+    var cookies []Cookie
+    for _, cookie := range c.HTTPClient.Jar.Cookies(u) {
+        cookies = append(cookies, Cookie{Name: cookie.Name, Value: cookie.Value})
+    }
+    return cookies
+}
+
+// SetCookies sets the cookies of the session for the upload URL.
+func (c *Client) SetCookies(cookies []Cookie) {
+    u, err := url.Parse(c.UploadURL)
+    if err != nil || len(cookies) == 0 {
+        return
+    }
+    httpCookies := make([]*http.Cookie, len(cookies))
+    for i, cookie := range cookies {
+        httpCookies[i] = &http.Cookie{Name: cookie.Name, Value: cookie.Value, Path: "/"}
+    }
+    c.HTTPClient.Jar.SetCookies(u, httpCookies)
+}
+
+// Upload uploads the file, logging in and retrying once if the session is missing or expired.
+func (c *Client) Upload(ctx context.Context, filename string, content []byte) error {
+    err := c.upload(ctx, filename, content)
+    if !errors.Is(err, ErrUnauthorized) || c.LoginURL == "" {
+        return err
+    }
+    if err := c.Login(ctx); err != nil {
+        return err
+    }
+    return c.upload(ctx, filename, content)
+}
+
+func (c *Client) upload(ctx context.Context, filename string, content []byte) error {
+    var body bytes.Buffer
+    form := multipart.NewWriter(&body)
+    part, err := form.CreateFormFile("file", filename)
+    if err != nil {
+        return err
+    }
+    part.Write(content)
+    if err := form.Close(); err != nil {
+        return err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.UploadURL, &body)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", form.FormDataContentType())
+    return c.do(req)
+}
+
+// Login POSTs the username and the password as a form, and keeps the session cookies set by the response.
+func (c *Client) Login(ctx context.Context) error {
+    form := url.Values{"username": {c.Username}, "password": {c.Password}}
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.LoginURL, strings.NewReader(form.Encode()))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    if err := c.do(req); err != nil {
+        if errors.Is(err, ErrUnauthorized) {
+            return fmt.Errorf("[Garmin]login failed, check the username and the password: %w", err)
+        }
+        return fmt.Errorf("[Garmin]login failed: %w", err)
+    }
+    if len(c.Cookies()) == 0 {
+        return errors.New("[Garmin]login did not set a session cookie for the upload URL")
+    }
+    return nil
+}
+
+func (c *Client) do(req *http.Request) error {
+    for k, v := range c.Headers {
+        req.Header.Set(k, v)
+    }
+    resp, err := c.HTTPClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+    if resp.StatusCode / 100 == 2 {
+        return nil
+    }
+
+    statusErr := &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(respBody))}
+    switch resp.StatusCode {
+    case http.StatusConflict:
+        return ErrDuplicate
+    case http.StatusUnauthorized, http.StatusForbidden:
+        return fmt.Errorf("%w: %w", ErrUnauthorized, statusErr)
+    }
+    return statusErr
+}
+
+// Csv returns the data in the CSV of dump without the optional columns, which Garmin Connect imports.
+func Csv(data []*healthplanet.InnerscanData) string {
+    plain := &healthplanet.Innerscan{Data: make([]*healthplanet.InnerscanData, len(data))}
+    for i, d := range data {
+        plain.Data[i] = &healthplanet.InnerscanData{Date: d.Date, Weight: d.Weight, BMI: d.BMI, BodyFat: d.BodyFat}
+    }
+    return healthplanet.CsvPreamble + "\n" + plain.ToCsv()
+}
+
+// State is what the uploads keep between the runs.
+type State struct {
+    Cookies []Cookie `json:"cookies,omitempty"`
+    Uploaded map[string]string `json:"uploaded"` // key: day (YYYY-MM-DD), value: the uploaded values of the day
+}
+
+// LoadState reads the state file, or returns an empty state if it does not exist.
+func LoadState(path string) (*State, error) {
+    state := &State{Uploaded: map[string]string{}}
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return state, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(data, state); err != nil {
+        return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+    }
+    if state.Uploaded == nil {
+        state.Uploaded = map[string]string{}
+    }
+    return state, nil
+}
+
+// Save writes the state file. It is private, as the cookies are the credentials of the session.
+func (s *State) Save(path string) error {
+    data, err := json.MarshalIndent(s, "", "  ")
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return err
+    }
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, path)
+}
+
+// values returns the uploaded values of the day, as written in the CSV.
+func values(d *healthplanet.InnerscanData) string {
+    return fmt.Sprintf("%f,%f,%f", d.Weight, d.BMI, d.BodyFat)
+}
+
+// Pending returns the days of the data which are not uploaded with the same values, one measurement per day.
+func (s *State) Pending(data []*healthplanet.InnerscanData) []*healthplanet.InnerscanData {
+    daily := (&healthplanet.Innerscan{Data: data}).UniqByDay()
+    var pending []*healthplanet.InnerscanData
+    for _, d := range daily.Data {
+        if s.Uploaded[d.Day()] != values(d) {
+            pending = append(pending, d)
+        }
+    }
+    return pending
+}
+
+func (s *State) markUploaded(data []*healthplanet.InnerscanData) {
+    for _, d := range data {
+        s.Uploaded[d.Day()] = values(d)
+    }
+}
+
+// Result is the result of UploadNew.
+type Result struct {
+    Uploaded int    // days in the uploaded file
+    Skipped int     // days skipped as uploaded before
+    Duplicate bool  // the server already had the file
+}
+
+// UploadNew uploads the pending days of the data in one file and records them in the state.
+// Nothing is uploaded if every day is uploaded before.
+func UploadNew(ctx context.Context, u Uploader, state *State, data []*healthplanet.InnerscanData) (*Result, error) {
+    pending := state.Pending(data)
+    days := len((&healthplanet.Innerscan{Data: data}).UniqByDay().Data)
+    result := &Result{Skipped: days - len(pending)}
+    if len(pending) == 0 {
+        return result, nil
+    }
+
+    filename := fmt.Sprintf("tanita2csv-%s-%s.csv", pending[0].Date.Format("20060102"), pending[len(pending)-1].Date.Format("20060102"))
+    err := u.Upload(ctx, filename, []byte(Csv(pending)))
+    if errors.Is(err, ErrDuplicate) {
+        result.Duplicate = true
+    } else if err != nil {
+        return result, err
+    }
+    state.markUploaded(pending)
+    result.Uploaded = len(pending)
+    return result, nil
+}
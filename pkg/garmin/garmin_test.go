@@ -0,0 +1,251 @@
+package garmin
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/garmin/garmintest"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// testData returns a measurement per day from 2025-04-01, with the weights.
+func testData(weights ...float64) []*healthplanet.InnerscanData {
+    data := make([]*healthplanet.InnerscanData, len(weights))
+    start := time.Date(2025, 4, 1, 7, 30, 0, 0, time.UTC)
+    for i, w := range weights {
+        data[i] = &healthplanet.InnerscanData{Date: start.AddDate(0, 0, i), Model: "01000117", Weight: w, BodyFat: 20.5, BMI: 22.4}
+    }
+    return data
+}
+
+func newTestClient(s *garmintest.Server, password string) *Client {
+    c := NewClient(s.UploadURL())
+    c.LoginURL, c.Username, c.Password = s.LoginURL(), "user", password
+    return c
+}
+
+func TestUploadLogin(t *testing.T) {
+    s := garmintest.NewServer("user", "pass")
+    defer s.Close()
+    ctx := context.Background()
+
+    // no session: log in and retry
+    c := newTestClient(s, "pass")
+    if err := c.Upload(ctx, "a.csv", []byte(Csv(testData(66.4)))); err != nil {
+        t.Fatal(err)
+    }
+    if s.Logins() != 1 || len(s.Uploads()) != 1 {
+        t.Errorf("%d logins and %d uploads, want 1 and 1", s.Logins(), len(s.Uploads()))
+    }
+
+    // the session is kept
+    if err := c.Upload(ctx, "b.csv", []byte(Csv(testData(66.2)))); err != nil {
+        t.Fatal(err)
+    }
+    if s.Logins() != 1 {
+        t.Errorf("%d logins with a valid session, want 1", s.Logins())
+    }
+
+    // an expired session: log in again
+    s.ExpireSessions()
+    if err := c.Upload(ctx, "c.csv", []byte(Csv(testData(66.0)))); err != nil {
+        t.Fatal(err)
+    }
+    if s.Logins() != 2 || len(s.Uploads()) != 3 {
+        t.Errorf("%d logins and %d uploads, want 2 and 3", s.Logins(), len(s.Uploads()))
+    }
+}
+
+func TestUploadLoginFailed(t *testing.T) {
+    s := garmintest.NewServer("user", "pass")
+    defer s.Close()
+    ctx := context.Background()
+
+    err := newTestClient(s, "wrong").Upload(ctx, "a.csv", []byte(Csv(testData(66.4))))
+    if !errors.Is(err, ErrUnauthorized) || !strings.Contains(err.Error(), "login failed") {
+        t.Errorf("Upload with a wrong password = %v, want the login error", err)
+    }
+
+    // without the login URL, the session must be given
+    c := NewClient(s.UploadURL())
+    err = c.Upload(ctx, "a.csv", []byte(Csv(testData(66.4))))
+    if !errors.Is(err, ErrUnauthorized) {
+        t.Errorf("Upload without a session = %v, want %v", err, ErrUnauthorized)
+    }
+    c.SetCookies([]Cookie{{Name: garmintest.SessionCookie, Value: s.NewSession()}})
+    if err := c.Upload(ctx, "a.csv", []byte(Csv(testData(66.4)))); err != nil {
+        t.Errorf("Upload with the session cookie = %v", err)
+    }
+    if s.Logins() != 0 || len(s.Uploads()) != 1 {
+        t.Errorf("%d logins and %d uploads, want 0 and 1", s.Logins(), len(s.Uploads()))
+    }
+}
+
+func TestUploadRetriesOnce(t *testing.T) {
+    var logins, uploads int
+    mux := http.NewServeMux()
+    mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+        logins++
+        http.SetCookie(w, &http.Cookie{Name: "SESSIONID", Value: "abc", Path: "/"})
+    })
+    // the session is never accepted
+    mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+        uploads++
+        http.Error(w, "forbidden", http.StatusForbidden)
+    })
+    s := httptest.NewServer(mux)
+    defer s.Close()
+
+    c := NewClient(s.URL + "/upload")
+    c.LoginURL = s.URL + "/login"
+    err := c.Upload(context.Background(), "a.csv", []byte("x"))
+    var statusErr *StatusError
+    if !errors.Is(err, ErrUnauthorized) || !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+        t.Errorf("Upload = %v, want the unauthorized error", err)
+    }
+    if logins != 1 || uploads != 2 {
+        t.Errorf("%d logins and %d uploads, want 1 login and 1 retry", logins, uploads)
+    }
+}
+
+func TestUploadErrors(t *testing.T) {
+    s := garmintest.NewServer("user", "pass")
+    defer s.Close()
+    ctx := context.Background()
+    c := newTestClient(s, "pass")
+    content := []byte(Csv(testData(66.4)))
+
+    if err := c.Upload(ctx, "a.csv", content); err != nil {
+        t.Fatal(err)
+    }
+    // 409 is a duplicate
+    if err := c.Upload(ctx, "b.csv", content); !errors.Is(err, ErrDuplicate) {
+        t.Errorf("Upload of the same content = %v, want %v", err, ErrDuplicate)
+    }
+    var statusErr *StatusError
+    err := c.Upload(ctx, "a.txt", content)
+    if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest || !strings.Contains(statusErr.Body, "unsupported file type") {
+        t.Errorf("Upload of a text file = %v, want 400", err)
+    }
+}
+
+func TestStatePending(t *testing.T) {
+    state := &State{Uploaded: map[string]string{}}
+    data := testData(66.4, 66.2, 66.0)
+    // a later measurement of the same day
+    evening := &healthplanet.InnerscanData{Date: data[2].Date.Add(12 * time.Hour), Weight: 66.6, BodyFat: 20.5, BMI: 22.4}
+    data = append(data, evening)
+
+    if pending := state.Pending(data); len(pending) != 3 || pending[2] != evening {
+        t.Fatalf("Pending of the new state = %d days, want 3 with the last measurement of the day", len(pending))
+    }
+    state.markUploaded(state.Pending(data))
+    if pending := state.Pending(data); len(pending) != 0 {
+        t.Errorf("Pending after the upload = %d days, want 0", len(pending))
+    }
+
+    // a changed day is uploaded again
+    data[0].Weight = 66.5
+    if pending := state.Pending(data); len(pending) != 1 || pending[0] != data[0] {
+        t.Errorf("Pending after a change = %d days, want the changed day", len(pending))
+    }
+}
+
+func TestStateSaveAndLoad(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "state", "garmin.json")
+
+    state, err := LoadState(path)
+    if err != nil || len(state.Uploaded) != 0 || len(state.Cookies) != 0 {
+        t.Fatalf("LoadState of no file = %+v, %v, want an empty state", state, err)
+    }
+    state.Cookies = ParseCookies("SESSIONID=abc; JWT=def")
+    state.markUploaded(testData(66.4, 66.2))
+    if err := state.Save(path); err != nil {
+        t.Fatal(err)
+    }
+    info, err := os.Stat(path)
+    if err != nil || info.Mode().Perm() != 0600 {
+        t.Errorf("state file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+    }
+
+    loaded, err := LoadState(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(loaded.Cookies) != 2 || loaded.Cookies[0] != (Cookie{"SESSIONID", "abc"}) || loaded.Cookies[1] != (Cookie{"JWT", "def"}) {
+        t.Errorf("cookies = %+v", loaded.Cookies)
+    }
+    if len(loaded.Uploaded) != 2 || loaded.Uploaded["2025-04-02"] != "66.200000,22.400000,20.500000" {
+        t.Errorf("uploaded = %+v", loaded.Uploaded)
+    }
+    if pending := loaded.Pending(testData(66.4, 66.2, 66.0)); len(pending) != 1 {
+        t.Errorf("Pending of the loaded state = %d days, want 1", len(pending))
+    }
+
+    if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := LoadState(path); err == nil {
+        t.Errorf("LoadState of an invalid file succeeded")
+    }
+}
+
+func TestUploadNew(t *testing.T) {
+    s := garmintest.NewServer("user", "pass")
+    defer s.Close()
+    ctx := context.Background()
+    c := newTestClient(s, "pass")
+    state := &State{Uploaded: map[string]string{}}
+
+    tests := []struct {
+        data []*healthplanet.InnerscanData
+        result Result
+        uploads int
+        filename string
+    }{
+        {testData(66.4, 66.2, 66.0), Result{Uploaded: 3}, 1, "tanita2csv-20250401-20250403.csv"},
+        // only the new day
+        {testData(66.4, 66.2, 66.0, 65.8), Result{Uploaded: 1, Skipped: 3}, 2, "tanita2csv-20250404-20250404.csv"},
+        // nothing to upload
+        {testData(66.4, 66.2, 66.0, 65.8), Result{Skipped: 4}, 2, ""},
+    }
+    for i, tt := range tests {
+        result, err := UploadNew(ctx, c, state, tt.data)
+        if err != nil {
+            t.Fatalf("run %d: %v", i, err)
+        }
+        if *result != tt.result {
+            t.Errorf("run %d: result = %+v, want %+v", i, *result, tt.result)
+        }
+        uploads := s.Uploads()
+        if len(uploads) != tt.uploads {
+            t.Fatalf("run %d: %d uploads, want %d", i, len(uploads), tt.uploads)
+        }
+        if tt.filename != "" {
+            last := uploads[len(uploads)-1]
+            if last.Filename != tt.filename || last.Days != tt.result.Uploaded {
+                t.Errorf("run %d: uploaded %s with %d days, want %s", i, last.Filename, last.Days, tt.filename)
+            }
+        }
+    }
+
+    // the server already has the file: recorded as uploaded
+    other := &State{Uploaded: map[string]string{}}
+    result, err := UploadNew(ctx, c, other, testData(66.4, 66.2, 66.0))
+    if err != nil || !result.Duplicate || result.Uploaded != 3 || len(other.Pending(testData(66.4, 66.2, 66.0))) != 0 {
+        t.Errorf("duplicate UploadNew = %+v, %v", result, err)
+    }
+
+    // a failed upload is not recorded
+    failed := &State{Uploaded: map[string]string{}}
+    _, err = UploadNew(ctx, newTestClient(s, "wrong"), failed, testData(66.4))
+    if err == nil || len(failed.Uploaded) != 0 {
+        t.Errorf("failed UploadNew = %v, recorded %v", err, failed.Uploaded)
+    }
+}
@@ -0,0 +1,181 @@
+package garmintest
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Server is a local stand-in of the upload endpoint of Garmin Connect, to test the uploads without an account.
+
+POST /login takes the username and the password as a form and sets the session cookie (SessionCookie).
+POST /upload takes the CSV as the multipart field "file" in a session, checks that it is importable
+(the CSV of dump), and answers 409 for a file with the same content as an uploaded one.
+ExpireSessions makes the next upload unauthorized, as an expired session does.
+
+Usage:
+```
+s := garmintest.NewServer("user", "pass")
+defer s.Close()
+c := garmin.NewClient(s.UploadURL())
+c.LoginURL, c.Username, c.Password = s.LoginURL(), "user", "pass"
+err := c.Upload(ctx, "weight.csv", content)
+fmt.Println(s.Uploads())
+```
+*/
+
+const SessionCookie = "SESSIONID"
+
+// Upload is an accepted upload.
+type Upload struct {
+    Filename string
+    Content string
+    Days int
+}
+
+type Server struct {
+    *httptest.Server
+    Username string
+    Password string
+
+    mu sync.Mutex
+    sessions map[string]bool
+    uploads []*Upload
+    hashes map[string]bool // of the uploaded contents
+    logins int
+}
+
+func NewServer(username string, password string) *Server {
+    s := &Server{
+        Username: username,
+        Password: password,
+        sessions: map[string]bool{},
+        hashes: map[string]bool{},
+    }
+    mux := http.NewServeMux()
+    mux.HandleFunc("/login", s.handleLogin)
+    mux.HandleFunc("/upload", s.handleUpload)
+    s.Server = httptest.NewServer(mux)
+    return s
+}
+
+func (s *Server) LoginURL() string {
+    return s.URL + "/login"
+}
+
+func (s *Server) UploadURL() string {
+    return s.URL + "/upload"
+}
+
+// NewSession returns the value of a valid session cookie, as if copied from a logged in browser.
+func (s *Server) NewSession() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    id := hex.EncodeToString(b)
+    s.mu.Lock()
+    s.sessions[id] = true
+    s.mu.Unlock()
+    return id
+}
+
+// ExpireSessions invalidates all sessions.
+func (s *Server) ExpireSessions() {
+    s.mu.Lock()
+    s.sessions = map[string]bool{}
+    s.mu.Unlock()
+}
+
+// Uploads returns the accepted uploads so far.
+func (s *Server) Uploads() []*Upload {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return append([]*Upload{}, s.uploads...)
+}
+
+// Logins returns the number of successful logins.
+func (s *Server) Logins() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.logins
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(body)
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+        return
+    }
+    if r.PostFormValue("username") != s.Username || r.PostFormValue("password") != s.Password {
+        writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid username or password"})
+        return
+    }
+    id := s.NewSession()
+    s.mu.Lock()
+    s.logins++
+    s.mu.Unlock()
+    http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: id, Path: "/", HttpOnly: true, Expires: time.Now().Add(24 * time.Hour)})
+    writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+        return
+    }
+    cookie, err := r.Cookie(SessionCookie)
+    s.mu.Lock()
+    valid := err == nil && s.sessions[cookie.Value]
+    s.mu.Unlock()
+    if !valid {
+        writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "not logged in"})
+        return
+    }
+
+    file, header, err := r.FormFile("file")
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no file: " + err.Error()})
+        return
+    }
+    defer file.Close()
+    content, err := io.ReadAll(file)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+        return
+    }
+    if !strings.HasSuffix(strings.ToLower(header.Filename), ".csv") {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported file type"})
+        return
+    }
+    innerscan, err := healthplanet.ParseCsv(strings.NewReader(string(content)), time.UTC)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("not an importable CSV: %v", err)})
+        return
+    }
+
+    hash := sha256.Sum256(content)
+    key := hex.EncodeToString(hash[:])
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.hashes[key] {
+        writeJSON(w, http.StatusConflict, map[string]string{"error": "duplicate upload"})
+        return
+    }
+    s.hashes[key] = true
+    s.uploads = append(s.uploads, &Upload{Filename: header.Filename, Content: string(content), Days: len(innerscan.Data)})
+    writeJSON(w, http.StatusCreated, map[string]any{"upload_id": len(s.uploads), "file_name": header.Filename, "days": len(innerscan.Data)})
+}
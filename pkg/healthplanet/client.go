@@ -16,15 +16,62 @@ type Client struct {
     url string
     auth HealthPlanetAuth
     Logger *slog.Logger
+
+    // APILocation is the time zone of the wall-clock times in the API requests and responses.
+    APILocation *time.Location
+    // Location is the time zone which the measurement dates are converted into.
+    Location *time.Location
 }
 
 
 func NewClient(url string, auth HealthPlanetAuth, logger *slog.Logger) *Client{
-    return &Client{url: url, auth: auth, Logger: logger}
+    return &Client{url: url, auth: auth, Logger: logger, APILocation: DefaultAPILocation, Location: time.Local}
 }
 
+// MaxQueryPeriod is the longest period which HealthPlanet returns in one request (3 months).
+const MaxQueryPeriod = 90 * 24 * time.Hour
+
+// GetInnerscanData returns the measurements between from and to, one per day.
 func (c *Client) GetInnerscanData(from time.Time, to time.Time) (*Innerscan, error){
-    c.Logger.Debug(fmt.Sprintf("GetInnerscanData called with from: %s, to: %s", from.Format("2006-01-02 15:04:05"), to.Format("2006-01-02 15:04:05")))
+    innerscan, err := c.GetInnerscanMeasurements(from, to)
+    if err != nil {
+        return nil, err
+    }
+    return innerscan.UniqByDay(), nil
+}
+
+// GetInnerscanMeasurements returns all measurements between from and to.
+// A period longer than MaxQueryPeriod is split into multiple requests.
+func (c *Client) GetInnerscanMeasurements(from time.Time, to time.Time) (*Innerscan, error){
+    var innerscan *Innerscan
+    for start := from; !start.After(to); {
+        end := start.Add(MaxQueryPeriod)
+        if end.After(to) {
+            end = to
+        }
+        part, err := c.getInnerscanMeasurements(start, end)
+        if err != nil {
+            return nil, err
+        }
+        if innerscan == nil {
+            innerscan = part
+        } else {
+            // the latest profile (height etc.) is used
+            part.Data = append(innerscan.Data, part.Data...)
+            innerscan = part
+        }
+        // the API takes the time in seconds, and both ends are inclusive
+        start = end.Add(time.Second)
+    }
+    if innerscan == nil {
+        return nil, fmt.Errorf("invalid period: from %s is after to %s", from, to)
+    }
+    innerscan.Sort()
+    return innerscan, nil
+}
+
+func (c *Client) getInnerscanMeasurements(from time.Time, to time.Time) (*Innerscan, error){
+    c.Logger.Debug(fmt.Sprintf("GetInnerscanData called with from: %s, to: %s", from.Format("2006-01-02 15:04:05 -0700"), to.Format("2006-01-02 15:04:05 -0700")))
 
     u, err := url.Parse(c.url)
     if err != nil {
@@ -40,8 +87,8 @@ func (c *Client) GetInnerscanData(from time.Time, to time.Time) (*Innerscan, err
     q := u.Query()
     q.Set("access_token", token)
     q.Set("date", "1") // from, to date type: "1" means mesurement date
-    q.Set("from", from.Format("20060102150405"))
-    q.Set("to", to.Format("20060102150405"))
+    q.Set("from", from.In(c.APILocation).Format("20060102150405"))
+    q.Set("to", to.In(c.APILocation).Format("20060102150405"))
     q.Set("tag", "6021,6022") // 6021: Weight, 6022: Body Fat
 
     u.RawQuery = q.Encode()
@@ -57,6 +104,7 @@ func (c *Client) GetInnerscanData(from time.Time, to time.Time) (*Innerscan, err
     if err != nil {
         return nil, err
     }
+    defer resp.Body.Close()
     if resp.StatusCode != 200 {
         return nil, errors.New("[HealthPlanet]Failed to get innerscan data")
     }
@@ -69,7 +117,7 @@ func (c *Client) GetInnerscanData(from time.Time, to time.Time) (*Innerscan, err
         return nil, err
     }
 
-    innerscan, err := respData.ToInnerscan()
+    innerscan, err := respData.ToMeasurements(c.APILocation, c.Location)
     if err != nil {
         return nil, fmt.Errorf("Failed to convert response data to Innerscan: %w", err)
     }
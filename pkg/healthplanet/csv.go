@@ -0,0 +1,229 @@
+package healthplanet
+
+import (
+    "bufio"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// CsvPreamble is the first line of the CSV for Garmin Connect import, written before the header.
+const CsvPreamble = "Body"
+
+/*
+ParseCsv parses the CSV written by ToCsv, with or without the "Body" preamble.
+
+The columns are found by the header, so extra columns are ignored.
+The rows filled by the resampler (Synthetic column) are skipped, as they are not measurements,
+and the outlier marks (Outlier and OutlierReason columns) are kept.
+As the CSV has only the date of the measurements, the time is set to the beginning of the day in loc.
+*/
+func ParseCsv(r io.Reader, loc *time.Location) (*Innerscan, error) {
+    reader := bufio.NewReader(r)
+    first, err := reader.Peek(len(CsvPreamble))
+    if err == nil && string(first) == CsvPreamble {
+        // skip the preamble line
+        _, err = reader.ReadString('\n')
+        if err != nil {
+            return nil, fmt.Errorf("failed to read preamble: %w", err)
+        }
+    }
+
+    csvReader := csv.NewReader(reader)
+    header, err := csvReader.Read()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read header: %w", err)
+    }
+    columns := make(map[string]int)
+    for i, h := range header {
+        columns[strings.TrimSpace(h)] = i
+    }
+    for _, name := range []string{"Date", "Weight", "BMI", "Fat"} {
+        if _, ok := columns[name]; !ok {
+            return nil, fmt.Errorf("column %q not found in header", name)
+        }
+    }
+
+    innerscan := &Innerscan{
+        Data: make([]*InnerscanData, 0),
+    }
+    line := 1
+    for {
+        record, err := csvReader.Read()
+        if errors.Is(err, io.EOF) {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        line++
+
+        if i, ok := columns["Synthetic"]; ok && i < len(record) {
+            synthetic, err := strconv.ParseBool(record[i])
+            if err != nil {
+                return nil, fmt.Errorf("line %d: failed to parse Synthetic: %w", line, err)
+            }
+            if synthetic {
+                continue
+            }
+        }
+
+        date, err := time.ParseInLocation("2006-01-02", record[columns["Date"]], loc)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: failed to parse date: %w", line, err)
+        }
+        d := &InnerscanData{Date: date}
+        values := []struct {
+            name string
+            dest *float64
+        }{
+            {"Weight", &d.Weight},
+            {"BMI", &d.BMI},
+            {"Fat", &d.BodyFat},
+        }
+        for _, v := range values {
+            *v.dest, err = strconv.ParseFloat(record[columns[v.name]], 64)
+            if err != nil {
+                return nil, fmt.Errorf("line %d: failed to parse %s: %w", line, v.name, err)
+            }
+        }
+        if i, ok := columns["Outlier"]; ok && i < len(record) {
+            outlier, err := strconv.ParseBool(record[i])
+            if err != nil {
+                return nil, fmt.Errorf("line %d: failed to parse Outlier: %w", line, err)
+            }
+            d.Outlier = &OutlierMark{Outlier: outlier}
+            if j, ok := columns["OutlierReason"]; ok && j < len(record) {
+                d.Outlier.Reason = record[j]
+            }
+        }
+        if err := d.Validate(); err != nil {
+            return nil, fmt.Errorf("line %d: %w", line, err)
+        }
+        innerscan.Data = append(innerscan.Data, d)
+    }
+
+    innerscan.Sort()
+    return innerscan, nil
+}
+
+// CSV Conversion
+// The optional columns (e.g. the trend) are added only if the data has them,
+// so that the default output stays importable by Garmin Connect.
+func (i *Innerscan) CsvHeader() string {
+    header := "Date,Weight,BMI,Fat"
+    if i.hasTrend() {
+        header += ",WeightSMA,WeightEWMA,WeightSlope"
+    }
+    if i.hasMetrics() {
+        header += ",FatMass,LeanMass,Age,BMICategory,BMRMifflinStJeor,BMRKatchMcArdle"
+    }
+    if i.hasOutlierMark() {
+        header += ",Outlier,OutlierReason"
+    }
+    if i.hasSynthetic() {
+        header += ",Synthetic"
+    }
+    return header
+}
+func (i *Innerscan) ToCsv() string {
+    trend := i.hasTrend()
+    metrics := i.hasMetrics()
+    outlier := i.hasOutlierMark()
+    synthetic := i.hasSynthetic()
+    ret := i.CsvHeader() + "\n"
+    for _, d := range i.Data {
+        ret += fmt.Sprintf("%s,%f,%f,%f", d.Date.Format("2006-01-02"), d.Weight, d.BMI, d.BodyFat)
+        if trend {
+            t := d.Trend
+            if t == nil {
+                t = &Trend{}
+            }
+            ret += fmt.Sprintf(",%f,%f,%f", t.SMA, t.EWMA, t.Slope)
+        }
+        if metrics {
+            m := d.Metrics
+            if m == nil {
+                m = &Metrics{}
+            }
+            // unknown metrics are left empty
+            ret += "," + csvFloat(m.FatMass) + "," + csvFloat(m.LeanMass) + "," + csvInt(m.Age) + "," + m.BMICategory +
+                "," + csvFloat(m.BMRMifflinStJeor) + "," + csvFloat(m.BMRKatchMcArdle)
+        }
+        if outlier {
+            o := d.Outlier
+            if o == nil {
+                o = &OutlierMark{}
+            }
+            ret += fmt.Sprintf(",%t,%s", o.Outlier, csvQuote(o.Reason))
+        }
+        if synthetic {
+            ret += fmt.Sprintf(",%t", d.Synthetic)
+        }
+        ret += "\n"
+    }
+    return ret
+}
+
+func (i *Innerscan) hasTrend() bool {
+    for _, d := range i.Data {
+        if d.Trend != nil {
+            return true
+        }
+    }
+    return false
+}
+
+func (i *Innerscan) hasMetrics() bool {
+    for _, d := range i.Data {
+        if d.Metrics != nil {
+            return true
+        }
+    }
+    return false
+}
+
+func (i *Innerscan) hasOutlierMark() bool {
+    for _, d := range i.Data {
+        if d.Outlier != nil {
+            return true
+        }
+    }
+    return false
+}
+
+func (i *Innerscan) hasSynthetic() bool {
+    for _, d := range i.Data {
+        if d.Synthetic {
+            return true
+        }
+    }
+    return false
+}
+
+// csvQuote quotes the value if it has a comma or a quote.
+func csvQuote(v string) string {
+    if !strings.ContainsAny(v, ",\"\n") {
+        return v
+    }
+    return `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+}
+
+// csvFloat formats the value, or returns "" for 0 (unknown).
+func csvFloat(v float64) string {
+    if v == 0 {
+        return ""
+    }
+    return fmt.Sprintf("%f", v)
+}
+
+func csvInt(v int) string {
+    if v == 0 {
+        return ""
+    }
+    return strconv.Itoa(v)
+}
@@ -0,0 +1,139 @@
+package healthplanet
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func csvData(day int, weight float64, bodyFat float64, bmi float64) *InnerscanData {
+    return &InnerscanData{Date: time.Date(2025, 4, day, 7, 30, 0, 0, DefaultAPILocation), Model: "01000117", Weight: weight, BodyFat: bodyFat, BMI: bmi}
+}
+
+func TestCsvRoundTrip(t *testing.T) {
+    withTrend := &Innerscan{Data: []*InnerscanData{csvData(1, 66.4, 20.5, 22.4), csvData(2, 66.2, 20.3, 22.3)}}
+    withTrend.Data[1].Trend = &Trend{SMA: 66.3, EWMA: 66.25, Slope: -0.7}
+    withMetrics := &Innerscan{BirthDate: time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC), Hight: 172, Sex: "male",
+        Data: []*InnerscanData{csvData(1, 66.4, 20.5, 22.4)}}
+    withMetrics.CalcMetrics()
+    withOutlier := &Innerscan{Data: []*InnerscanData{csvData(1, 66.4, 20.5, 22.4), csvData(2, 33.2, 20.5, 11.2)}}
+    withOutlier.Data[0].Outlier = &OutlierMark{}
+    withOutlier.Data[1].Outlier = &OutlierMark{Outlier: true, Reason: `jump of 33.2 kg, "step-on"`}
+
+    tests := []struct {
+        name string
+        innerscan *Innerscan
+        preamble bool
+    }{
+        {"plain", &Innerscan{Data: []*InnerscanData{csvData(2, 66.2, 0, 22.3), csvData(1, 66.4, 20.5, 22.4)}}, false},
+        {"preamble", &Innerscan{Data: []*InnerscanData{csvData(1, 66.4, 20.5, 22.4)}}, true},
+        {"trend", withTrend, true},
+        {"metrics", withMetrics, true},
+        {"outlier", withOutlier, false},
+        {"empty", &Innerscan{}, true},
+    }
+    for _, tt := range tests {
+        content := tt.innerscan.ToCsv()
+        if tt.preamble {
+            content = CsvPreamble + "\n" + content
+        }
+        got, err := ParseCsv(strings.NewReader(content), DefaultAPILocation)
+        if err != nil {
+            t.Errorf("%s: %v\n%s", tt.name, err, content)
+            continue
+        }
+
+        want := append([]*InnerscanData{}, tt.innerscan.Data...)
+        (&Innerscan{Data: want}).Sort()
+        if len(got.Data) != len(want) {
+            t.Errorf("%s: %d data, want %d", tt.name, len(got.Data), len(want))
+            continue
+        }
+        for i, w := range want {
+            d := got.Data[i]
+            // only the date is written, the time is the beginning of the day
+            if d.Day() != w.Day() || d.Date.Hour() != 0 || d.Date.Location() != DefaultAPILocation {
+                t.Errorf("%s: data %d date = %s, want %s 00:00", tt.name, i, d.Date, w.Day())
+            }
+            if !d.SameValues(w) {
+                t.Errorf("%s: data %d = %v %v %v, want %v %v %v", tt.name, i, d.Weight, d.BodyFat, d.BMI, w.Weight, w.BodyFat, w.BMI)
+            }
+            // the outlier marks are kept
+            if w.Outlier != nil && (d.Outlier == nil || *d.Outlier != *w.Outlier) {
+                t.Errorf("%s: data %d outlier = %+v, want %+v", tt.name, i, d.Outlier, *w.Outlier)
+            }
+        }
+    }
+}
+
+func TestParseCsvErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        content string
+        message string
+    }{
+        {"empty", "", "failed to read header"},
+        {"only preamble", "Body\n", "failed to read header"},
+        {"missing column", "Date,Weight,BMI\n2025-04-01,66.4,22.4\n", `column "Fat" not found`},
+        {"bad date", "Date,Weight,BMI,Fat\n2025/04/01,66.4,22.4,20.5\n", "line 2: failed to parse date"},
+        {"bad value", "Body\nDate,Weight,BMI,Fat\n2025-04-01,66.4,22.4,20.5\n2025-04-02,66.2,n/a,20.5\n", "line 3: failed to parse BMI"},
+        {"invalid", "Date,Weight,BMI,Fat\n2025-04-01,0,22.4,20.5\n", "line 2: weight must be greater than 0"},
+    }
+    for _, tt := range tests {
+        _, err := ParseCsv(strings.NewReader(tt.content), time.UTC)
+        if err == nil || !strings.Contains(err.Error(), tt.message) {
+            t.Errorf("%s: error = %v, want %q", tt.name, err, tt.message)
+        }
+    }
+}
+
+func TestMerge(t *testing.T) {
+    // a previous export, read back from the CSV
+    exported := &Innerscan{Data: []*InnerscanData{csvData(1, 66.4, 20.5, 22.4), csvData(2, 66.2, 20.3, 22.3), csvData(3, 66.0, 20.1, 22.2)}}
+    parsed, err := ParseCsv(strings.NewReader(CsvPreamble + "\n" + exported.ToCsv()), DefaultAPILocation)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // the archive has the same values with more digits on day 1, a different weight on day 2, and day 4
+    archived := &Innerscan{BirthDate: time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC), Hight: 172, Sex: "male",
+        Data: []*InnerscanData{csvData(1, 66.4000004, 20.5, 22.4), csvData(2, 66.3, 20.3, 22.3), csvData(4, 65.8, 20.0, 22.1)}}
+    // a later export without body information has another value on day 2
+    later := &Innerscan{Data: []*InnerscanData{csvData(2, 66.25, 20.3, 22.3)}}
+
+    merged, conflicts := Merge([]*MergeSource{{"export.csv", parsed}, {"archive", archived}, {"later.csv", later}})
+
+    wantWeights := []float64{66.4000004, 66.25, 66.0, 65.8}
+    if len(merged.Data) != len(wantWeights) {
+        t.Fatalf("merged %d data, want %d", len(merged.Data), len(wantWeights))
+    }
+    for i, w := range wantWeights {
+        if merged.Data[i].Weight != w {
+            t.Errorf("data %d weight = %v, want %v", i, merged.Data[i].Weight, w)
+        }
+    }
+    if merged.Hight != 172 || merged.Sex != "male" {
+        t.Errorf("body information = %v %q, want 172 male", merged.Hight, merged.Sex)
+    }
+
+    // the difference within mergeTolerance on day 1 is not a conflict
+    want := []struct {
+        day string
+        kept string
+        dropped string
+    }{
+        {"2025-04-02", "archive", "export.csv"},
+        {"2025-04-02", "later.csv", "archive"},
+    }
+    if len(conflicts) != len(want) {
+        t.Fatalf("conflicts = %v, want %d", conflicts, len(want))
+    }
+    for i, w := range want {
+        c := conflicts[i]
+        if c.Day != w.day || c.KeptSource != w.kept || c.DroppedSource != w.dropped {
+            t.Errorf("conflict %d = %s", i, c)
+        }
+    }
+    if s := conflicts[0].String(); !strings.Contains(s, "export.csv has weight 66.20") || !strings.Contains(s, "(kept archive)") {
+        t.Errorf("conflict = %q", s)
+    }
+}
@@ -0,0 +1,152 @@
+package healthplanet
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "sort"
+    "strings"
+)
+
+const (
+    DiffAdded = "added"
+    DiffRemoved = "removed"
+    DiffChanged = "changed"
+)
+
+type DiffValues struct {
+    Weight float64 `json:"weight"`
+    BodyFat float64 `json:"body_fat"`
+    BMI float64 `json:"bmi"`
+}
+
+func newDiffValues(d *InnerscanData) *DiffValues {
+    if d == nil {
+        return nil
+    }
+    return &DiffValues{Weight: d.Weight, BodyFat: d.BodyFat, BMI: d.BMI}
+}
+
+type FieldDelta struct {
+    Field string `json:"field"`
+    Old float64 `json:"old"`
+    New float64 `json:"new"`
+    Delta float64 `json:"delta"`
+}
+
+type DiffEntry struct {
+    Date string `json:"date"` // YYYY-MM-DD
+    Kind string `json:"kind"` // added, removed or changed
+    Old *DiffValues `json:"old,omitempty"`
+    New *DiffValues `json:"new,omitempty"`
+    Deltas []FieldDelta `json:"deltas,omitempty"`
+}
+
+type DiffResult struct {
+    Added int `json:"added"`
+    Removed int `json:"removed"`
+    Changed int `json:"changed"`
+    Entries []*DiffEntry `json:"entries"`
+}
+
+// HasDifferences reports whether any measurement is added, removed or changed.
+func (r *DiffResult) HasDifferences() bool {
+    return len(r.Entries) > 0
+}
+
+/*
+Diff compares the measurements per day, e.g. a previous export against a fresh fetch.
+
+A day only in new is "added", only in old is "removed",
+and in both with different values (see SameValues) is "changed" with the deltas of the fields.
+*/
+func Diff(old *Innerscan, new *Innerscan) *DiffResult {
+    oldDays := make(map[string]*InnerscanData)
+    newDays := make(map[string]*InnerscanData)
+    days := make([]string, 0)
+    for _, d := range old.UniqByDay().Data {
+        oldDays[d.Day()] = d
+        days = append(days, d.Day())
+    }
+    for _, d := range new.UniqByDay().Data {
+        newDays[d.Day()] = d
+        if _, ok := oldDays[d.Day()]; !ok {
+            days = append(days, d.Day())
+        }
+    }
+    sort.Strings(days)
+
+    result := &DiffResult{Entries: make([]*DiffEntry, 0)}
+    for _, day := range days {
+        o, n := oldDays[day], newDays[day]
+        entry := &DiffEntry{Date: day, Old: newDiffValues(o), New: newDiffValues(n)}
+        switch {
+        case o == nil:
+            entry.Kind = DiffAdded
+            result.Added++
+        case n == nil:
+            entry.Kind = DiffRemoved
+            result.Removed++
+        case !o.SameValues(n):
+            entry.Kind = DiffChanged
+            entry.Deltas = fieldDeltas(o, n)
+            result.Changed++
+        default:
+            continue
+        }
+        result.Entries = append(result.Entries, entry)
+    }
+    return result
+}
+
+func fieldDeltas(o *InnerscanData, n *InnerscanData) []FieldDelta {
+    fields := []struct {
+        name string
+        old, new float64
+    }{
+        {"weight", o.Weight, n.Weight},
+        {"body_fat", o.BodyFat, n.BodyFat},
+        {"bmi", o.BMI, n.BMI},
+    }
+    deltas := make([]FieldDelta, 0, len(fields))
+    for _, f := range fields {
+        if math.Abs(f.new - f.old) < mergeTolerance {
+            continue
+        }
+        deltas = append(deltas, FieldDelta{Field: f.name, Old: f.old, New: f.new, Delta: f.new - f.old})
+    }
+    return deltas
+}
+
+func (v *DiffValues) String() string {
+    return fmt.Sprintf("weight %.2f, body fat %.2f, BMI %.2f", v.Weight, v.BodyFat, v.BMI)
+}
+
+// ToText returns the result in a human readable form, one line per entry and a summary line.
+func (r *DiffResult) ToText() string {
+    var b strings.Builder
+    for _, e := range r.Entries {
+        switch e.Kind {
+        case DiffAdded:
+            fmt.Fprintf(&b, "+ %s %s\n", e.Date, e.New)
+        case DiffRemoved:
+            fmt.Fprintf(&b, "- %s %s\n", e.Date, e.Old)
+        case DiffChanged:
+            deltas := make([]string, 0, len(e.Deltas))
+            for _, d := range e.Deltas {
+                deltas = append(deltas, fmt.Sprintf("%s %.2f -> %.2f (%+.2f)", d.Field, d.Old, d.New, d.Delta))
+            }
+            fmt.Fprintf(&b, "~ %s %s\n", e.Date, strings.Join(deltas, ", "))
+        }
+    }
+    fmt.Fprintf(&b, "%d added, %d removed, %d changed\n", r.Added, r.Removed, r.Changed)
+    return b.String()
+}
+
+func (r *DiffResult) ToJson() (string, error) {
+    data, err := json.MarshalIndent(r, "", "  ")
+    if err != nil {
+        return "", err
+    }
+    return string(data) + "\n", nil
+}
@@ -0,0 +1,95 @@
+package healthplanet
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestDiff(t *testing.T) {
+    old := &Innerscan{Data: []*InnerscanData{
+        csvData(1, 66.4, 20.5, 22.4),
+        csvData(2, 66.2, 20.3, 22.3),
+        csvData(3, 66.0, 20.1, 22.2),
+        csvData(4, 65.9, 20.0, 22.1),
+    }}
+    new := &Innerscan{Data: []*InnerscanData{
+        // the same values as rounded by the CSV
+        csvData(1, 66.4000004, 20.5, 22.4),
+        csvData(2, 66.3, 20.3, 22.35),
+        csvData(4, 65.9, 20.0, 22.1),
+        csvData(5, 65.8, 19.9, 22.1),
+    }}
+
+    result := Diff(old, new)
+    if result.Added != 1 || result.Removed != 1 || result.Changed != 1 || !result.HasDifferences() {
+        t.Errorf("Diff() = %d added, %d removed, %d changed", result.Added, result.Removed, result.Changed)
+    }
+    want := []struct {
+        date string
+        kind string
+        fields []string
+    }{
+        {"2025-04-02", DiffChanged, []string{"weight", "bmi"}},
+        {"2025-04-03", DiffRemoved, nil},
+        {"2025-04-05", DiffAdded, nil},
+    }
+    if len(result.Entries) != len(want) {
+        t.Fatalf("Diff() = %d entries, want %d", len(result.Entries), len(want))
+    }
+    for i, w := range want {
+        e := result.Entries[i]
+        if e.Date != w.date || e.Kind != w.kind || len(e.Deltas) != len(w.fields) {
+            t.Errorf("entry %d = %s %s %v, want %s %s %v", i, e.Date, e.Kind, e.Deltas, w.date, w.kind, w.fields)
+            continue
+        }
+        for j, field := range w.fields {
+            if e.Deltas[j].Field != field {
+                t.Errorf("entry %d delta %d = %s, want %s", i, j, e.Deltas[j].Field, field)
+            }
+        }
+    }
+    if d := result.Entries[0].Deltas[0]; d.Old != 66.2 || d.New != 66.3 {
+        t.Errorf("weight delta = %v -> %v, want 66.2 -> 66.3", d.Old, d.New)
+    }
+    if result.Entries[1].New != nil || result.Entries[2].Old != nil {
+        t.Errorf("removed and added entries have both values: %+v %+v", result.Entries[1], result.Entries[2])
+    }
+
+    text := result.ToText()
+    for _, line := range []string{
+        "~ 2025-04-02 weight 66.20 -> 66.30 (+0.10), bmi 22.30 -> 22.35 (+0.05)\n",
+        "- 2025-04-03 weight 66.00, body fat 20.10, BMI 22.20\n",
+        "+ 2025-04-05 weight 65.80, body fat 19.90, BMI 22.10\n",
+        "1 added, 1 removed, 1 changed\n",
+    } {
+        if !strings.Contains(text, line) {
+            t.Errorf("ToText() does not contain %q:\n%s", line, text)
+        }
+    }
+
+    if same := Diff(old, old); same.HasDifferences() || same.ToText() != "0 added, 0 removed, 0 changed\n" {
+        t.Errorf("Diff() of the same data = %+v", same)
+    }
+}
+
+// TestDiffFilled checks that the rows filled by -fill in a previous export are not reported as removed.
+func TestDiffFilled(t *testing.T) {
+    filled := &Innerscan{Data: []*InnerscanData{
+        csvData(1, 66.4, 20.5, 22.4),
+        csvData(2, 66.3, 20.4, 22.35),
+        csvData(3, 66.2, 20.3, 22.3),
+    }}
+    filled.Data[1].Synthetic = true
+    previous, err := ParseCsv(strings.NewReader(CsvPreamble + "\n" + filled.ToCsv()), DefaultAPILocation)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(previous.Data) != 2 {
+        t.Errorf("ParseCsv() = %d data, want 2 without the filled row", len(previous.Data))
+    }
+
+    current := &Innerscan{Data: []*InnerscanData{csvData(1, 66.4, 20.5, 22.4), csvData(3, 66.2, 20.3, 22.3)}}
+    if result := Diff(previous, current); result.HasDifferences() {
+        t.Errorf("Diff() = %s", result.ToText())
+    }
+}
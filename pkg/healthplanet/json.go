@@ -0,0 +1,15 @@
+package healthplanet
+
+import (
+    "encoding/json"
+)
+
+// JSON Conversion
+// The optional values (e.g. the trend) are included only if calculated.
+func (i *Innerscan) ToJson() (string, error) {
+    data, err := json.MarshalIndent(i, "", "  ")
+    if err != nil {
+        return "", err
+    }
+    return string(data) + "\n", nil
+}
@@ -0,0 +1,88 @@
+package healthplanet
+
+import (
+    "fmt"
+    "math"
+)
+
+// MergeSource is a set of measurements to merge, named for the conflict reports.
+type MergeSource struct {
+    Name string
+    Innerscan *Innerscan
+}
+
+// Conflict is a day which has different values in two sources.
+type Conflict struct {
+    Day string
+    Kept *InnerscanData
+    KeptSource string
+    Dropped *InnerscanData
+    DroppedSource string
+}
+
+func (c *Conflict) String() string {
+    return fmt.Sprintf("%s: %s has weight %.2f, body fat %.2f, BMI %.2f, but %s has weight %.2f, body fat %.2f, BMI %.2f (kept %s)",
+        c.Day,
+        c.DroppedSource, c.Dropped.Weight, c.Dropped.BodyFat, c.Dropped.BMI,
+        c.KeptSource, c.Kept.Weight, c.Kept.BodyFat, c.Kept.BMI,
+        c.KeptSource)
+}
+
+// mergeTolerance is the difference regarded as the same value, as the CSV rounds the values.
+const mergeTolerance = 0.0001
+
+// SameValues reports whether the measurements have the same values.
+func (d *InnerscanData) SameValues(o *InnerscanData) bool {
+    return math.Abs(d.Weight - o.Weight) < mergeTolerance &&
+        math.Abs(d.BodyFat - o.BodyFat) < mergeTolerance &&
+        math.Abs(d.BMI - o.BMI) < mergeTolerance
+}
+
+/*
+Merge merges the sources into one Innerscan with one measurement per day, sorted by date.
+
+Each source is unified per day first (see UniqByDay).
+If the same day is in multiple sources, the later source wins,
+and the day is reported as a conflict if the values are different.
+The body information (height etc.) is taken from the last source which has it.
+*/
+func Merge(sources []*MergeSource) (*Innerscan, []*Conflict) {
+    merged := &Innerscan{
+        Data: make([]*InnerscanData, 0),
+    }
+    days := make(map[string]int) // day -> index in merged.Data
+    origins := make(map[string]string) // day -> source name
+    conflicts := make([]*Conflict, 0)
+
+    for _, source := range sources {
+        if source.Innerscan.Hight != 0 {
+            merged.BirthDate = source.Innerscan.BirthDate
+            merged.Hight = source.Innerscan.Hight
+            merged.Sex = source.Innerscan.Sex
+        }
+        for _, d := range source.Innerscan.UniqByDay().Data {
+            day := d.Day()
+            i, ok := days[day]
+            if !ok {
+                days[day] = len(merged.Data)
+                origins[day] = source.Name
+                merged.Data = append(merged.Data, d)
+                continue
+            }
+            if !merged.Data[i].SameValues(d) {
+                conflicts = append(conflicts, &Conflict{
+                    Day: day,
+                    Kept: d,
+                    KeptSource: source.Name,
+                    Dropped: merged.Data[i],
+                    DroppedSource: origins[day],
+                })
+            }
+            merged.Data[i] = d
+            origins[day] = source.Name
+        }
+    }
+
+    merged.Sort()
+    return merged, conflicts
+}
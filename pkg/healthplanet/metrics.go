@@ -0,0 +1,111 @@
+package healthplanet
+
+import (
+    "time"
+)
+
+/*
+Derived body composition metrics of a measurement.
+
+They are calculated from the measurement and the body information of Innerscan (birth date, height, sex)
+by Innerscan.CalcMetrics, and written by every exporter when set:
+
+  - FatMass: fat mass (kg) = weight * body fat / 100
+  - LeanMass: lean body mass (kg) = weight - fat mass
+  - Age: age in years at the measurement
+  - BMICategory: WHO classification of BMI (BMICategory)
+  - BMRMifflinStJeor: basal metabolic rate (kcal/day) by the Mifflin-St Jeor equation (MifflinStJeor)
+  - BMRKatchMcArdle: basal metabolic rate (kcal/day) by the Katch-McArdle equation (KatchMcArdle)
+
+A metric which cannot be calculated (e.g. no body fat, or no height for the imported data) is 0 or "".
+*/
+type Metrics struct {
+    FatMass float64 `json:"fat_mass,omitempty"`
+    LeanMass float64 `json:"lean_mass,omitempty"`
+    Age int `json:"age,omitempty"`
+    BMICategory string `json:"bmi_category,omitempty"`
+    BMRMifflinStJeor float64 `json:"bmr_mifflin_st_jeor,omitempty"`
+    BMRKatchMcArdle float64 `json:"bmr_katch_mcardle,omitempty"`
+}
+
+// FatMass returns the fat mass (kg) from the weight (kg) and the body fat (%).
+// e.g. FatMass(80, 25) = 20
+func FatMass(weight float64, bodyFat float64) float64 {
+    return weight * bodyFat / 100
+}
+
+// LeanMass returns the lean body mass (kg) from the weight (kg) and the body fat (%).
+// e.g. LeanMass(80, 25) = 60
+func LeanMass(weight float64, bodyFat float64) float64 {
+    return weight - FatMass(weight, bodyFat)
+}
+
+// Age returns the age in years at the time.
+// The birth date is a calendar date, so the birthday is counted in the wall-clock date of the time.
+// e.g. Age(1985-04-12, 2025-04-11) = 39, Age(1985-04-12, 2025-04-12) = 40
+func Age(birthDate time.Time, at time.Time) int {
+    age := at.Year() - birthDate.Year()
+    if at.Month() < birthDate.Month() || (at.Month() == birthDate.Month() && at.Day() < birthDate.Day()) {
+        age--
+    }
+    return age
+}
+
+// BMICategory returns the WHO classification of the BMI of adults:
+// Underweight (< 18.5), Normal (< 25), Overweight (< 30) or Obese, and "" for no BMI.
+func BMICategory(bmi float64) string {
+    switch {
+    case bmi <= 0:
+        return ""
+    case bmi < 18.5:
+        return "Underweight"
+    case bmi < 25:
+        return "Normal"
+    case bmi < 30:
+        return "Overweight"
+    }
+    return "Obese"
+}
+
+// MifflinStJeor returns the basal metabolic rate (kcal/day) by the Mifflin-St Jeor equation:
+// 10 * weight (kg) + 6.25 * height (cm) - 5 * age + 5 for male, - 161 for female.
+// ok is false if the sex is neither "male" nor "female".
+// e.g. MifflinStJeor(80, 180, 30, "male") = 1780, MifflinStJeor(60, 165, 30, "female") = 1320.25
+func MifflinStJeor(weight float64, height float64, age int, sex string) (float64, bool) {
+    bmr := 10 * weight + 6.25 * height - 5 * float64(age)
+    switch sex {
+    case "male":
+        return bmr + 5, true
+    case "female":
+        return bmr - 161, true
+    }
+    return 0, false
+}
+
+// KatchMcArdle returns the basal metabolic rate (kcal/day) by the Katch-McArdle equation:
+// 370 + 21.6 * lean body mass (kg).
+// e.g. KatchMcArdle(60) = 1666
+func KatchMcArdle(leanMass float64) float64 {
+    return 370 + 21.6 * leanMass
+}
+
+// CalcMetrics sets the derived metrics to each data, with the body information of the Innerscan.
+func (i *Innerscan) CalcMetrics() {
+    for _, d := range i.Data {
+        m := &Metrics{
+            BMICategory: BMICategory(d.BMI),
+        }
+        if d.BodyFat > 0 {
+            m.FatMass = FatMass(d.Weight, d.BodyFat)
+            m.LeanMass = LeanMass(d.Weight, d.BodyFat)
+            m.BMRKatchMcArdle = KatchMcArdle(m.LeanMass)
+        }
+        if !i.BirthDate.IsZero() {
+            m.Age = Age(i.BirthDate, d.Date)
+            if i.Hight > 0 {
+                m.BMRMifflinStJeor, _ = MifflinStJeor(d.Weight, i.Hight, m.Age, i.Sex)
+            }
+        }
+        d.Metrics = m
+    }
+}
@@ -0,0 +1,167 @@
+package healthplanet
+
+import (
+    "math"
+    "testing"
+    "time"
+)
+
+func near(a float64, b float64) bool {
+    return math.Abs(a - b) < 1e-9
+}
+
+func TestFatMassAndLeanMass(t *testing.T) {
+    tests := []struct {
+        weight float64
+        bodyFat float64
+        fatMass float64
+        leanMass float64
+    }{
+        {80, 25, 20, 60},
+        {66.4, 20.6, 13.6784, 52.7216},
+        {70, 0, 0, 70},
+    }
+    for _, tt := range tests {
+        if got := FatMass(tt.weight, tt.bodyFat); !near(got, tt.fatMass) {
+            t.Errorf("FatMass(%v, %v) = %v, want %v", tt.weight, tt.bodyFat, got, tt.fatMass)
+        }
+        if got := LeanMass(tt.weight, tt.bodyFat); !near(got, tt.leanMass) {
+            t.Errorf("LeanMass(%v, %v) = %v, want %v", tt.weight, tt.bodyFat, got, tt.leanMass)
+        }
+    }
+}
+
+func TestAge(t *testing.T) {
+    tokyo, err := time.LoadLocation("Asia/Tokyo")
+    if err != nil {
+        t.Fatal(err)
+    }
+    birth := time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC)
+    leap := time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC)
+    tests := []struct {
+        birthDate time.Time
+        at time.Time
+        want int
+    }{
+        {birth, time.Date(2025, 4, 11, 23, 59, 59, 0, time.UTC), 39},
+        {birth, time.Date(2025, 4, 12, 0, 0, 0, 0, time.UTC), 40},
+        {birth, time.Date(2025, 4, 13, 0, 0, 0, 0, time.UTC), 40},
+        {birth, time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC), 39},
+        {birth, time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC), 40},
+        // the birthday is counted in the wall-clock date of the measurement
+        {birth, time.Date(2025, 4, 12, 0, 30, 0, 0, tokyo), 40},
+        {birth, time.Date(2025, 4, 12, 0, 30, 0, 0, tokyo).UTC(), 39},
+        // born on February 29th, a year older on March 1st of the common years
+        {leap, time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC), 24},
+        {leap, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), 25},
+        {leap, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), 24},
+    }
+    for _, tt := range tests {
+        if got := Age(tt.birthDate, tt.at); got != tt.want {
+            t.Errorf("Age(%s, %s) = %d, want %d", tt.birthDate.Format("2006-01-02"), tt.at.Format(time.RFC3339), got, tt.want)
+        }
+    }
+}
+
+func TestBMICategory(t *testing.T) {
+    tests := []struct {
+        bmi float64
+        want string
+    }{
+        {0, ""},
+        {-1, ""},
+        {16, "Underweight"},
+        {18.49, "Underweight"},
+        {18.5, "Normal"},
+        {24.99, "Normal"},
+        {25, "Overweight"},
+        {29.99, "Overweight"},
+        {30, "Obese"},
+        {42, "Obese"},
+    }
+    for _, tt := range tests {
+        if got := BMICategory(tt.bmi); got != tt.want {
+            t.Errorf("BMICategory(%v) = %q, want %q", tt.bmi, got, tt.want)
+        }
+    }
+}
+
+func TestMifflinStJeor(t *testing.T) {
+    tests := []struct {
+        weight float64
+        height float64
+        age int
+        sex string
+        want float64
+        ok bool
+    }{
+        {80, 180, 30, "male", 1780, true},
+        {60, 165, 30, "female", 1320.25, true},
+        {66.4, 172, 40, "male", 1544, true},
+        {66.4, 172, 40, "female", 1378, true},
+        {80, 180, 30, "", 0, false},
+    }
+    for _, tt := range tests {
+        got, ok := MifflinStJeor(tt.weight, tt.height, tt.age, tt.sex)
+        if ok != tt.ok || !near(got, tt.want) {
+            t.Errorf("MifflinStJeor(%v, %v, %d, %q) = %v, %v, want %v, %v", tt.weight, tt.height, tt.age, tt.sex, got, ok, tt.want, tt.ok)
+        }
+    }
+}
+
+func TestKatchMcArdle(t *testing.T) {
+    tests := []struct {
+        leanMass float64
+        want float64
+    }{
+        {60, 1666},
+        {52.7216, 1508.78656},
+        {0, 370},
+    }
+    for _, tt := range tests {
+        if got := KatchMcArdle(tt.leanMass); !near(got, tt.want) {
+            t.Errorf("KatchMcArdle(%v) = %v, want %v", tt.leanMass, got, tt.want)
+        }
+    }
+}
+
+func TestCalcMetrics(t *testing.T) {
+    birth := time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC)
+    date := time.Date(2025, 4, 12, 7, 30, 0, 0, time.UTC)
+    full := Metrics{FatMass: 20, LeanMass: 60, Age: 40, BMICategory: "Overweight", BMRMifflinStJeor: 1730, BMRKatchMcArdle: 1666}
+
+    tests := []struct {
+        name string
+        innerscan Innerscan
+        bodyFat float64
+        bmi float64
+        want Metrics
+    }{
+        {"all", Innerscan{BirthDate: birth, Hight: 180, Sex: "male"}, 25, 25.5, full},
+        {"no height", Innerscan{BirthDate: birth, Sex: "male"}, 25, 25.5,
+            Metrics{FatMass: 20, LeanMass: 60, Age: 40, BMICategory: "Overweight", BMRKatchMcArdle: 1666}},
+        {"no sex", Innerscan{BirthDate: birth, Hight: 180}, 25, 25.5,
+            Metrics{FatMass: 20, LeanMass: 60, Age: 40, BMICategory: "Overweight", BMRKatchMcArdle: 1666}},
+        {"no birth date", Innerscan{Hight: 180, Sex: "male"}, 25, 25.5,
+            Metrics{FatMass: 20, LeanMass: 60, BMICategory: "Overweight", BMRKatchMcArdle: 1666}},
+        {"no body fat", Innerscan{BirthDate: birth, Hight: 180, Sex: "male"}, 0, 25.5,
+            Metrics{Age: 40, BMICategory: "Overweight", BMRMifflinStJeor: 1730}},
+        {"no BMI", Innerscan{BirthDate: birth, Hight: 180, Sex: "male"}, 25, 0,
+            Metrics{FatMass: 20, LeanMass: 60, Age: 40, BMRMifflinStJeor: 1730, BMRKatchMcArdle: 1666}},
+        {"nothing", Innerscan{}, 0, 0, Metrics{}},
+    }
+    for _, tt := range tests {
+        innerscan := tt.innerscan
+        innerscan.Data = []*InnerscanData{{Date: date, Weight: 80, BodyFat: tt.bodyFat, BMI: tt.bmi}}
+        innerscan.CalcMetrics()
+        got := innerscan.Data[0].Metrics
+        if got == nil {
+            t.Errorf("%s: no metrics", tt.name)
+            continue
+        }
+        if !near(got.FatMass, tt.want.FatMass) || !near(got.LeanMass, tt.want.LeanMass) || got.Age != tt.want.Age || got.BMICategory != tt.want.BMICategory ||
+            !near(got.BMRMifflinStJeor, tt.want.BMRMifflinStJeor) || !near(got.BMRKatchMcArdle, tt.want.BMRKatchMcArdle) {
+            t.Errorf("%s: metrics = %+v, want %+v", tt.name, *got, tt.want)
+        }
+    }
+}
@@ -8,6 +8,18 @@ import (
     "math"
 )
 
+// DefaultAPILocation is the time zone of HealthPlanet, which returns the measurement dates in JST wall-clock time.
+var DefaultAPILocation = loadAPILocation()
+
+func loadAPILocation() *time.Location {
+    loc, err := time.LoadLocation("Asia/Tokyo")
+    if err != nil {
+        // no time zone database, JST has no daylight saving time
+        return time.FixedZone("JST", 9*60*60)
+    }
+    return loc
+}
+
 // API response structures
 type InnerscanDataResponse struct {
     Date string `json:"date"`
@@ -24,10 +36,30 @@ type InnerscanResponse struct {
 }
 
 type InnerscanData struct {
-    Date time.Time
-    Weight float64
-    BodyFat float64
-    BMI float64     // Calc from Weight and Height(it is defined in `Innerscan` struct)
+    Date time.Time `json:"date"`
+    Model string `json:"model,omitempty"`     // Device model which made the measurement
+    Weight float64 `json:"weight"`
+    BodyFat float64 `json:"body_fat"`
+    BMI float64 `json:"bmi"`                  // Calc from Weight and Height(it is defined in `Innerscan` struct)
+
+    // optional values calculated from the series, nil if not calculated
+    Trend *Trend `json:"trend,omitempty"`
+    Metrics *Metrics `json:"metrics,omitempty"` // set by Innerscan.CalcMetrics
+    Outlier *OutlierMark `json:"outlier,omitempty"`
+    Synthetic bool `json:"synthetic,omitempty"` // filled by the resampler, not measured
+}
+
+// Trend is the smoothed weight at the measurement, calculated by the analytics package.
+type Trend struct {
+    SMA float64 `json:"sma"`     // simple moving average (kg)
+    EWMA float64 `json:"ewma"`   // exponentially weighted moving average (kg)
+    Slope float64 `json:"slope"` // slope of the linear regression (kg/week)
+}
+
+// OutlierMark is the result of the outlier detection of the analytics package.
+type OutlierMark struct {
+    Outlier bool `json:"outlier"`
+    Reason string `json:"reason,omitempty"`
 }
 
 func (d *InnerscanData) Validate() error {
@@ -48,13 +80,31 @@ func (d *InnerscanData) Validate() error {
 
 // Decoded data
 type Innerscan struct {
-    BirthDate time.Time
-    Hight float64
-    Sex string
-    Data []*InnerscanData
+    BirthDate time.Time `json:"birth_date"`
+    Hight float64 `json:"height"`
+    Sex string `json:"sex"`
+    Data []*InnerscanData `json:"data"`
 }
 
+// ToInnerscan decodes the response, unifying the measurements per day.
+// The dates are the wall-clock times of the response in the time zone of HealthPlanet (DefaultAPILocation).
 func (ir *InnerscanResponse) ToInnerscan() (*Innerscan, error) {
+    return ir.ToInnerscanIn(DefaultAPILocation, DefaultAPILocation)
+}
+
+// ToInnerscanIn decodes the response like ToInnerscan with explicit time zones.
+// The dates in the response are parsed as wall-clock times in apiLoc and converted into loc,
+// and the measurements are unified per day in loc.
+func (ir *InnerscanResponse) ToInnerscanIn(apiLoc *time.Location, loc *time.Location) (*Innerscan, error) {
+    innerscan, err := ir.ToMeasurements(apiLoc, loc)
+    if err != nil {
+        return nil, err
+    }
+    return innerscan.UniqByDay(), nil
+}
+
+// ToMeasurements decodes the response like ToInnerscanIn, but keeps all measurements.
+func (ir *InnerscanResponse) ToMeasurements(apiLoc *time.Location, loc *time.Location) (*Innerscan, error) {
     innerscan := &Innerscan{
         Data: make([]*InnerscanData, 0),
     }
@@ -74,19 +124,21 @@ func (ir *InnerscanResponse) ToInnerscan() (*Innerscan, error) {
     innerscan.Hight = height
 
     // convert data with map
-    // key: date in "2006-01-02 15:04:05" format
+    // key: date in "2006-01-02 15:04" format and device model
     // Because a mesurement made is made up of multiple data, we need to merge them by date
     dates := make(map[string] *InnerscanData)
     for _, d := range ir.Data {
-        date, err := time.Parse("200601021504", d.Date)
-        key := date.Format("2006-01-02 15:04")
+        date, err := time.ParseInLocation("200601021504", d.Date, apiLoc)
         if err != nil {
             return nil, fmt.Errorf("failed to parse date: %w", err)
         }
+        date = date.In(loc)
+        key := date.Format("2006-01-02 15:04") + " " + d.Model
         // if mesurement data is not exist, add it
         if _, ok := dates[key]; !ok {
             dates[key] = &InnerscanData{
                 Date: date,
+                Model: d.Model,
                 Weight: 0,
                 BodyFat: 0,
                 BMI: 0,
@@ -121,35 +173,91 @@ func (ir *InnerscanResponse) ToInnerscan() (*Innerscan, error) {
     }
 
     // validate all data and if not valid, delete it
-    for _, d := range dates {
+    for key, d := range dates {
         if err := d.Validate(); err != nil {
-            delete(dates, d.Date.Format("2006-01-02 15:04"))
+            delete(dates, key)
         }
     }
 
-    // convert data with uniq by date
-    // if there are multiple data for the same date, keep the latest one
-    
-    // sort keys 
-    keys := make([]string, 0, len(dates))
-    for k := range dates {
-        keys = append(keys, k)
+    for _, d := range dates {
+        innerscan.Data = append(innerscan.Data, d)
+    }
+    innerscan.Sort()
+
+    return innerscan, nil
+}
+
+// Sort sorts the data by date (and device model for the same date).
+func (i *Innerscan) Sort() {
+    sort.SliceStable(i.Data, func(a, b int) bool {
+        if !i.Data[a].Date.Equal(i.Data[b].Date) {
+            return i.Data[a].Date.Before(i.Data[b].Date)
+        }
+        return i.Data[a].Model < i.Data[b].Model
+    })
+}
+
+// UniqByDay returns a copy which has one measurement per day.
+// If there are multiple data for the same date, keep the latest one which is not marked as an outlier.
+// The day is decided in the location of each date, and the data must be sorted by date.
+func (i *Innerscan) UniqByDay() *Innerscan {
+    ret := &Innerscan{
+        BirthDate: i.BirthDate,
+        Hight: i.Hight,
+        Sex: i.Sex,
+        Data: make([]*InnerscanData, 0, len(i.Data)),
     }
-    sort.Strings(keys)
+    for _, d := range i.Data {
+        n := len(ret.Data)
+        if n > 0 && ret.Data[n-1].Day() == d.Day() {
+            // overwrite if same date, unless only the new one is an outlier
+            if !d.IsOutlier() || ret.Data[n-1].IsOutlier() {
+                ret.Data[n-1] = d
+            }
+            continue
+        }
+        ret.Data = append(ret.Data, d)
+    }
+    return ret
+}
 
-    // uniq by date(overwrite if same date)
-    uniqueData := make(map[string]*InnerscanData)
-    for _, k := range keys { // k is formatted date "2006-01-02 15:04"
-        day := k[:10] // "2006-01-02"
-        uniqueData[day] = dates[k]
+// WithoutOutliers returns a copy without the data marked as outliers (see IsOutlier).
+func (i *Innerscan) WithoutOutliers() *Innerscan {
+    ret := &Innerscan{
+        BirthDate: i.BirthDate,
+        Hight: i.Hight,
+        Sex: i.Sex,
+        Data: make([]*InnerscanData, 0, len(i.Data)),
+    }
+    for _, d := range i.Data {
+        if !d.IsOutlier() {
+            ret.Data = append(ret.Data, d)
+        }
     }
+    return ret
+}
 
-    for _, k := range keys {
-        day := k[:10]
-        innerscan.Data = append(innerscan.Data, uniqueData[day])
+// CalcBMI calculates BMI of the data which has no BMI, if the height is available.
+func (i *Innerscan) CalcBMI() {
+    if i.Hight == 0 {
+        return
     }
+    for _, d := range i.Data {
+        if d.BMI == 0 && d.Weight != 0 {
+            d.BMI = d.Weight / math.Pow(i.Hight/100, 2)
+        }
+    }
+}
 
-    return innerscan, nil
+// IsOutlier reports whether the data is marked as an outlier by the outlier detection (-outliers mark).
+// The marked data are kept in the export, but are not measurements for the analytics and the sinks.
+func (d *InnerscanData) IsOutlier() bool {
+    return d.Outlier != nil && d.Outlier.Outlier
+}
+
+// Day returns the date in "2006-01-02" format.
+func (d *InnerscanData) Day() string {
+    return d.Date.Format("2006-01-02")
 }
 
 
@@ -158,15 +266,3 @@ func (ir *InnerscanResponse) ToInnerscan() (*Innerscan, error) {
 func (d *InnerscanData) String() string {
     return fmt.Sprintf("(%s)Weight: %f, BMI: %f, BodyFat: %f", d.Date, d.Weight, d.BMI, d.BodyFat)
 }
-
-// CSV Conversion
-func (i *Innerscan) CsvHeader() string {
-    return "Date,Weight,BMI,Fat"
-}
-func (i *Innerscan) ToCsv() string {
-    ret := i.CsvHeader() + "\n"
-    for _, d := range i.Data {
-        ret += fmt.Sprintf("%s,%f,%f,%f\n", d.Date.Format("2006-01-02"), d.Weight, d.BMI, d.BodyFat)
-    }
-    return ret
-}
@@ -0,0 +1,140 @@
+package healthplanet
+
+import (
+    "fmt"
+    "testing"
+    "time"
+)
+
+func testResponse() *InnerscanResponse {
+    return &InnerscanResponse{
+        BirthDate: "19850412",
+        Height: "172.0",
+        Sex: "male",
+        Data: []InnerscanDataResponse{
+            {Date: "202504010730", KeyData: "66.40", Tag: "6021", Model: "01000117"},
+            {Date: "202504010730", KeyData: "20.6", Tag: "6022", Model: "01000117"},
+            // the same day in JST, but the previous day in UTC
+            {Date: "202504020800", KeyData: "66.20", Tag: "6021", Model: "01000117"},
+            {Date: "202504022230", KeyData: "66.80", Tag: "6021", Model: "01000117"},
+        },
+    }
+}
+
+func TestToInnerscan(t *testing.T) {
+    innerscan, err := testResponse().ToInnerscan()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if innerscan.Hight != 172 || innerscan.Sex != "male" || !innerscan.BirthDate.Equal(time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC)) {
+        t.Errorf("body information = %v %v %v", innerscan.Hight, innerscan.Sex, innerscan.BirthDate)
+    }
+
+    // the wall-clock times of the response, the last measurement of each day
+    want := []string{"2025-04-01 07:30 66.4 20.6", "2025-04-02 22:30 66.8 0"}
+    if len(innerscan.Data) != len(want) {
+        t.Fatalf("got %d measurements, want %d", len(innerscan.Data), len(want))
+    }
+    for i, d := range innerscan.Data {
+        got := fmt.Sprintf("%s %g %g", d.Date.Format("2006-01-02 15:04"), d.Weight, d.BodyFat)
+        if got != want[i] {
+            t.Errorf("measurement %d = %q, want %q", i, got, want[i])
+        }
+        if d.Date.Location() != DefaultAPILocation {
+            t.Errorf("measurement %d is in %v, want %v", i, d.Date.Location(), DefaultAPILocation)
+        }
+    }
+    if bmi := innerscan.Data[0].BMI; bmi < 22.44 || bmi > 22.45 {
+        t.Errorf("BMI = %v, want 66.4 / 1.72^2", bmi)
+    }
+}
+
+func TestToInnerscanIn(t *testing.T) {
+    innerscan, err := testResponse().ToInnerscanIn(DefaultAPILocation, time.UTC)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // the measurements of 2025-04-02 in JST are on two days in UTC
+    want := []string{"2025-03-31 22:30", "2025-04-01 23:00", "2025-04-02 13:30"}
+    if len(innerscan.Data) != len(want) {
+        t.Fatalf("got %d measurements, want %d", len(innerscan.Data), len(want))
+    }
+    for i, d := range innerscan.Data {
+        if got := d.Date.Format("2006-01-02 15:04"); got != want[i] || d.Date.Location() != time.UTC {
+            t.Errorf("measurement %d = %s %v, want %s UTC", i, got, d.Date.Location(), want[i])
+        }
+    }
+
+    all, err := testResponse().ToMeasurements(DefaultAPILocation, DefaultAPILocation)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(all.Data) != 3 {
+        t.Errorf("ToMeasurements got %d measurements, want all 3", len(all.Data))
+    }
+}
+
+func TestToInnerscanInvalid(t *testing.T) {
+    tests := []func(r *InnerscanResponse){
+        func(r *InnerscanResponse) { r.BirthDate = "1985-04-12" },
+        func(r *InnerscanResponse) { r.Height = "tall" },
+        func(r *InnerscanResponse) { r.Data[0].Date = "2025-04-01" },
+        func(r *InnerscanResponse) { r.Data[0].KeyData = "heavy" },
+        func(r *InnerscanResponse) { r.Data[0].Tag = "6023" },
+    }
+    for i, modify := range tests {
+        r := testResponse()
+        modify(r)
+        if _, err := r.ToInnerscan(); err == nil {
+            t.Errorf("case %d: ToInnerscan succeeded, want error", i)
+        }
+    }
+}
+
+func TestUniqByDayOutliers(t *testing.T) {
+    at := func(day int, hour int) time.Time {
+        return time.Date(2025, 4, day, hour, 0, 0, 0, time.UTC)
+    }
+    mark := func(outlier bool) *OutlierMark {
+        return &OutlierMark{Outlier: outlier}
+    }
+    innerscan := &Innerscan{Data: []*InnerscanData{
+        // an outlier after the weigh-in
+        {Date: at(1, 7), Weight: 66.4, Outlier: mark(false)},
+        {Date: at(1, 8), Weight: 33.0, Outlier: mark(true)},
+        // an outlier before the weigh-in
+        {Date: at(2, 7), Weight: 33.1, Outlier: mark(true)},
+        {Date: at(2, 8), Weight: 66.2, Outlier: mark(false)},
+        // two weigh-ins and an outlier, the latest weigh-in wins
+        {Date: at(3, 7), Weight: 66.0, Outlier: mark(false)},
+        {Date: at(3, 8), Weight: 66.1, Outlier: mark(false)},
+        {Date: at(3, 9), Weight: 33.2, Outlier: mark(true)},
+        // only outliers, the latest one is kept
+        {Date: at(4, 7), Weight: 33.3, Outlier: mark(true)},
+        {Date: at(4, 8), Weight: 33.4, Outlier: mark(true)},
+        // not marked
+        {Date: at(5, 7), Weight: 65.9},
+        {Date: at(5, 8), Weight: 65.8},
+    }}
+
+    want := []float64{66.4, 66.2, 66.1, 33.4, 65.8}
+    uniq := innerscan.UniqByDay()
+    if len(uniq.Data) != len(want) {
+        t.Fatalf("UniqByDay() = %d data, want %d", len(uniq.Data), len(want))
+    }
+    for i, w := range want {
+        if uniq.Data[i].Weight != w {
+            t.Errorf("UniqByDay() data %d weight = %v, want %v", i, uniq.Data[i].Weight, w)
+        }
+    }
+
+    without := innerscan.WithoutOutliers()
+    if len(without.Data) != 6 {
+        t.Errorf("WithoutOutliers() = %d data, want 6", len(without.Data))
+    }
+    for _, d := range without.Data {
+        if d.IsOutlier() {
+            t.Errorf("WithoutOutliers() has the outlier %v", d.Weight)
+        }
+    }
+}
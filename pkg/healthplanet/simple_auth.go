@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -64,6 +65,11 @@ func (t *Token) IsTokenExpired() bool {
     return t.CreateDate + t.ExpiresIn < time.Now().Unix()
 }
 
+// ExpiresAt returns the time when the access token expires.
+func (t *Token) ExpiresAt() time.Time {
+    return time.Unix(t.CreateDate + t.ExpiresIn, 0)
+}
+
 func (t *Token) IsTokenNeedRefresh() bool {
     return t.CreateDate + t.ExpiresIn - TokenRefreshThreshold < time.Now().Unix()
 }
@@ -116,6 +122,11 @@ func (a *SimpleAuth) SaveToken() error {
         return err
     }
 
+    err = os.MkdirAll(filepath.Dir(a.TokenFile), 0700)
+    if err != nil {
+        return err
+    }
+
     f, err := os.OpenFile(a.TokenFile, os.O_CREATE|os.O_WRONLY, 0644)
     if err != nil {
         return err
@@ -145,6 +156,15 @@ func (a *SimpleAuth) LoadToken() error {
     return nil
 }
 
+// TokenExpiry loads the token file and returns when the access token expires.
+func (a *SimpleAuth) TokenExpiry() (time.Time, error) {
+    err := a.LoadToken()
+    if err != nil {
+        return time.Time{}, err
+    }
+    return a.token.ExpiresAt(), nil
+}
+
 func (a *SimpleAuth) ValidateToken() error {
     // TODO: implement!!!!!
     return nil
@@ -272,6 +292,8 @@ func (a *SimpleAuth) RefreshToken() error{
     if err != nil {
         return err
     }
+    // expires_in is from now
+    a.token.CreateDate = time.Now().Unix()
     a.Logger.Info("Successfully refreshed token")
 
     err = a.SaveToken()
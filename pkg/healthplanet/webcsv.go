@@ -0,0 +1,239 @@
+package healthplanet
+
+import (
+    "bytes"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+    "unicode/utf8"
+    "golang.org/x/text/encoding/japanese"
+    "golang.org/x/text/width"
+)
+
+/*
+ParseWebCsv parses the CSV file which the HealthPlanet website offers for download.
+
+The file is encoded in Shift-JIS (UTF-8 is also accepted) and has Japanese column headers, e.g.
+
+    測定日時,体重(kg),体脂肪率(%),...
+    2019/01/05 07:30,70.50,21.0,...
+
+The columns are found by their headers, so the order and the extra columns do not matter,
+and a date column and a time column may also be separated ("日付" and "時刻").
+As the HealthPlanet API, the times are wall-clock times in apiLoc, and are converted into loc.
+
+The file has no height, so BMI is set only if the file has a BMI column.
+Use Innerscan.CalcBMI after setting the height.
+*/
+
+// web CSV column headers (normalized by normalizeHeader), matched by prefix
+var (
+    webCsvDateTimeHeaders = []string{"測定日時", "日時", "datetime"}
+    webCsvDateHeaders = []string{"測定日", "日付", "date"}
+    webCsvTimeHeaders = []string{"測定時刻", "時刻", "time"}
+    webCsvWeightHeaders = []string{"体重", "weight"}
+    webCsvBodyFatHeaders = []string{"体脂肪率", "bodyfat", "fat"}
+    webCsvBMIHeaders = []string{"bmi"}
+    webCsvModelHeaders = []string{"機種", "モデル", "model"}
+)
+
+var webCsvDateLayouts = []string{
+    "2006/01/02 15:04:05",
+    "2006/01/02 15:04",
+    "2006/1/2 15:04:05",
+    "2006/1/2 15:04",
+    "2006-01-02 15:04:05",
+    "2006-01-02 15:04",
+    "2006年01月02日 15:04",
+    "2006年1月2日 15:04",
+    "2006年01月02日 15時04分",
+    "200601021504",
+    "2006/01/02",
+    "2006/1/2",
+    "2006-01-02",
+    "2006年01月02日",
+    "2006年1月2日",
+    "20060102",
+}
+
+// decodeWebCsv converts the content into UTF-8, detecting Shift-JIS.
+func decodeWebCsv(content []byte) ([]byte, error) {
+    content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+    if utf8.Valid(content) {
+        return content, nil
+    }
+    decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(content)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decode as Shift-JIS: %w", err)
+    }
+    return decoded, nil
+}
+
+// normalizeHeader converts full-width characters into half-width, and removes spaces and units.
+func normalizeHeader(header string) string {
+    header = width.Narrow.String(width.Fold.String(header))
+    header = strings.ToLower(strings.Join(strings.Fields(header), ""))
+    if i := strings.IndexAny(header, "(["); i > 0 {
+        header = header[:i]
+    }
+    return strings.Trim(header, `"`)
+}
+
+// findColumn returns the index of the first column whose header starts with one of the names, or -1.
+func findColumn(headers []string, names []string) int {
+    for _, name := range names {
+        for i, header := range headers {
+            if strings.HasPrefix(header, name) {
+                return i
+            }
+        }
+    }
+    return -1
+}
+
+type webCsvColumns struct {
+    dateTime, date, time, weight, bodyFat, bmi, model int
+}
+
+func findWebCsvColumns(record []string) (*webCsvColumns, bool) {
+    headers := make([]string, len(record))
+    for i, h := range record {
+        headers[i] = normalizeHeader(h)
+    }
+    c := &webCsvColumns{
+        dateTime: findColumn(headers, webCsvDateTimeHeaders),
+        date: findColumn(headers, webCsvDateHeaders),
+        time: findColumn(headers, webCsvTimeHeaders),
+        weight: findColumn(headers, webCsvWeightHeaders),
+        bodyFat: findColumn(headers, webCsvBodyFatHeaders),
+        bmi: findColumn(headers, webCsvBMIHeaders),
+        model: findColumn(headers, webCsvModelHeaders),
+    }
+    if c.dateTime == c.date {
+        // "測定日時" also matches "測定日"
+        c.date = -1
+    }
+    if (c.dateTime < 0 && c.date < 0) || c.weight < 0 {
+        return nil, false
+    }
+    return c, true
+}
+
+func field(record []string, i int) string {
+    if i < 0 || i >= len(record) {
+        return ""
+    }
+    return strings.TrimSpace(width.Narrow.String(width.Fold.String(record[i])))
+}
+
+// parseWebCsvValue parses a number, treating empty and "-" as no value.
+func parseWebCsvValue(value string) (float64, bool, error) {
+    value = strings.TrimSpace(strings.TrimRight(value, "kg%"))
+    if value == "" || value == "-" || value == "--" {
+        return 0, false, nil
+    }
+    v, err := strconv.ParseFloat(value, 64)
+    if err != nil {
+        return 0, false, err
+    }
+    return v, true, nil
+}
+
+func parseWebCsvDate(value string, apiLoc *time.Location) (time.Time, error) {
+    for _, layout := range webCsvDateLayouts {
+        if date, err := time.ParseInLocation(layout, value, apiLoc); err == nil {
+            return date, nil
+        }
+    }
+    return time.Time{}, fmt.Errorf("unknown date format: %q", value)
+}
+
+func ParseWebCsv(r io.Reader, apiLoc *time.Location, loc *time.Location) (*Innerscan, error) {
+    content, err := io.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+    content, err = decodeWebCsv(content)
+    if err != nil {
+        return nil, err
+    }
+
+    reader := csv.NewReader(bytes.NewReader(content))
+    reader.FieldsPerRecord = -1
+    reader.LazyQuotes = true
+
+    innerscan := &Innerscan{
+        Data: make([]*InnerscanData, 0),
+    }
+
+    // skip the lines before the header, e.g. the title of the file
+    var columns *webCsvColumns
+    line := 0
+    for columns == nil {
+        record, err := reader.Read()
+        if errors.Is(err, io.EOF) {
+            return nil, errors.New("no header with date and weight columns found (e.g. \"測定日時,体重(kg),体脂肪率(%)\")")
+        }
+        if err != nil {
+            return nil, err
+        }
+        line++
+        columns, _ = findWebCsvColumns(record)
+    }
+
+    for {
+        record, err := reader.Read()
+        if errors.Is(err, io.EOF) {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        line++
+
+        dateValue := field(record, columns.dateTime)
+        if dateValue == "" {
+            dateValue = strings.TrimSpace(field(record, columns.date) + " " + field(record, columns.time))
+        }
+        if dateValue == "" {
+            continue
+        }
+        date, err := parseWebCsvDate(dateValue, apiLoc)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %w", line, err)
+        }
+
+        d := &InnerscanData{
+            Date: date.In(loc),
+            Model: field(record, columns.model),
+        }
+        weight, ok, err := parseWebCsvValue(field(record, columns.weight))
+        if err != nil {
+            return nil, fmt.Errorf("line %d: failed to parse weight: %w", line, err)
+        }
+        if !ok {
+            // measurements without weight (e.g. blood pressure only) are skipped
+            continue
+        }
+        d.Weight = weight
+        if d.BodyFat, _, err = parseWebCsvValue(field(record, columns.bodyFat)); err != nil {
+            return nil, fmt.Errorf("line %d: failed to parse body fat: %w", line, err)
+        }
+        if d.BMI, _, err = parseWebCsvValue(field(record, columns.bmi)); err != nil {
+            return nil, fmt.Errorf("line %d: failed to parse BMI: %w", line, err)
+        }
+
+        // invalid data is deleted as ToInnerscan does
+        if err := d.Validate(); err != nil {
+            continue
+        }
+        innerscan.Data = append(innerscan.Data, d)
+    }
+
+    innerscan.Sort()
+    return innerscan, nil
+}
@@ -0,0 +1,106 @@
+package healthplanet
+
+import (
+    "os"
+    "strings"
+    "testing"
+    "time"
+)
+
+type webCsvRow struct {
+    date time.Time
+    weight float64
+    bodyFat float64
+    bmi float64
+    model string
+}
+
+func checkWebCsv(t *testing.T, name string, innerscan *Innerscan, want []webCsvRow) {
+    t.Helper()
+    if len(innerscan.Data) != len(want) {
+        t.Fatalf("%s: %d data, want %d", name, len(innerscan.Data), len(want))
+    }
+    for i, w := range want {
+        d := innerscan.Data[i]
+        if !d.Date.Equal(w.date) || d.Weight != w.weight || d.BodyFat != w.bodyFat || d.BMI != w.bmi || d.Model != w.model {
+            t.Errorf("%s: data %d = %s %v %v %v %q, want %s %v %v %v %q", name, i,
+                d.Date.Format(time.RFC3339), d.Weight, d.BodyFat, d.BMI, d.Model,
+                w.date.Format(time.RFC3339), w.weight, w.bodyFat, w.bmi, w.model)
+        }
+    }
+}
+
+func TestParseWebCsvShiftJIS(t *testing.T) {
+    // a title line, then the Japanese headers with separated date and time columns, encoded in Shift-JIS
+    f, err := os.Open("testdata/web_sjis.csv")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+
+    innerscan, err := ParseWebCsv(f, DefaultAPILocation, time.UTC)
+    if err != nil {
+        t.Fatal(err)
+    }
+    at := func(day int, hour int, min int) time.Time {
+        return time.Date(2025, 4, day, hour, min, 0, 0, DefaultAPILocation)
+    }
+    // the row without weight is skipped, the full-width digits and model are narrowed
+    checkWebCsv(t, "Shift-JIS", innerscan, []webCsvRow{
+        {at(1, 7, 30), 66.4, 20.5, 22.4, "BC768"},
+        {at(2, 7, 45), 66.2, 0, 22.3, "BC768"},
+        {at(4, 6, 5), 65.9, 19.8, 0, "BC768"},
+    })
+    for _, d := range innerscan.Data {
+        if d.Date.Location() != time.UTC {
+            t.Errorf("date %s is not converted into UTC", d.Date)
+        }
+    }
+}
+
+func TestParseWebCsv(t *testing.T) {
+    at := func(day int, hour int, min int) time.Time {
+        return time.Date(2025, 4, day, hour, min, 0, 0, DefaultAPILocation)
+    }
+    tests := []struct {
+        name string
+        content string
+        want []webCsvRow
+    }{
+        {"date and time column", "\xef\xbb\xbf測定日時,体重(kg),体脂肪率(%)\n2025/04/02 07:45,66.20,20.1\n2025/04/01 07:30:15,66.40,20.5\n",
+            []webCsvRow{{at(1, 7, 30).Add(15 * time.Second), 66.4, 20.5, 0, ""}, {at(2, 7, 45), 66.2, 20.1, 0, ""}}},
+        {"full-width headers and extra columns", "メモ,測定日,測定時刻,筋肉量(kg),体重（ｋｇ）\nx,2025年4月1日,07:30,50.1,66.4\n",
+            []webCsvRow{{at(1, 7, 30), 66.4, 0, 0, ""}}},
+        {"English headers", "Date,Time,Weight,BMI,Model\n2025-04-01,07:30,66.4,22.4,01000117\n",
+            []webCsvRow{{at(1, 7, 30), 66.4, 0, 22.4, "01000117"}}},
+        {"date only", "日付,体重\n2025/04/01,66.4\n",
+            []webCsvRow{{at(1, 0, 0), 66.4, 0, 0, ""}}},
+    }
+    for _, tt := range tests {
+        innerscan, err := ParseWebCsv(strings.NewReader(tt.content), DefaultAPILocation, DefaultAPILocation)
+        if err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+            continue
+        }
+        checkWebCsv(t, tt.name, innerscan, tt.want)
+    }
+}
+
+func TestParseWebCsvErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        content string
+        message string
+    }{
+        {"no header", "a,b,c\n1,2,3\n", "no header"},
+        {"no weight column", "測定日時,体脂肪率(%)\n2025/04/01 07:30,20.5\n", "no header"},
+        {"bad date", "測定日時,体重(kg)\n01.04.2025,66.4\n", "line 2: unknown date format"},
+        {"bad weight", "測定日時,体重(kg)\n2025/04/01 07:30,heavy\n", "line 2: failed to parse weight"},
+    }
+    for _, tt := range tests {
+        _, err := ParseWebCsv(strings.NewReader(tt.content), DefaultAPILocation, DefaultAPILocation)
+        if err == nil || !strings.Contains(err.Error(), tt.message) {
+            t.Errorf("%s: error = %v, want %q", tt.name, err, tt.message)
+        }
+    }
+}
@@ -0,0 +1,236 @@
+package influx
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Export of the measurements to InfluxDB.
+
+LineProtocol encodes the measurements in the InfluxDB line protocol, one line per measurement:
+
+    innerscan,model=01000117,profile=alice bmi=22.46,body_fat=20.62,weight=66.46 1760652600000000000
+
+The timestamp is the measurement time in nanoseconds, the tags are the given ones (e.g. profile) and the device model,
+and the fields are the decoded values and the derived metrics and the trend if they are calculated.
+
+Writer writes the lines to the /api/v2/write endpoint of InfluxDB 2.x (or compatible, e.g. InfluxDB 3 and VictoriaMetrics),
+in requests of BatchSize lines at most, as InfluxDB recommends 5000 lines per request.
+A failed request stops the write, and the batches before it are already written.
+
+Usage:
+```
+lines := influx.LineProtocol("innerscan", map[string]string{"profile": "alice"}, innerscan)
+w := influx.NewWriter("http://localhost:8086", "home", "health", "token")
+err := w.Write(ctx, lines)
+```
+*/
+
+const DefaultMeasurement = "innerscan"
+
+// DefaultBatchSize is the max number of lines per request.
+const DefaultBatchSize = 5000
+
+var (
+    measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+    tagEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+    stringFieldEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// field is a field of a line, value is already encoded.
+type field struct {
+    key string
+    value string
+}
+
+func floatField(key string, v float64) field {
+    return field{key, strconv.FormatFloat(v, 'f', -1, 64)}
+}
+
+// fields returns the fields of the data, skipping the missing (0) values.
+func fields(d *healthplanet.InnerscanData) []field {
+    fs := []field{floatField("weight", d.Weight)}
+    if d.BodyFat != 0 {
+        fs = append(fs, floatField("body_fat", d.BodyFat))
+    }
+    if d.BMI != 0 {
+        fs = append(fs, floatField("bmi", d.BMI))
+    }
+    if m := d.Metrics; m != nil {
+        if m.FatMass != 0 {
+            fs = append(fs, floatField("fat_mass", m.FatMass))
+        }
+        if m.LeanMass != 0 {
+            fs = append(fs, floatField("lean_mass", m.LeanMass))
+        }
+        if m.Age != 0 {
+            fs = append(fs, field{"age", strconv.Itoa(m.Age) + "i"})
+        }
+        if m.BMICategory != "" {
+            fs = append(fs, field{"bmi_category", `"` + stringFieldEscaper.Replace(m.BMICategory) + `"`})
+        }
+        if m.BMRMifflinStJeor != 0 {
+            fs = append(fs, floatField("bmr_mifflin_st_jeor", m.BMRMifflinStJeor))
+        }
+        if m.BMRKatchMcArdle != 0 {
+            fs = append(fs, floatField("bmr_katch_mcardle", m.BMRKatchMcArdle))
+        }
+    }
+    if t := d.Trend; t != nil {
+        fs = append(fs, floatField("weight_sma", t.SMA), floatField("weight_ewma", t.EWMA), floatField("weight_slope", t.Slope))
+    }
+    if d.Synthetic {
+        fs = append(fs, field{"synthetic", "true"})
+    }
+    sort.Slice(fs, func(i, j int) bool { return fs[i].key < fs[j].key })
+    return fs
+}
+
+// Line returns the line of the data, without the newline.
+func Line(measurement string, tags map[string]string, d *healthplanet.InnerscanData) string {
+    all := make(map[string]string, len(tags) + 1)
+    for k, v := range tags {
+        all[k] = v
+    }
+    if d.Model != "" {
+        all["model"] = d.Model
+    }
+    keys := make([]string, 0, len(all))
+    for k, v := range all {
+        // an empty tag value is not allowed
+        if v != "" {
+            keys = append(keys, k)
+        }
+    }
+    // sorted tags are the fastest for InfluxDB
+    sort.Strings(keys)
+
+    var b strings.Builder
+    b.WriteString(measurementEscaper.Replace(measurement))
+    for _, k := range keys {
+        fmt.Fprintf(&b, ",%s=%s", tagEscaper.Replace(k), tagEscaper.Replace(all[k]))
+    }
+    for i, f := range fields(d) {
+        sep := ","
+        if i == 0 {
+            sep = " "
+        }
+        fmt.Fprintf(&b, "%s%s=%s", sep, tagEscaper.Replace(f.key), f.value)
+    }
+    fmt.Fprintf(&b, " %d", d.Date.UnixNano())
+    return b.String()
+}
+
+// LineProtocol returns the lines of all data except the outliers, each with the newline.
+func LineProtocol(measurement string, tags map[string]string, innerscan *healthplanet.Innerscan) string {
+    var b strings.Builder
+    for _, d := range innerscan.WithoutOutliers().Data {
+        b.WriteString(Line(measurement, tags, d))
+        b.WriteString("\n")
+    }
+    return b.String()
+}
+
+// Writer writes the lines to the /api/v2/write endpoint.
+type Writer struct {
+    URL string     // base URL of InfluxDB, e.g. http://localhost:8086
+    Org string
+    Bucket string
+    Token string   // API token, sent as "Authorization: Token ..."
+    BatchSize int  // max lines per request, all lines in a request if 0
+    Client *http.Client
+}
+
+func NewWriter(url string, org string, bucket string, token string) *Writer {
+    return &Writer{
+        URL: url,
+        Org: org,
+        Bucket: bucket,
+        Token: token,
+        BatchSize: DefaultBatchSize,
+        Client: &http.Client{Timeout: 30 * time.Second},
+    }
+}
+
+// WriteURL returns the URL of the write endpoint with the query.
+func (w *Writer) WriteURL() (string, error) {
+    u, err := url.Parse(w.URL)
+    if err != nil {
+        return "", err
+    }
+    u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+    q := u.Query()
+    q.Set("org", w.Org)
+    q.Set("bucket", w.Bucket)
+    q.Set("precision", "ns")
+    u.RawQuery = q.Encode()
+    return u.String(), nil
+}
+
+// Write writes the lines in batches of BatchSize lines. Nothing is sent for no lines.
+func (w *Writer) Write(ctx context.Context, lines string) error {
+    if lines == "" {
+        return nil
+    }
+    writeURL, err := w.WriteURL()
+    if err != nil {
+        return err
+    }
+    for _, batch := range batches(lines, w.BatchSize) {
+        err = w.post(ctx, writeURL, batch)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// batches splits the lines into batches of size lines, each line with the newline.
+func batches(lines string, size int) []string {
+    all := strings.SplitAfter(strings.TrimSuffix(lines, "\n"), "\n")
+    if size <= 0 || len(all) <= size {
+        return []string{lines}
+    }
+    ret := make([]string, 0, (len(all) + size - 1) / size)
+    for start := 0; start < len(all); start += size {
+        end := min(start + size, len(all))
+        ret = append(ret, strings.Join(all[start:end], ""))
+    }
+    // the last line has lost its newline by TrimSuffix
+    if strings.HasSuffix(lines, "\n") {
+        ret[len(ret)-1] += "\n"
+    }
+    return ret
+}
+
+func (w *Writer) post(ctx context.Context, writeURL string, lines string) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, writeURL, bytes.NewBufferString(lines))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+    if w.Token != "" {
+        req.Header.Set("Authorization", "Token " + w.Token)
+    }
+
+    resp, err := w.Client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode / 100 != 2 {
+        body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return fmt.Errorf("[InfluxDB]write failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+    }
+    return nil
+}
@@ -0,0 +1,191 @@
+package influx
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+    "github.com/kamaboko123/tanita2csv/pkg/influx/influxtest"
+)
+
+var testDate = time.Date(2025, 4, 1, 7, 30, 0, 0, time.UTC)
+
+func TestLine(t *testing.T) {
+    tests := []struct {
+        name string
+        measurement string
+        tags map[string]string
+        data *healthplanet.InnerscanData
+        want string
+    }{
+        {"basic", "innerscan", map[string]string{"profile": "alice"},
+            &healthplanet.InnerscanData{Date: testDate, Model: "01000117", Weight: 66.4, BodyFat: 20.6, BMI: 22.45},
+            "innerscan,model=01000117,profile=alice bmi=22.45,body_fat=20.6,weight=66.4 1743492600000000000"},
+        // the missing values and the empty tags are skipped
+        {"missing values", "innerscan", map[string]string{"profile": ""},
+            &healthplanet.InnerscanData{Date: testDate, Weight: 66.4},
+            "innerscan weight=66.4 1743492600000000000"},
+        {"escaped measurement", "body scan,v2", nil,
+            &healthplanet.InnerscanData{Date: testDate, Weight: 66.4},
+            `body\ scan\,v2 weight=66.4 1743492600000000000`},
+        {"escaped tags", "innerscan", map[string]string{"profile": "Alice Smith,Jr=1", "home site": "a"},
+            &healthplanet.InnerscanData{Date: testDate, Weight: 66.4},
+            `innerscan,home\ site=a,profile=Alice\ Smith\,Jr\=1 weight=66.4 1743492600000000000`},
+        {"metrics and trend", "innerscan", nil,
+            &healthplanet.InnerscanData{Date: testDate, Weight: 80, BodyFat: 25,
+                Metrics: &healthplanet.Metrics{FatMass: 20, LeanMass: 60, Age: 40, BMICategory: "Normal", BMRKatchMcArdle: 1666},
+                Trend: &healthplanet.Trend{SMA: 80.5, EWMA: 80.25, Slope: -0.5}},
+            `innerscan age=40i,bmi_category="Normal",bmr_katch_mcardle=1666,body_fat=25,fat_mass=20,lean_mass=60,weight=80,weight_ewma=80.25,weight_slope=-0.5,weight_sma=80.5 1743492600000000000`},
+        {"synthetic", "innerscan", nil,
+            &healthplanet.InnerscanData{Date: testDate, Weight: 66.4, Synthetic: true},
+            "innerscan synthetic=true,weight=66.4 1743492600000000000"},
+    }
+    for _, tt := range tests {
+        if got := Line(tt.measurement, tt.tags, tt.data); got != tt.want {
+            t.Errorf("%s: Line =\n%s\nwant\n%s", tt.name, got, tt.want)
+        }
+    }
+}
+
+// The tag escaper is also of the tag values and the field keys.
+func TestEscapers(t *testing.T) {
+    tests := []struct {
+        in string
+        measurement string
+        tag string
+    }{
+        {"weight", "weight", "weight"},
+        {"a b", `a\ b`, `a\ b`},
+        {"a,b", `a\,b`, `a\,b`},
+        {"a=b", "a=b", `a\=b`},
+        {"a\nb", `a\nb`, `a\nb`},
+    }
+    for _, tt := range tests {
+        if got := measurementEscaper.Replace(tt.in); got != tt.measurement {
+            t.Errorf("measurement %q is escaped as %q, want %q", tt.in, got, tt.measurement)
+        }
+        if got := tagEscaper.Replace(tt.in); got != tt.tag {
+            t.Errorf("tag %q is escaped as %q, want %q", tt.in, got, tt.tag)
+        }
+    }
+}
+
+func TestStringFieldEscape(t *testing.T) {
+    d := &healthplanet.InnerscanData{Date: testDate, Weight: 66.4, Metrics: &healthplanet.Metrics{BMICategory: `a "b" \c`}}
+    want := `bmi_category="a \"b\" \\c"`
+    if got := Line("innerscan", nil, d); !strings.Contains(got, want) {
+        t.Errorf("Line = %s, want %s in it", got, want)
+    }
+}
+
+func testInnerscan(n int) *healthplanet.Innerscan {
+    innerscan := &healthplanet.Innerscan{}
+    for i := 0; i < n; i++ {
+        innerscan.Data = append(innerscan.Data, &healthplanet.InnerscanData{Date: testDate.AddDate(0, 0, i), Model: "01000117", Weight: 66 + float64(i) / 10})
+    }
+    return innerscan
+}
+
+func TestWriter(t *testing.T) {
+    s := influxtest.NewServer("home", "health", "secret")
+    defer s.Close()
+
+    lines := LineProtocol(DefaultMeasurement, map[string]string{"profile": "alice"}, testInnerscan(5))
+    w := NewWriter(s.URL, "home", "health", "secret")
+    w.BatchSize = 2
+    err := w.Write(context.Background(), lines)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if s.Requests() != 3 {
+        t.Errorf("%d requests for 5 lines in batches of 2, want 3", s.Requests())
+    }
+    if got := strings.Join(s.Lines(), "\n") + "\n"; got != lines {
+        t.Errorf("written lines =\n%s\nwant\n%s", got, lines)
+    }
+
+    // nothing is sent for no lines
+    err = w.Write(context.Background(), "")
+    if err != nil || s.Requests() != 3 {
+        t.Errorf("Write of no lines = %v with %d requests", err, s.Requests())
+    }
+}
+
+func TestWriterBatchSize(t *testing.T) {
+    tests := []struct {
+        lines int
+        batchSize int
+        requests int
+    }{
+        {5, 0, 1},
+        {5, 5, 1},
+        {5, 4, 2},
+        {5, 1, 5},
+        {DefaultBatchSize + 1, DefaultBatchSize, 2},
+    }
+    for _, tt := range tests {
+        s := influxtest.NewServer("home", "health", "secret")
+        w := NewWriter(s.URL, "home", "health", "secret")
+        w.BatchSize = tt.batchSize
+        err := w.Write(context.Background(), LineProtocol(DefaultMeasurement, nil, testInnerscan(tt.lines)))
+        if err != nil || s.Requests() != tt.requests || len(s.Lines()) != tt.lines {
+            t.Errorf("%d lines in batches of %d: %v, %d requests with %d lines, want %d requests", tt.lines, tt.batchSize, err, s.Requests(), len(s.Lines()), tt.requests)
+        }
+        s.Close()
+    }
+}
+
+func TestWriterError(t *testing.T) {
+    s := influxtest.NewServer("home", "health", "secret")
+    defer s.Close()
+    lines := LineProtocol(DefaultMeasurement, nil, testInnerscan(1))
+
+    tests := []struct {
+        name string
+        org string
+        bucket string
+        token string
+        want string
+    }{
+        {"wrong token", "home", "health", "wrong", "401 Unauthorized: {\"code\":\"unauthorized\""},
+        {"no token", "home", "health", "", "401 Unauthorized"},
+        {"unknown bucket", "home", "weight", "secret", "404 Not Found: {\"code\":\"not found\",\"message\":\"bucket not found\"}"},
+    }
+    for _, tt := range tests {
+        err := NewWriter(s.URL, tt.org, tt.bucket, tt.token).Write(context.Background(), lines)
+        if err == nil || !strings.HasPrefix(err.Error(), "[InfluxDB]write failed: ") || !strings.Contains(err.Error(), tt.want) {
+            t.Errorf("%s: error = %v, want %q in it", tt.name, err, tt.want)
+        }
+    }
+    if len(s.Lines()) != 0 {
+        t.Errorf("rejected lines are written: %v", s.Lines())
+    }
+}
+
+func TestWriteURL(t *testing.T) {
+    for _, base := range []string{"http://localhost:8086", "http://localhost:8086/"} {
+        w := NewWriter(base, "my home", "health", "")
+        got, err := w.WriteURL()
+        want := "http://localhost:8086/api/v2/write?bucket=health&org=my+home&precision=ns"
+        if err != nil || got != want {
+            t.Errorf("WriteURL of %s = %s, %v, want %s", base, got, err, want)
+        }
+    }
+    _, err := NewWriter("http://[::1", "home", "health", "").WriteURL()
+    if err == nil {
+        t.Errorf("WriteURL of an invalid URL succeeded")
+    }
+}
+
+func TestLineProtocolOutliers(t *testing.T) {
+    innerscan := testInnerscan(3)
+    innerscan.Data[1].Weight = 33
+    innerscan.Data[1].Outlier = &healthplanet.OutlierMark{Outlier: true, Reason: "below 50 kg"}
+    innerscan.Data[2].Outlier = &healthplanet.OutlierMark{}
+
+    lines := LineProtocol("innerscan", nil, innerscan)
+    if n := strings.Count(lines, "\n"); n != 2 || strings.Contains(lines, "weight=33 ") {
+        t.Errorf("LineProtocol() =\n%s\nwant 2 lines without the outlier", lines)
+    }
+}
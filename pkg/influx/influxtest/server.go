@@ -0,0 +1,91 @@
+package influxtest
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+)
+
+/*
+Server is a local stand-in of the InfluxDB /api/v2/write endpoint, to test the export without InfluxDB.
+
+It checks the token, org and bucket as InfluxDB does, and keeps the written lines and the number of the accepted requests.
+
+Usage:
+```
+s := influxtest.NewServer("home", "health", "token")
+defer s.Close()
+w := influx.NewWriter(s.URL, "home", "health", "token")
+err := w.Write(ctx, lines)
+fmt.Println(s.Lines())
+```
+*/
+type Server struct {
+    *httptest.Server
+    Org string
+    Bucket string
+    Token string
+
+    mu sync.Mutex
+    lines []string
+    requests int
+}
+
+func NewServer(org string, bucket string, token string) *Server {
+    s := &Server{Org: org, Bucket: bucket, Token: token}
+    mux := http.NewServeMux()
+    mux.HandleFunc("/api/v2/write", s.handleWrite)
+    s.Server = httptest.NewServer(mux)
+    return s
+}
+
+func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, `{"code":"method not allowed"}`, http.StatusMethodNotAllowed)
+        return
+    }
+    if r.Header.Get("Authorization") != "Token " + s.Token {
+        http.Error(w, `{"code":"unauthorized","message":"unauthorized access"}`, http.StatusUnauthorized)
+        return
+    }
+    q := r.URL.Query()
+    if q.Get("org") != s.Org || q.Get("bucket") != s.Bucket {
+        http.Error(w, `{"code":"not found","message":"bucket not found"}`, http.StatusNotFound)
+        return
+    }
+    if p := q.Get("precision"); p != "" && p != "ns" {
+        http.Error(w, `{"code":"invalid","message":"only ns precision is supported by the stand-in"}`, http.StatusBadRequest)
+        return
+    }
+    body, err := io.ReadAll(r.Body)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    s.mu.Lock()
+    s.requests++
+    for _, line := range strings.Split(string(body), "\n") {
+        if line != "" {
+            s.lines = append(s.lines, line)
+        }
+    }
+    s.mu.Unlock()
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// Lines returns the lines written so far.
+func (s *Server) Lines() []string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return append([]string{}, s.lines...)
+}
+
+// Requests returns the number of the accepted write requests so far.
+func (s *Server) Requests() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.requests
+}
@@ -0,0 +1,285 @@
+package mqtt
+
+import (
+    "bufio"
+    "crypto/tls"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/url"
+    "time"
+)
+
+/*
+A minimal MQTT 3.1.1 client to publish messages.
+
+It supports what publishing needs: username/password, TLS, QoS 0 and 1 and retained messages.
+Subscriptions and QoS 2 are not supported. A connection is made per batch of messages,
+so there is no keep alive ping.
+
+Usage:
+```
+c, err := mqtt.Dial(mqtt.Options{Broker: "tcp://localhost:1883", ClientID: "tanita2csv"})
+if err != nil {
+    return err
+}
+defer c.Close()
+err = c.Publish("tanita2csv/alice/state", []byte(`{"weight":66.4}`), 1, true)
+```
+*/
+
+// Options of the connection.
+type Options struct {
+    Broker string     // tcp://host:1883, mqtt://host, ssl://host:8883, mqtts://host or tls://host
+    ClientID string
+    Username string
+    Password string
+    TLSConfig *tls.Config // for ssl, mqtts and tls brokers, nil is the default config
+    Timeout time.Duration // of the connection and each acknowledgement, 0 is DefaultTimeout
+}
+
+const DefaultTimeout = 10 * time.Second
+
+// packet types
+const (
+    packetConnect = 1
+    packetConnack = 2
+    packetPublish = 3
+    packetPuback = 4
+    packetDisconnect = 14
+)
+
+var connackErrors = map[byte]string{
+    1: "unacceptable protocol version",
+    2: "identifier rejected",
+    3: "server unavailable",
+    4: "bad user name or password",
+    5: "not authorized",
+}
+
+type Client struct {
+    conn net.Conn
+    reader *bufio.Reader
+    timeout time.Duration
+    nextID uint16
+}
+
+// BrokerAddress returns the address of the broker URL and whether to use TLS.
+func BrokerAddress(broker string) (string, bool, error) {
+    u, err := url.Parse(broker)
+    if err != nil {
+        return "", false, err
+    }
+    port := u.Port()
+    var useTLS bool
+    switch u.Scheme {
+    case "tcp", "mqtt":
+        if port == "" {
+            port = "1883"
+        }
+    case "ssl", "mqtts", "tls":
+        useTLS = true
+        if port == "" {
+            port = "8883"
+        }
+    default:
+        return "", false, fmt.Errorf("unknown broker scheme %q (use tcp, mqtt, ssl, mqtts or tls)", u.Scheme)
+    }
+    if u.Hostname() == "" {
+        return "", false, fmt.Errorf("broker has no host: %q", broker)
+    }
+    return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+// Dial connects to the broker with a clean session.
+func Dial(opts Options) (*Client, error) {
+    addr, useTLS, err := BrokerAddress(opts.Broker)
+    if err != nil {
+        return nil, err
+    }
+    timeout := opts.Timeout
+    if timeout == 0 {
+        timeout = DefaultTimeout
+    }
+
+    dialer := &net.Dialer{Timeout: timeout}
+    var conn net.Conn
+    if useTLS {
+        config := opts.TLSConfig
+        if config == nil {
+            config = &tls.Config{}
+        }
+        if config.ServerName == "" && !config.InsecureSkipVerify {
+            config = config.Clone()
+            config.ServerName, _, _ = net.SplitHostPort(addr)
+        }
+        conn, err = tls.DialWithDialer(dialer, "tcp", addr, config)
+    } else {
+        conn, err = dialer.Dial("tcp", addr)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    c := &Client{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+    if err := c.connect(opts); err != nil {
+        conn.Close()
+        return nil, err
+    }
+    return c, nil
+}
+
+func (c *Client) connect(opts Options) error {
+    var body []byte
+    body = appendString(body, "MQTT")
+    body = append(body, 4) // protocol level 3.1.1
+    flags := byte(0x02) // clean session
+    if opts.Username != "" {
+        flags |= 0x80
+    }
+    if opts.Password != "" {
+        flags |= 0x40
+    }
+    body = append(body, flags)
+    body = binary.BigEndian.AppendUint16(body, 0) // no keep alive
+    body = appendString(body, opts.ClientID)
+    if opts.Username != "" {
+        body = appendString(body, opts.Username)
+    }
+    if opts.Password != "" {
+        body = appendString(body, opts.Password)
+    }
+    if err := c.write(packetConnect << 4, body); err != nil {
+        return err
+    }
+
+    packetType, payload, err := c.read()
+    if err != nil {
+        return fmt.Errorf("failed to read CONNACK: %w", err)
+    }
+    if packetType != packetConnack || len(payload) != 2 {
+        return fmt.Errorf("unexpected packet %d instead of CONNACK", packetType)
+    }
+    if code := payload[1]; code != 0 {
+        if msg, ok := connackErrors[code]; ok {
+            return fmt.Errorf("[MQTT]connection refused: %s", msg)
+        }
+        return fmt.Errorf("[MQTT]connection refused: code %d", code)
+    }
+    return nil
+}
+
+// Publish publishes the message with QoS 0 or 1, and waits for the acknowledgement of QoS 1.
+func (c *Client) Publish(topic string, payload []byte, qos byte, retain bool) error {
+    if qos > 1 {
+        return errors.New("QoS 2 is not supported")
+    }
+    header := byte(packetPublish << 4) | qos << 1
+    if retain {
+        header |= 0x01
+    }
+    body := appendString(nil, topic)
+    var id uint16
+    if qos == 1 {
+        c.nextID++
+        if c.nextID == 0 {
+            c.nextID = 1
+        }
+        id = c.nextID
+        body = binary.BigEndian.AppendUint16(body, id)
+    }
+    body = append(body, payload...)
+    if err := c.write(header, body); err != nil {
+        return err
+    }
+    if qos == 0 {
+        return nil
+    }
+
+    packetType, ack, err := c.read()
+    if err != nil {
+        return fmt.Errorf("failed to read PUBACK: %w", err)
+    }
+    if packetType != packetPuback || len(ack) != 2 || binary.BigEndian.Uint16(ack) != id {
+        return fmt.Errorf("unexpected packet %d instead of PUBACK for %d", packetType, id)
+    }
+    return nil
+}
+
+// Close disconnects from the broker.
+func (c *Client) Close() error {
+    err := c.write(packetDisconnect << 4, nil)
+    if closeErr := c.conn.Close(); err == nil {
+        err = closeErr
+    }
+    return err
+}
+
+func appendString(b []byte, s string) []byte {
+    b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+    return append(b, s...)
+}
+
+// appendLength appends the remaining length in the variable length encoding.
+func appendLength(b []byte, n int) []byte {
+    for {
+        digit := byte(n % 128)
+        n /= 128
+        if n > 0 {
+            digit |= 0x80
+        }
+        b = append(b, digit)
+        if n == 0 {
+            return b
+        }
+    }
+}
+
+func (c *Client) write(header byte, body []byte) error {
+    packet := appendLength([]byte{header}, len(body))
+    packet = append(packet, body...)
+    c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+    _, err := c.conn.Write(packet)
+    return err
+}
+
+func (c *Client) read() (byte, []byte, error) {
+    c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+    return ReadPacket(c.reader)
+}
+
+// ReadPacket reads a packet and returns its type and the body after the fixed header.
+func ReadPacket(r *bufio.Reader) (byte, []byte, error) {
+    header, err := r.ReadByte()
+    if err != nil {
+        return 0, nil, err
+    }
+    length := 0
+    for multiplier := 1; ; multiplier *= 128 {
+        digit, err := r.ReadByte()
+        if err != nil {
+            return 0, nil, err
+        }
+        length += int(digit & 0x7f) * multiplier
+        if digit & 0x80 == 0 {
+            break
+        }
+        if multiplier > 128 * 128 * 128 {
+            return 0, nil, errors.New("malformed remaining length")
+        }
+    }
+    body := make([]byte, length)
+    if _, err := io.ReadFull(r, body); err != nil {
+        return 0, nil, err
+    }
+    return header >> 4, body, nil
+}
+
+// WritePacket writes a packet with the fixed header byte and the body.
+func WritePacket(w io.Writer, header byte, body []byte) error {
+    packet := appendLength([]byte{header}, len(body))
+    _, err := w.Write(append(packet, body...))
+    return err
+}
@@ -0,0 +1,141 @@
+package mqtt_test
+
+import (
+    "strings"
+    "testing"
+    "github.com/kamaboko123/tanita2csv/pkg/mqtt"
+    "github.com/kamaboko123/tanita2csv/pkg/mqtt/mqtttest"
+)
+
+func TestBrokerAddress(t *testing.T) {
+    tests := []struct {
+        broker string
+        addr string
+        tls bool
+        err bool
+    }{
+        {"tcp://localhost", "localhost:1883", false, false},
+        {"mqtt://broker:1884", "broker:1884", false, false},
+        {"ssl://broker", "broker:8883", true, false},
+        {"mqtts://broker:9883", "broker:9883", true, false},
+        {"tls://[::1]", "[::1]:8883", true, false},
+        {"http://broker", "", false, true},
+        {"tcp://", "", false, true},
+    }
+    for _, tt := range tests {
+        addr, useTLS, err := mqtt.BrokerAddress(tt.broker)
+        if (err != nil) != tt.err {
+            t.Errorf("BrokerAddress(%q) error = %v, want error %v", tt.broker, err, tt.err)
+            continue
+        }
+        if addr != tt.addr || useTLS != tt.tls {
+            t.Errorf("BrokerAddress(%q) = %q, %v, want %q, %v", tt.broker, addr, useTLS, tt.addr, tt.tls)
+        }
+    }
+}
+
+func newBroker(t *testing.T) *mqtttest.Broker {
+    t.Helper()
+    b, err := mqtttest.NewBroker("user", "pass")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { b.Close() })
+    return b
+}
+
+func TestPublish(t *testing.T) {
+    b := newBroker(t)
+    c, err := mqtt.Dial(mqtt.Options{Broker: b.URL(), ClientID: "test", Username: "user", Password: "pass"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+
+    messages := []mqtttest.Message{
+        {Topic: "a/state", Payload: "0", QoS: 0, Retain: false},
+        {Topic: "a/state", Payload: "1", QoS: 1, Retain: true},
+        // QoS 1 packet ids increase, and each PUBACK must match its PUBLISH
+        {Topic: "b/state", Payload: `{"weight":66.4}`, QoS: 1, Retain: false},
+        {Topic: "a/state", Payload: "2", QoS: 1, Retain: true},
+    }
+    for _, m := range messages {
+        if err := c.Publish(m.Topic, []byte(m.Payload), m.QoS, m.Retain); err != nil {
+            t.Fatalf("Publish(%q, %q) error = %v", m.Topic, m.Payload, err)
+        }
+    }
+
+    // the last message is acknowledged, so the broker has handled every message before it
+    got := b.Messages()
+    if len(got) != len(messages) {
+        t.Fatalf("broker got %d messages, want %d", len(got), len(messages))
+    }
+    for i, m := range messages {
+        if *got[i] != m {
+            t.Errorf("message %d = %+v, want %+v", i, *got[i], m)
+        }
+    }
+
+    retained := b.Retained()
+    if len(retained) != 1 || retained["a/state"] == nil || retained["a/state"].Payload != "2" {
+        t.Errorf("retained = %v, want only a/state = 2", retained)
+    }
+}
+
+func TestPublishClearsRetained(t *testing.T) {
+    b := newBroker(t)
+    c, err := mqtt.Dial(mqtt.Options{Broker: b.URL(), Username: "user", Password: "pass"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+
+    if err := c.Publish("a/state", []byte("1"), 1, true); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.Publish("a/state", nil, 1, true); err != nil {
+        t.Fatal(err)
+    }
+    if retained := b.Retained(); len(retained) != 0 {
+        t.Errorf("retained = %v, want none after the empty retained message", retained)
+    }
+}
+
+func TestPublishQoS2(t *testing.T) {
+    b := newBroker(t)
+    c, err := mqtt.Dial(mqtt.Options{Broker: b.URL(), Username: "user", Password: "pass"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+
+    if err := c.Publish("a/state", []byte("1"), 2, false); err == nil {
+        t.Error("Publish with QoS 2 succeeded, want error")
+    }
+}
+
+func TestDialRefused(t *testing.T) {
+    b := newBroker(t)
+    tests := []struct {
+        name string
+        username string
+        password string
+    }{
+        {"wrong password", "user", "wrong"},
+        {"no credentials", "", ""},
+    }
+    for _, tt := range tests {
+        c, err := mqtt.Dial(mqtt.Options{Broker: b.URL(), Username: tt.username, Password: tt.password})
+        if err == nil {
+            c.Close()
+            t.Errorf("%s: Dial succeeded, want error", tt.name)
+            continue
+        }
+        if !strings.Contains(err.Error(), "connection refused") {
+            t.Errorf("%s: Dial error = %v, want connection refused", tt.name, err)
+        }
+    }
+    if n := len(b.Messages()); n != 0 {
+        t.Errorf("broker got %d messages, want none", n)
+    }
+}
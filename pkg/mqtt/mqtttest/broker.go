@@ -0,0 +1,235 @@
+package mqtttest
+
+import (
+    "bufio"
+    "crypto/tls"
+    "encoding/binary"
+    "net"
+    "sync"
+    "github.com/kamaboko123/tanita2csv/pkg/mqtt"
+)
+
+/*
+Broker is an embedded MQTT 3.1.1 broker to test the publishing without a real broker.
+
+It accepts CONNECT (checking the username and password if they are set), acknowledges QoS 1 PUBLISH
+and keeps the published messages. The retained messages are kept by topic as a broker does.
+
+Usage:
+```
+b, err := mqtttest.NewBroker("user", "pass")
+defer b.Close()
+c, err := mqtt.Dial(mqtt.Options{Broker: b.URL(), Username: "user", Password: "pass"})
+...
+fmt.Println(b.Messages(), b.Retained())
+```
+*/
+
+type Message struct {
+    Topic string
+    Payload string
+    QoS byte
+    Retain bool
+}
+
+type Broker struct {
+    Username string
+    Password string
+
+    listener net.Listener
+    tls bool
+    wg sync.WaitGroup
+
+    mu sync.Mutex
+    messages []*Message
+    retained map[string]*Message
+}
+
+// NewBroker starts a broker on a random local port.
+func NewBroker(username string, password string) (*Broker, error) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        return nil, err
+    }
+    return start(listener, username, password, false), nil
+}
+
+// NewTLSBroker starts a broker with TLS on a random local port.
+// Clients must trust the certificate, e.g. with InsecureSkipVerify.
+func NewTLSBroker(username string, password string, cert tls.Certificate) (*Broker, error) {
+    listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+    if err != nil {
+        return nil, err
+    }
+    return start(listener, username, password, true), nil
+}
+
+func start(listener net.Listener, username string, password string, useTLS bool) *Broker {
+    b := &Broker{
+        Username: username,
+        Password: password,
+        listener: listener,
+        tls: useTLS,
+        retained: make(map[string]*Message),
+    }
+    b.wg.Add(1)
+    go b.serve()
+    return b
+}
+
+// URL returns the broker URL for mqtt.Options.
+func (b *Broker) URL() string {
+    if b.tls {
+        return "ssl://" + b.listener.Addr().String()
+    }
+    return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *Broker) Close() error {
+    err := b.listener.Close()
+    b.wg.Wait()
+    return err
+}
+
+// Messages returns the messages published so far.
+func (b *Broker) Messages() []*Message {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return append([]*Message{}, b.messages...)
+}
+
+// Retained returns the retained message of each topic.
+func (b *Broker) Retained() map[string]*Message {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    ret := make(map[string]*Message, len(b.retained))
+    for topic, m := range b.retained {
+        ret[topic] = m
+    }
+    return ret
+}
+
+func (b *Broker) serve() {
+    defer b.wg.Done()
+    for {
+        conn, err := b.listener.Accept()
+        if err != nil {
+            return
+        }
+        b.wg.Add(1)
+        go func() {
+            defer b.wg.Done()
+            defer conn.Close()
+            b.handle(conn)
+        }()
+    }
+}
+
+func (b *Broker) handle(conn net.Conn) {
+    r := bufio.NewReader(conn)
+    packetType, body, err := mqtt.ReadPacket(r)
+    if err != nil || packetType != 1 {
+        return
+    }
+    code := b.checkConnect(body)
+    if mqtt.WritePacket(conn, 0x20, []byte{0, code}) != nil || code != 0 {
+        return
+    }
+
+    for {
+        header, body, err := readPacket(r)
+        if err != nil {
+            return
+        }
+        switch header >> 4 {
+        case 3: // PUBLISH
+            b.publish(conn, header, body)
+        case 12: // PINGREQ
+            mqtt.WritePacket(conn, 0xd0, nil)
+        case 14: // DISCONNECT
+            return
+        }
+    }
+}
+
+// readPacket is mqtt.ReadPacket keeping the flags of the fixed header.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+    header, err := r.Peek(1)
+    if err != nil {
+        return 0, nil, err
+    }
+    flags := header[0] & 0x0f
+    packetType, body, err := mqtt.ReadPacket(r)
+    return packetType << 4 | flags, body, err
+}
+
+// checkConnect returns the return code of CONNACK.
+func (b *Broker) checkConnect(body []byte) byte {
+    protocol, rest, ok := readString(body)
+    if !ok || protocol != "MQTT" || len(rest) < 4 {
+        return 1
+    }
+    if rest[0] != 4 {
+        return 1
+    }
+    flags := rest[1]
+    rest = rest[4:]
+    if _, rest, ok = readString(rest); !ok {
+        return 2
+    }
+    var username, password string
+    if flags & 0x80 != 0 {
+        if username, rest, ok = readString(rest); !ok {
+            return 4
+        }
+    }
+    if flags & 0x40 != 0 {
+        if password, _, ok = readString(rest); !ok {
+            return 4
+        }
+    }
+    if b.Username != "" && (username != b.Username || password != b.Password) {
+        return 4
+    }
+    return 0
+}
+
+func (b *Broker) publish(conn net.Conn, header byte, body []byte) {
+    topic, rest, ok := readString(body)
+    if !ok {
+        return
+    }
+    m := &Message{Topic: topic, QoS: (header >> 1) & 0x03, Retain: header & 0x01 != 0}
+    if m.QoS > 0 {
+        if len(rest) < 2 {
+            return
+        }
+        id := rest[:2]
+        rest = rest[2:]
+        defer mqtt.WritePacket(conn, 0x40, id)
+    }
+    m.Payload = string(rest)
+
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.messages = append(b.messages, m)
+    if m.Retain {
+        // an empty retained message clears the retained one
+        if m.Payload == "" {
+            delete(b.retained, topic)
+        } else {
+            b.retained[topic] = m
+        }
+    }
+}
+
+func readString(b []byte) (string, []byte, bool) {
+    if len(b) < 2 {
+        return "", nil, false
+    }
+    n := int(binary.BigEndian.Uint16(b))
+    if len(b) < 2 + n {
+        return "", nil, false
+    }
+    return string(b[2:2+n]), b[2+n:], true
+}
@@ -0,0 +1,229 @@
+package report
+
+import (
+    "fmt"
+    "html"
+    "math"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/analytics"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// Series is a chart of the measured values with their moving average.
+type Series struct {
+    Name string          // for file names, e.g. body_fat
+    Title string
+    Unit string
+    Points []analytics.Point
+    Average []float64    // moving average at each point, nil for no line
+    AverageLabel string  // legend of the average, e.g. "7-day average"
+}
+
+const (
+    ChartWidth = 800
+    ChartHeight = 280
+
+    marginTop = 36
+    marginRight = 20
+    marginBottom = 30
+    marginLeft = 52
+
+    colorValue = "#2f6fb3"
+    colorAverage = "#e07b24"
+    colorGrid = "#e4e4e4"
+    colorText = "#555"
+    colorMax = "#c0392b"
+    colorMin = "#27ae60"
+    fontFamily = "Helvetica, Arial, sans-serif"
+)
+
+// WeightSeries returns the weight with the simple moving average of smaDays days.
+func WeightSeries(innerscan *healthplanet.Innerscan, smaDays int) *Series {
+    points := analytics.WeightPoints(innerscan.WithoutOutliers().Data)
+    return &Series{
+        Name: "weight",
+        Title: "Weight",
+        Unit: "kg",
+        Points: points,
+        Average: analytics.SMA(points, smaDays),
+        AverageLabel: fmt.Sprintf("%d-day average", smaDays),
+    }
+}
+
+// BodyFatSeries returns the body fat with the simple moving average of smaDays days.
+func BodyFatSeries(innerscan *healthplanet.Innerscan, smaDays int) *Series {
+    points := analytics.BodyFatPoints(innerscan.WithoutOutliers().Data)
+    return &Series{
+        Name: "body_fat",
+        Title: "Body fat",
+        Unit: "%",
+        Points: points,
+        Average: analytics.SMA(points, smaDays),
+        AverageLabel: fmt.Sprintf("%d-day average", smaDays),
+    }
+}
+
+// MinMax returns the indexes of the min and the max points, -1 for no points.
+// The first one wins a tie.
+func (s *Series) MinMax() (int, int) {
+    if len(s.Points) == 0 {
+        return -1, -1
+    }
+    min, max := 0, 0
+    for i, p := range s.Points {
+        if p.Value < s.Points[min].Value {
+            min = i
+        }
+        if p.Value > s.Points[max].Value {
+            max = i
+        }
+    }
+    return min, max
+}
+
+// niceTicks returns round values between min and max, about count of them.
+func niceTicks(min float64, max float64, count int) []float64 {
+    raw := (max - min) / float64(count)
+    magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+    step := 10 * magnitude
+    for _, m := range []float64{1, 2, 5} {
+        if m * magnitude >= raw {
+            step = m * magnitude
+            break
+        }
+    }
+    var ticks []float64
+    for v := math.Ceil(min / step) * step; v <= max + step / 1e6; v += step {
+        ticks = append(ticks, math.Round(v / step) * step)
+    }
+    return ticks
+}
+
+// dateTicks returns at most count days (at midnight) between min and max, in steps of days, weeks or months.
+func dateTicks(min time.Time, max time.Time, count int) []time.Time {
+    span := max.Sub(min).Hours() / 24
+    step := int(math.Ceil(span / float64(count)))
+    for _, s := range []int{1, 2, 7, 14, 28, 56, 91, 182, 365, 730} {
+        if span / float64(s) <= float64(count) {
+            step = s
+            break
+        }
+    }
+    first := time.Date(min.Year(), min.Month(), min.Day(), 0, 0, 0, 0, min.Location())
+    if first.Before(min) {
+        first = first.AddDate(0, 0, 1)
+    }
+    var ticks []time.Time
+    for t := first; !t.After(max); t = t.AddDate(0, 0, step) {
+        ticks = append(ticks, t)
+    }
+    return ticks
+}
+
+// formatValue formats the value with the unit, e.g. "66.40 kg".
+func formatValue(v float64, unit string) string {
+    if unit == "" {
+        return fmt.Sprintf("%.2f", v)
+    }
+    return fmt.Sprintf("%.2f %s", v, unit)
+}
+
+// SVG returns the chart as a standalone SVG document, which can also be embedded in HTML.
+// The styles are attributes, so that the chart looks the same anywhere.
+func (s *Series) SVG() string {
+    var b strings.Builder
+    fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="%s" font-size="11">`+"\n",
+        ChartWidth, ChartHeight, ChartWidth, ChartHeight, fontFamily)
+    fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", ChartWidth, ChartHeight)
+    fmt.Fprintf(&b, `<text x="%d" y="20" font-size="14" font-weight="bold" fill="#222">%s</text>`+"\n", marginLeft, html.EscapeString(s.Title))
+
+    if len(s.Points) == 0 {
+        fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" fill="%s">No data in the period</text>`+"\n", ChartWidth/2, ChartHeight/2, colorText)
+        b.WriteString("</svg>\n")
+        return b.String()
+    }
+
+    xMin, xMax := s.Points[0].Time, s.Points[len(s.Points)-1].Time
+    if !xMax.After(xMin) {
+        xMin, xMax = xMin.Add(-12 * time.Hour), xMax.Add(12 * time.Hour)
+    }
+    yMin, yMax := math.Inf(1), math.Inf(-1)
+    for i, p := range s.Points {
+        yMin, yMax = math.Min(yMin, p.Value), math.Max(yMax, p.Value)
+        if s.Average != nil {
+            yMin, yMax = math.Min(yMin, s.Average[i]), math.Max(yMax, s.Average[i])
+        }
+    }
+    pad := math.Max((yMax - yMin) * 0.12, 0.5)
+    yMin, yMax = yMin - pad, yMax + pad
+
+    plotWidth := float64(ChartWidth - marginLeft - marginRight)
+    plotHeight := float64(ChartHeight - marginTop - marginBottom)
+    x := func(t time.Time) float64 {
+        return float64(marginLeft) + t.Sub(xMin).Seconds() / xMax.Sub(xMin).Seconds() * plotWidth
+    }
+    y := func(v float64) float64 {
+        return float64(ChartHeight - marginBottom) - (v - yMin) / (yMax - yMin) * plotHeight
+    }
+
+    // grid and axes
+    for _, v := range niceTicks(yMin, yMax, 5) {
+        fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" stroke="%s"/>`+"\n", marginLeft, ChartWidth - marginRight, y(v), y(v), colorGrid)
+        fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" fill="%s">%g</text>`+"\n", marginLeft - 6, y(v) + 4, colorText, v)
+    }
+    for _, t := range dateTicks(xMin, xMax, 7) {
+        fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%d" stroke="%s"/>`+"\n", x(t), x(t), marginTop, ChartHeight - marginBottom, colorGrid)
+        fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" fill="%s">%s</text>`+"\n", x(t), ChartHeight - 10, colorText, t.Format("2006-01-02"))
+    }
+
+    // values and the average
+    for _, p := range s.Points {
+        fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="2.5" fill="%s"><title>%s: %s</title></circle>`+"\n",
+            x(p.Time), y(p.Value), colorValue, p.Time.Format("2006-01-02"), html.EscapeString(formatValue(p.Value, s.Unit)))
+    }
+    if s.Average != nil {
+        b.WriteString(`<path fill="none" stroke="` + colorAverage + `" stroke-width="2" d="`)
+        for i, p := range s.Points {
+            cmd := "L"
+            if i == 0 {
+                cmd = "M"
+            }
+            fmt.Fprintf(&b, "%s%.1f,%.1f ", cmd, x(p.Time), y(s.Average[i]))
+        }
+        b.WriteString(`"/>` + "\n")
+    }
+
+    // min and max annotations
+    min, max := s.MinMax()
+    s.annotate(&b, s.Points[max], "max", colorMax, x, y, -10)
+    if min != max {
+        s.annotate(&b, s.Points[min], "min", colorMin, x, y, 18)
+    }
+
+    // legend
+    lx := ChartWidth - marginRight - 230
+    fmt.Fprintf(&b, `<circle cx="%d" cy="16" r="3" fill="%s"/><text x="%d" y="20" fill="%s">measured</text>`+"\n", lx, colorValue, lx + 8, colorText)
+    if s.Average != nil {
+        fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="16" y2="16" stroke="%s" stroke-width="2"/><text x="%d" y="20" fill="%s">%s</text>`+"\n",
+            lx + 80, lx + 100, colorAverage, lx + 106, colorText, html.EscapeString(s.AverageLabel))
+    }
+
+    b.WriteString("</svg>\n")
+    return b.String()
+}
+
+// annotate marks the point with a ring and a label dy above (negative) or below (positive) it.
+func (s *Series) annotate(b *strings.Builder, p analytics.Point, label string, color string, x func(time.Time) float64, y func(float64) float64, dy float64) {
+    px, py := x(p.Time), y(p.Value)
+    anchor := "middle"
+    switch {
+    case px < float64(marginLeft) + 80:
+        anchor = "start"
+    case px > float64(ChartWidth - marginRight) - 80:
+        anchor = "end"
+    }
+    fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="5" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n", px, py, color)
+    fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="%s" fill="%s" font-weight="bold">%s %s (%s)</text>`+"\n",
+        px, py + dy, anchor, color, label, html.EscapeString(formatValue(p.Value, s.Unit)), p.Time.Format("01-02"))
+}
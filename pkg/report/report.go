@@ -0,0 +1,164 @@
+package report
+
+import (
+    "fmt"
+    "html/template"
+    "strings"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/analytics"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+/*
+Static reports of the measurements, to be emailed or archived without a server.
+
+The charts are SVG drawn here from the Innerscan data (no JavaScript and no external resources):
+the weight and the body fat with the simple moving average, and the min and max of the period annotated.
+HTML embeds the charts, an overview of the period and the summary table per week, month or year in one file.
+
+Usage:
+```
+page, err := report.HTML(innerscan.UniqByDay(), report.Options{Title: "alice", From: from, To: to, Group: "month", SMADays: 7})
+svg := report.WeightSeries(innerscan, 7).SVG()
+```
+*/
+
+type Options struct {
+    Title string     // shown in the heading, e.g. the profile
+    From time.Time
+    To time.Time
+    Group string     // of the summary table: week, month or year
+    SMADays int      // window of the moving average
+    Generated time.Time // zero is now
+}
+
+// Charts returns the series of the charts in the report.
+func Charts(innerscan *healthplanet.Innerscan, smaDays int) []*Series {
+    return []*Series{
+        WeightSeries(innerscan, smaDays),
+        BodyFatSeries(innerscan, smaDays),
+    }
+}
+
+type overviewRow struct {
+    Name string
+    Stats analytics.Stats
+    Latest string
+    Unit string
+}
+
+type page struct {
+    Options
+    Days int
+    Overview []overviewRow
+    Charts []template.HTML
+    Summaries []*analytics.Summary
+}
+
+var funcs = template.FuncMap{
+    "date": func(t time.Time) string { return t.Format("2006-01-02") },
+    "value": func(v float64) string { return fmt.Sprintf("%.2f", v) },
+    "change": func(v float64) string { return fmt.Sprintf("%+.2f", v) },
+    "title": func(s string) string {
+        if s == "" {
+            return s
+        }
+        return strings.ToUpper(s[:1]) + s[1:]
+    },
+}
+
+// latestValue formats the latest value, "-" for a missing (0) value.
+func latestValue(v float64) string {
+    if v == 0 {
+        return "-"
+    }
+    return fmt.Sprintf("%.2f", v)
+}
+
+var pageTemplate = template.Must(template.New("report").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Body composition report{{if .Title}}: {{.Title}}{{end}}</title>
+<style>
+body { margin: 2em auto; max-width: 840px; padding: 0 1em; font-family: Helvetica, Arial, sans-serif; color: #222; }
+h1 { font-size: 1.5em; margin-bottom: 0.2em; }
+h2 { font-size: 1.15em; margin-top: 1.6em; }
+.period { color: #555; margin-top: 0; }
+table { border-collapse: collapse; width: 100%; font-size: 0.9em; }
+th, td { padding: 0.3em 0.6em; border-bottom: 1px solid #ddd; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+thead th { background: #f3f4f6; }
+.chart { margin: 1em 0; }
+.chart svg { max-width: 100%; height: auto; }
+.note { color: #777; font-size: 0.85em; }
+footer { margin-top: 2em; color: #999; font-size: 0.8em; }
+</style>
+</head>
+<body>
+<h1>Body composition report{{if .Title}}: {{.Title}}{{end}}</h1>
+<p class="period">{{date .From}} to {{date .To}}, {{.Days}} days with measurements</p>
+{{if .Overview}}
+<h2>Overview</h2>
+<table>
+<thead><tr><th></th><th>Latest</th><th>Min</th><th>Max</th><th>Mean</th><th>Change</th></tr></thead>
+<tbody>
+{{range .Overview}}{{if .Stats.Count}}<tr><td>{{.Name}}{{if .Unit}} ({{.Unit}}){{end}}</td><td>{{.Latest}}</td><td>{{value .Stats.Min}}</td><td>{{value .Stats.Max}}</td><td>{{value .Stats.Mean}}</td><td>{{change .Stats.Change}}</td></tr>
+{{end}}{{end}}</tbody>
+</table>
+{{end}}
+<h2>Charts</h2>
+{{range .Charts}}<div class="chart">{{.}}</div>
+{{end}}
+<h2>Summary</h2>
+{{if .Summaries}}<table>
+<thead>
+<tr><th>{{title .Group}}</th><th>Days</th><th>Weight mean</th><th>min</th><th>max</th><th>change</th><th>Body fat mean</th><th>min</th><th>max</th><th>change</th></tr>
+</thead>
+<tbody>
+{{range .Summaries}}<tr><td>{{.Group}}</td><td>{{.Weight.Count}}</td><td>{{value .Weight.Mean}}</td><td>{{value .Weight.Min}}</td><td>{{value .Weight.Max}}</td><td>{{change .Weight.Change}}</td>{{if .BodyFat.Count}}<td>{{value .BodyFat.Mean}}</td><td>{{value .BodyFat.Min}}</td><td>{{value .BodyFat.Max}}</td><td>{{change .BodyFat.Change}}</td>{{else}}<td>-</td><td>-</td><td>-</td><td>-</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+{{range .Summaries}}{{if .Note}}<p class="note">{{.Group}}: {{.Note}}</p>
+{{end}}{{end}}{{else}}<p>No data in the period.</p>
+{{end}}
+<footer>Generated by tanita2csv at {{.Generated.Format "2006-01-02 15:04 MST"}}</footer>
+</body>
+</html>
+`))
+
+// HTML returns the report of the data as a self-contained HTML page.
+// The data must have one measurement per day (Innerscan.UniqByDay) sorted by date, and the outliers are left out.
+func HTML(innerscan *healthplanet.Innerscan, opts Options) (string, error) {
+    innerscan = innerscan.WithoutOutliers()
+    if opts.Generated.IsZero() {
+        opts.Generated = time.Now()
+    }
+    summaries, err := analytics.Summarize(innerscan, opts.Group)
+    if err != nil {
+        return "", err
+    }
+    p := &page{
+        Options: opts,
+        Days: len(innerscan.Data),
+        Summaries: summaries,
+    }
+    if all := analytics.SummarizeAll(innerscan, "all"); all != nil {
+        latest := innerscan.Data[len(innerscan.Data)-1]
+        p.Overview = []overviewRow{
+            {"Weight", all.Weight, latestValue(latest.Weight), "kg"},
+            {"Body fat", all.BodyFat, latestValue(latest.BodyFat), "%"},
+            {"BMI", all.BMI, latestValue(latest.BMI), ""},
+        }
+    }
+    for _, s := range Charts(innerscan, opts.SMADays) {
+        // the SVG is generated here with the values escaped
+        p.Charts = append(p.Charts, template.HTML(s.SVG()))
+    }
+
+    var b strings.Builder
+    if err := pageTemplate.Execute(&b, p); err != nil {
+        return "", err
+    }
+    return b.String(), nil
+}
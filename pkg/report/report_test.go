@@ -0,0 +1,155 @@
+package report
+
+import (
+    "strings"
+    "testing"
+    "time"
+    "github.com/kamaboko123/tanita2csv/pkg/healthplanet"
+)
+
+// testInnerscan returns a measurement per day from 2025-04-01, with the weights and the body fats of 20 + i/10.
+func testInnerscan(weights ...float64) *healthplanet.Innerscan {
+    innerscan := &healthplanet.Innerscan{}
+    for i, w := range weights {
+        innerscan.Data = append(innerscan.Data, &healthplanet.InnerscanData{
+            Date: time.Date(2025, 4, 1 + i, 7, 30, 0, 0, time.UTC),
+            Weight: w,
+            BodyFat: 20 + float64(i) / 10,
+            BMI: 22,
+        })
+    }
+    return innerscan
+}
+
+func TestChartsOutliers(t *testing.T) {
+    innerscan := testInnerscan(66.4, 33.0, 66.0)
+    innerscan.Data[1].Outlier = &healthplanet.OutlierMark{Outlier: true}
+
+    for _, s := range Charts(innerscan, 7) {
+        if len(s.Points) != 2 {
+            t.Errorf("%s: %d points, want 2 without the outlier", s.Name, len(s.Points))
+        }
+        if min, _ := s.MinMax(); s.Name == "weight" && s.Points[min].Value != 66 {
+            t.Errorf("weight min = %v, want 66", s.Points[min].Value)
+        }
+    }
+}
+
+func TestMinMax(t *testing.T) {
+    tests := []struct {
+        name string
+        weights []float64
+        min int
+        max int
+    }{
+        {"no points", nil, -1, -1},
+        {"one point", []float64{66.4}, 0, 0},
+        {"falling", []float64{66.4, 66.2, 66.0}, 2, 0},
+        {"first one wins a tie", []float64{66.0, 66.4, 66.0, 66.4}, 0, 1},
+    }
+    for _, tt := range tests {
+        s := WeightSeries(testInnerscan(tt.weights...), 7)
+        if min, max := s.MinMax(); min != tt.min || max != tt.max {
+            t.Errorf("%s: MinMax() = %d, %d, want %d, %d", tt.name, min, max, tt.min, tt.max)
+        }
+    }
+}
+
+func TestSVG(t *testing.T) {
+    s := WeightSeries(testInnerscan(66.4, 66.2, 66.0), 7)
+    svg := s.SVG()
+    for _, want := range []string{
+        `<svg xmlns="http://www.w3.org/2000/svg" width="800" height="280"`,
+        ">Weight</text>",
+        "<title>2025-04-01: 66.40 kg</title>",
+        ">max 66.40 kg (04-01)</text>",
+        ">min 66.00 kg (04-03)</text>",
+        ">7-day average</text>",
+    } {
+        if !strings.Contains(svg, want) {
+            t.Errorf("SVG() does not contain %q:\n%s", want, svg)
+        }
+    }
+    if !strings.HasSuffix(svg, "</svg>\n") || strings.Count(svg, "<path ") != 1 {
+        t.Errorf("SVG() is not a chart with an average line:\n%s", svg)
+    }
+}
+
+func TestSVGNoData(t *testing.T) {
+    s := WeightSeries(testInnerscan(), 7)
+    svg := s.SVG()
+    if !strings.Contains(svg, ">No data in the period</text>") || !strings.Contains(svg, ">Weight</text>") || !strings.HasSuffix(svg, "</svg>\n") {
+        t.Errorf("SVG() without data:\n%s", svg)
+    }
+    if strings.Contains(svg, "<circle") || strings.Contains(svg, "<path") || strings.Contains(svg, "NaN") {
+        t.Errorf("SVG() without data has points:\n%s", svg)
+    }
+}
+
+func TestHTMLEscape(t *testing.T) {
+    title := `<script>alert("x")</script> & Bob`
+    s := WeightSeries(testInnerscan(66.4, 66.2), 7)
+    s.Title = title
+    s.AverageLabel = "<b>average</b>"
+    svg := s.SVG()
+    page, err := HTML(testInnerscan(66.4, 66.2), Options{Title: title, Group: "month", SMADays: 7})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for name, content := range map[string]string{"SVG": svg, "HTML": page} {
+        if strings.Contains(content, "<script>") || strings.Contains(content, "<b>") {
+            t.Errorf("%s is not escaped:\n%s", name, content)
+        }
+        if !strings.Contains(content, "&lt;script&gt;") {
+            t.Errorf("%s has no escaped title:\n%s", name, content)
+        }
+    }
+}
+
+func TestHTML(t *testing.T) {
+    innerscan := testInnerscan(66.4, 66.2, 66.0)
+    generated := time.Date(2025, 4, 4, 8, 0, 0, 0, time.UTC)
+    page, err := HTML(innerscan, Options{
+        Title: "alice",
+        From: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+        To: time.Date(2025, 4, 30, 0, 0, 0, 0, time.UTC),
+        Group: "month",
+        SMADays: 7,
+        Generated: generated,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, want := range []string{
+        "<h1>Body composition report: alice</h1>",
+        "2025-04-01 to 2025-04-30, 3 days with measurements",
+        // the overview
+        "<tr><td>Weight (kg)</td><td>66.00</td><td>66.00</td><td>66.40</td><td>66.20</td><td>-0.40</td></tr>",
+        // the summary table
+        "<tr><th>Month</th><th>Days</th>",
+        "<tr><td>2025-04</td><td>3</td><td>66.20</td><td>66.00</td><td>66.40</td><td>-0.40</td><td>20.10</td>",
+        "Generated by tanita2csv at 2025-04-04 08:00 UTC",
+    } {
+        if !strings.Contains(page, want) {
+            t.Errorf("HTML() does not contain %q:\n%s", want, page)
+        }
+    }
+    // both charts, embedded as SVG
+    if n := strings.Count(page, `<div class="chart"><svg `); n != 2 || !strings.Contains(page, ">Weight</text>") || !strings.Contains(page, ">Body fat</text>") {
+        t.Errorf("HTML() has %d charts:\n%s", n, page)
+    }
+
+    if _, err := HTML(innerscan, Options{Group: "day"}); err == nil {
+        t.Errorf("HTML() with group day succeeded")
+    }
+}
+
+func TestHTMLNoData(t *testing.T) {
+    page, err := HTML(testInnerscan(), Options{Group: "week", SMADays: 7})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(page, "<p>No data in the period.</p>") || strings.Contains(page, "<h2>Overview</h2>") || strings.Count(page, "No data in the period</text>") != 2 {
+        t.Errorf("HTML() without data:\n%s", page)
+    }
+}
@@ -0,0 +1,229 @@
+package schedule
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+/*
+Schedules of the runs of the daemon: a fixed interval, or a cron expression.
+
+A cron expression has the 5 fields of crontab(5), evaluated in the location of the time given to Next:
+
+    minute hour day-of-month month day-of-week
+    0 6 * * *          every day at 06:00
+    0-59/15 * * * *    every 15 minutes
+    30 7 * * mon-fri   weekdays at 07:30
+    0 0 1,15 * *       the 1st and the 15th at midnight
+
+A field is *, a value, a range (a-b), a step (a-b/n, a/n, or * followed by /n), or a list of them separated by commas.
+The months and the days of the week can be names (jan, sun), and 7 is also Sunday.
+As in cron, a day matches either the day of month or the day of week if both are restricted.
+A time skipped when daylight saving time starts does not match, and a time repeated when it ends matches once.
+The descriptors @yearly (@annually), @monthly, @weekly, @daily (@midnight) and @hourly are also accepted.
+
+Usage:
+```
+s, err := schedule.ParseCron("0 6 * * *")
+next := s.Next(time.Now().In(loc))
+
+s := schedule.Every(6 * time.Hour)
+```
+*/
+
+// Schedule returns the times of the runs.
+type Schedule interface {
+    // Next returns the first time of a run after t, or zero time if there is none.
+    Next(t time.Time) time.Time
+    String() string
+}
+
+type every struct {
+    interval time.Duration
+}
+
+// Every returns the schedule running every interval from the given time.
+func Every(interval time.Duration) Schedule {
+    return every{interval}
+}
+
+func (e every) Next(t time.Time) time.Time {
+    return t.Add(e.interval)
+}
+
+func (e every) String() string {
+    return "every " + e.interval.String()
+}
+
+// Cron is a parsed cron expression.
+type Cron struct {
+    expr string
+    minute, hour, dom, month, dow uint64 // bit n is set if the value n matches
+    domStar, dowStar bool                // the field is *, which does not restrict the day
+}
+
+var descriptors = map[string]string{
+    "@yearly": "0 0 1 1 *",
+    "@annually": "0 0 1 1 *",
+    "@monthly": "0 0 1 * *",
+    "@weekly": "0 0 * * 0",
+    "@daily": "0 0 * * *",
+    "@midnight": "0 0 * * *",
+    "@hourly": "0 * * * *",
+}
+
+var monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseCron parses the cron expression.
+func ParseCron(expr string) (*Cron, error) {
+    fields := strings.Fields(strings.ToLower(expr))
+    if len(fields) == 1 && strings.HasPrefix(fields[0], "@") {
+        d, ok := descriptors[fields[0]]
+        if !ok {
+            return nil, fmt.Errorf("unknown descriptor %q", fields[0])
+        }
+        fields = strings.Fields(d)
+    }
+    if len(fields) != 5 {
+        return nil, fmt.Errorf("invalid cron expression %q: want 5 fields (minute hour day-of-month month day-of-week), got %d", expr, len(fields))
+    }
+
+    c := &Cron{expr: strings.Join(strings.Fields(expr), " ")}
+    var err error
+    if c.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+        return nil, fmt.Errorf("minute: %w", err)
+    }
+    if c.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+        return nil, fmt.Errorf("hour: %w", err)
+    }
+    if c.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+        return nil, fmt.Errorf("day of month: %w", err)
+    }
+    if c.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+        return nil, fmt.Errorf("month: %w", err)
+    }
+    if c.dow, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+        return nil, fmt.Errorf("day of week: %w", err)
+    }
+    // 7 is Sunday
+    if c.dow & (1 << 7) != 0 {
+        c.dow |= 1
+    }
+    c.domStar = strings.HasPrefix(fields[2], "*")
+    c.dowStar = strings.HasPrefix(fields[4], "*")
+    return c, nil
+}
+
+// parseField returns the bits of the values of the field between min and max.
+// names, if not nil, are the names of the values from min.
+func parseField(field string, min int, max int, names []string) (uint64, error) {
+    var bits uint64
+    for _, part := range strings.Split(field, ",") {
+        rng, stepText, hasStep := strings.Cut(part, "/")
+        step := 1
+        if hasStep {
+            n, err := strconv.Atoi(stepText)
+            if err != nil || n < 1 {
+                return 0, fmt.Errorf("invalid step %q", stepText)
+            }
+            step = n
+        }
+
+        var lo, hi int
+        switch {
+        case rng == "*":
+            lo, hi = min, max
+        case strings.Contains(rng, "-"):
+            a, b, _ := strings.Cut(rng, "-")
+            var err error
+            if lo, err = parseValue(a, min, max, names); err != nil {
+                return 0, err
+            }
+            if hi, err = parseValue(b, min, max, names); err != nil {
+                return 0, err
+            }
+            if lo > hi {
+                return 0, fmt.Errorf("invalid range %q", rng)
+            }
+        default:
+            var err error
+            if lo, err = parseValue(rng, min, max, names); err != nil {
+                return 0, err
+            }
+            hi = lo
+            if hasStep {
+                // a/n is from a to the max
+                hi = max
+            }
+        }
+        for v := lo; v <= hi; v += step {
+            bits |= 1 << v
+        }
+    }
+    return bits, nil
+}
+
+func parseValue(s string, min int, max int, names []string) (int, error) {
+    for i, name := range names {
+        if s == name {
+            return min + i, nil
+        }
+    }
+    v, err := strconv.Atoi(s)
+    if err != nil || v < min || v > max {
+        return 0, fmt.Errorf("invalid value %q, want %d-%d", s, min, max)
+    }
+    return v, nil
+}
+
+// Next returns the first matching minute after t in the location of t,
+// or zero time if nothing matches in 5 years (e.g. "0 0 30 2 *").
+// A time skipped by daylight saving time does not match, and a time repeated at the end of it
+// matches only the first time, so that a run is not repeated with the same wall-clock time.
+func (c *Cron) Next(t time.Time) time.Time {
+    loc := t.Location()
+    start := t
+    t = t.Add(time.Minute - time.Duration(t.Second()) * time.Second - time.Duration(t.Nanosecond()))
+    limit := t.AddDate(5, 0, 0)
+    for t.Before(limit) {
+        y, m, d := t.Date()
+        switch {
+        case c.month & (1 << uint(m)) == 0:
+            t = time.Date(y, m + 1, 1, 0, 0, 0, 0, loc)
+        case !c.dayMatches(t):
+            t = time.Date(y, m, d + 1, 0, 0, 0, 0, loc)
+        case c.hour & (1 << uint(t.Hour())) == 0:
+            t = t.Add(time.Duration(60 - t.Minute()) * time.Minute)
+        case c.minute & (1 << uint(t.Minute())) == 0 || !wallClockAfter(t, start):
+            t = t.Add(time.Minute)
+        default:
+            return t
+        }
+    }
+    return time.Time{}
+}
+
+// wallClockAfter returns whether the wall-clock time of a is after that of b, ignoring the offsets.
+func wallClockAfter(a time.Time, b time.Time) bool {
+    wall := func(t time.Time) time.Time {
+        y, m, d := t.Date()
+        return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+    }
+    return wall(a).After(wall(b))
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+    dom := c.dom & (1 << uint(t.Day())) != 0
+    dow := c.dow & (1 << uint(t.Weekday())) != 0
+    if c.domStar || c.dowStar {
+        return dom && dow
+    }
+    return dom || dow
+}
+
+func (c *Cron) String() string {
+    return c.expr
+}
@@ -0,0 +1,182 @@
+package schedule
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestCronNext(t *testing.T) {
+    utc := func(s string) time.Time {
+        v, err := time.Parse("2006-01-02 15:04", s)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return v
+    }
+    tests := []struct {
+        expr string
+        from string
+        want string // empty for no run
+    }{
+        {"0 6 * * *", "2025-04-01 05:59", "2025-04-01 06:00"},
+        {"0 6 * * *", "2025-04-01 06:00", "2025-04-02 06:00"},
+        {"0 6 * * *", "2025-12-31 06:00", "2026-01-01 06:00"},
+        {"*/5 * * * *", "2025-04-01 10:07", "2025-04-01 10:10"},
+        // ranges, steps and lists
+        {"0-59/15 * * * *", "2025-04-01 10:07", "2025-04-01 10:15"},
+        {"0-59/15 * * * *", "2025-04-01 10:45", "2025-04-01 11:00"},
+        {"5/20 * * * *", "2025-04-01 10:26", "2025-04-01 10:45"},
+        {"10-20/5 * * * *", "2025-04-01 10:21", "2025-04-01 11:10"},
+        {"*/20 9-17/4 * * *", "2025-04-01 09:41", "2025-04-01 13:00"},
+        {"0 8,12-13,18 * * *", "2025-04-01 12:00", "2025-04-01 13:00"},
+        {"0 0 1,15 * *", "2025-04-02 00:00", "2025-04-15 00:00"},
+        {"30 7 * * mon-fri", "2025-04-04 08:00", "2025-04-07 07:30"},
+        {"0 0 1 jan *", "2025-04-01 00:00", "2026-01-01 00:00"},
+        {"0 0 1 JAN-MAR/2 *", "2025-04-01 00:00", "2026-01-01 00:00"},
+        {"0 0 * * 7", "2025-04-02 00:00", "2025-04-06 00:00"},
+        {"0 0 * * 0", "2025-04-02 00:00", "2025-04-06 00:00"},
+        {"0 0 29 2 *", "2025-03-01 00:00", "2028-02-29 00:00"},
+        {"0 0 30 2 *", "2025-04-01 00:00", ""},
+        // descriptors
+        {"@hourly", "2025-04-01 10:00", "2025-04-01 11:00"},
+        {"@hourly", "2025-04-01 23:30", "2025-04-02 00:00"},
+        {"@daily", "2025-04-01 23:59", "2025-04-02 00:00"},
+        {"@midnight", "2025-04-01 00:00", "2025-04-02 00:00"},
+        {"@weekly", "2025-04-02 12:00", "2025-04-06 00:00"},
+        {"@monthly", "2025-04-01 00:00", "2025-05-01 00:00"},
+        {"@yearly", "2025-04-01 00:00", "2026-01-01 00:00"},
+        {"@annually", "2025-04-01 00:00", "2026-01-01 00:00"},
+        // either the day of month or the day of week if both are restricted
+        {"0 0 13 * fri", "2025-04-01 00:00", "2025-04-04 00:00"},
+        {"0 0 13 * fri", "2025-04-12 00:00", "2025-04-13 00:00"},
+        {"0 0 13 * fri", "2025-04-13 00:00", "2025-04-18 00:00"},
+        // both if either is *
+        {"0 0 13 * *", "2025-04-01 00:00", "2025-04-13 00:00"},
+        {"0 0 * * fri", "2025-04-12 00:00", "2025-04-18 00:00"},
+        {"0 0 */2 * fri", "2025-04-01 00:00", "2025-04-11 00:00"},
+        {"0 0 13 * */7", "2025-04-01 00:00", "2025-04-13 00:00"},
+    }
+    for _, tt := range tests {
+        c, err := ParseCron(tt.expr)
+        if err != nil {
+            t.Errorf("ParseCron(%q): %v", tt.expr, err)
+            continue
+        }
+        got := c.Next(utc(tt.from))
+        want := time.Time{}
+        if tt.want != "" {
+            want = utc(tt.want)
+        }
+        if !got.Equal(want) {
+            t.Errorf("%q from %s = %v, want %v", tt.expr, tt.from, got, want)
+        }
+    }
+}
+
+func TestCronNextSeconds(t *testing.T) {
+    c, err := ParseCron("* * * * *")
+    if err != nil {
+        t.Fatal(err)
+    }
+    from := time.Date(2025, 4, 1, 10, 0, 59, 999, time.UTC)
+    if got := c.Next(from); !got.Equal(time.Date(2025, 4, 1, 10, 1, 0, 0, time.UTC)) {
+        t.Errorf("Next(%v) = %v, want the next minute", from, got)
+    }
+}
+
+func TestCronNextDST(t *testing.T) {
+    loc, err := time.LoadLocation("America/New_York")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // 2025-03-09 02:00 EST is 03:00 EDT, 2025-11-02 02:00 EDT is 01:00 EST
+    tests := []struct {
+        expr string
+        from time.Time
+        want time.Time // in UTC
+    }{
+        {"0 6 * * *", time.Date(2025, 3, 8, 6, 0, 0, 0, loc), time.Date(2025, 3, 9, 10, 0, 0, 0, time.UTC)},
+        {"0 6 * * *", time.Date(2025, 11, 1, 6, 0, 0, 0, loc), time.Date(2025, 11, 2, 11, 0, 0, 0, time.UTC)},
+        // the skipped time does not match
+        {"30 2 * * *", time.Date(2025, 3, 9, 0, 0, 0, 0, loc), time.Date(2025, 3, 10, 6, 30, 0, 0, time.UTC)},
+        {"0 3 * * *", time.Date(2025, 3, 9, 0, 0, 0, 0, loc), time.Date(2025, 3, 9, 7, 0, 0, 0, time.UTC)},
+        {"@hourly", time.Date(2025, 3, 9, 1, 0, 0, 0, loc), time.Date(2025, 3, 9, 7, 0, 0, 0, time.UTC)},
+        // the repeated time matches once
+        {"30 1 * * *", time.Date(2025, 11, 2, 0, 0, 0, 0, loc), time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC)},
+        {"30 1 * * *", time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC).In(loc), time.Date(2025, 11, 3, 6, 30, 0, 0, time.UTC)},
+        {"@hourly", time.Date(2025, 11, 2, 5, 0, 0, 0, time.UTC).In(loc), time.Date(2025, 11, 2, 7, 0, 0, 0, time.UTC)},
+        {"*/30 * * * *", time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC).In(loc), time.Date(2025, 11, 2, 7, 0, 0, 0, time.UTC)},
+    }
+    for _, tt := range tests {
+        c, err := ParseCron(tt.expr)
+        if err != nil {
+            t.Fatal(err)
+        }
+        got := c.Next(tt.from)
+        if !got.Equal(tt.want) || got.Location() != loc {
+            t.Errorf("%q from %v = %v, want %v", tt.expr, tt.from, got, tt.want.In(loc))
+        }
+    }
+}
+
+func TestParseCronInvalid(t *testing.T) {
+    tests := []struct {
+        expr string
+        want string
+    }{
+        {"", "want 5 fields"},
+        {"0 6 * *", "want 5 fields"},
+        {"0 6 * * * *", "want 5 fields"},
+        {"@reboot", "unknown descriptor"},
+        {"@daily 0", "want 5 fields"},
+        {"60 * * * *", "minute: invalid value"},
+        {"-1 * * * *", "minute: invalid value"},
+        {"x * * * *", "minute: invalid value"},
+        {"* 24 * * *", "hour: invalid value"},
+        {"* * 0 * *", "day of month: invalid value"},
+        {"* * 32 * *", "day of month: invalid value"},
+        {"* * * 13 *", "month: invalid value"},
+        {"* * * sun *", "month: invalid value"},
+        {"* * * * 8", "day of week: invalid value"},
+        {"* * * * jan", "day of week: invalid value"},
+        {"5-1 * * * *", "minute: invalid range"},
+        {"1-x * * * *", "minute: invalid value"},
+        {"*/0 * * * *", "minute: invalid step"},
+        {"*/x * * * *", "minute: invalid step"},
+        {"1,,2 * * * *", "minute: invalid value"},
+    }
+    for _, tt := range tests {
+        _, err := ParseCron(tt.expr)
+        if err == nil || !strings.Contains(err.Error(), tt.want) {
+            t.Errorf("ParseCron(%q) = %v, want %q", tt.expr, err, tt.want)
+        }
+    }
+}
+
+func TestString(t *testing.T) {
+    tests := []struct {
+        schedule func() (Schedule, error)
+        want string
+    }{
+        {func() (Schedule, error) { return ParseCron(" 0  6 * * mon ") }, "0 6 * * mon"},
+        {func() (Schedule, error) { return ParseCron("@daily") }, "@daily"},
+        {func() (Schedule, error) { return Every(6 * time.Hour), nil }, "every 6h0m0s"},
+    }
+    for _, tt := range tests {
+        s, err := tt.schedule()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got := s.String(); got != tt.want {
+            t.Errorf("String() = %q, want %q", got, tt.want)
+        }
+    }
+}
+
+func TestEvery(t *testing.T) {
+    from := time.Date(2025, 4, 1, 10, 7, 30, 0, time.UTC)
+    if got := Every(6 * time.Hour).Next(from); !got.Equal(from.Add(6 * time.Hour)) {
+        t.Errorf("Next = %v, want 6 hours later", got)
+    }
+}
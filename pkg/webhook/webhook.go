@@ -0,0 +1,190 @@
+package webhook
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+/*
+Delivery of webhooks.
+
+Sender POSTs a body to a URL. With a shared secret, the body is signed by HMAC-SHA256:
+
+    X-Tanita2csv-Signature: sha256=<hex of HMAC-SHA256(secret, body)>
+
+and the receiver checks it with Verify (or the same computation in any language).
+Network errors, 429 and 5xx responses are retried with exponential backoff, other responses are not retried.
+AppendDeadLetter keeps the deliveries which failed in the end in a JSONL file, so that they are not lost.
+
+Usage:
+```
+s := webhook.NewSender("https://example.com/hook", "secret")
+attempts, err := s.Send(ctx, []byte(`{"weight":66.4}`))
+if err != nil {
+    webhook.AppendDeadLetter("dead-letter.jsonl", webhook.NewDeadLetter(s, body, attempts, err))
+}
+```
+*/
+
+const (
+    SignatureHeader = "X-Tanita2csv-Signature"
+    DefaultContentType = "application/json"
+    DefaultRetries = 3
+    DefaultBackoff = time.Second
+)
+
+type Sender struct {
+    URL string
+    Secret string              // signs the body if set
+    ContentType string
+    Headers map[string]string  // additional headers, e.g. Authorization
+    Retries int                // retries after the first attempt
+    Backoff time.Duration      // wait before the first retry, doubled for each retry
+    Client *http.Client
+}
+
+func NewSender(url string, secret string) *Sender {
+    return &Sender{
+        URL: url,
+        Secret: secret,
+        ContentType: DefaultContentType,
+        Retries: DefaultRetries,
+        Backoff: DefaultBackoff,
+        Client: &http.Client{Timeout: 30 * time.Second},
+    }
+}
+
+// Sign returns the signature header value of the body.
+func Sign(secret string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write(body)
+    return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature header value of the body in constant time.
+func Verify(secret string, body []byte, signature string) bool {
+    return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// StatusError is the error of a non-2xx response.
+type StatusError struct {
+    StatusCode int
+    Status string
+    Body string
+}
+
+func (e *StatusError) Error() string {
+    if e.Body == "" {
+        return "[Webhook]" + e.Status
+    }
+    return fmt.Sprintf("[Webhook]%s: %s", e.Status, e.Body)
+}
+
+// retryable returns whether the delivery may succeed by trying again.
+func retryable(err error) bool {
+    var statusErr *StatusError
+    if errors.As(err, &statusErr) {
+        return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+    }
+    return true
+}
+
+// Send posts the body, retrying on temporary failures. It returns the number of attempts.
+func (s *Sender) Send(ctx context.Context, body []byte) (int, error) {
+    backoff := s.Backoff
+    attempts := 0
+    for {
+        attempts++
+        err := s.post(ctx, body)
+        if err == nil || !retryable(err) || attempts > s.Retries {
+            return attempts, err
+        }
+        select {
+        case <-ctx.Done():
+            return attempts, ctx.Err()
+        case <-time.After(backoff):
+        }
+        backoff *= 2
+    }
+}
+
+func (s *Sender) post(ctx context.Context, body []byte) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    contentType := s.ContentType
+    if contentType == "" {
+        contentType = DefaultContentType
+    }
+    req.Header.Set("Content-Type", contentType)
+    for k, v := range s.Headers {
+        req.Header.Set(k, v)
+    }
+    if s.Secret != "" {
+        req.Header.Set(SignatureHeader, Sign(s.Secret, body))
+    }
+
+    resp, err := s.Client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+    if resp.StatusCode / 100 != 2 {
+        return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(respBody))}
+    }
+    return nil
+}
+
+// DeadLetter is a delivery which failed after all retries.
+type DeadLetter struct {
+    Time time.Time `json:"time"`
+    URL string `json:"url"`
+    ContentType string `json:"content_type"`
+    Body string `json:"body"`
+    Attempts int `json:"attempts"`
+    Error string `json:"error"`
+}
+
+func NewDeadLetter(s *Sender, body []byte, attempts int, err error) *DeadLetter {
+    return &DeadLetter{
+        Time: time.Now(),
+        URL: s.URL,
+        ContentType: s.ContentType,
+        Body: string(body),
+        Attempts: attempts,
+        Error: err.Error(),
+    }
+}
+
+// AppendDeadLetter appends the dead letter to the JSONL file, creating it if needed.
+// The file is private as the URL and the body may have secrets.
+func AppendDeadLetter(path string, d *DeadLetter) error {
+    line, err := json.Marshal(d)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return err
+    }
+    f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    _, err = f.Write(append(line, '\n'))
+    return err
+}
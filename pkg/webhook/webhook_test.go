@@ -0,0 +1,225 @@
+package webhook
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+    body := []byte(`{"weight":66.4}`)
+    want := "sha256=1946e2d073307845c57ac2d50fa62b57f3c0fbb2adba28d71967c141de7c9bae"
+    if got := Sign("secret", body); got != want {
+        t.Errorf("Sign = %s, want %s", got, want)
+    }
+    tests := []struct {
+        secret string
+        body string
+        signature string
+        want bool
+    }{
+        {"secret", `{"weight":66.4}`, want, true},
+        {"other", `{"weight":66.4}`, want, false},
+        {"secret", `{"weight":66.5}`, want, false},
+        {"secret", `{"weight":66.4}`, "1946e2d073307845c57ac2d50fa62b57f3c0fbb2adba28d71967c141de7c9bae", false},
+        {"secret", `{"weight":66.4}`, "", false},
+    }
+    for _, tt := range tests {
+        if got := Verify(tt.secret, []byte(tt.body), tt.signature); got != tt.want {
+            t.Errorf("Verify(%q, %s, %q) = %v, want %v", tt.secret, tt.body, tt.signature, got, tt.want)
+        }
+    }
+}
+
+// receiver is a webhook receiver which responds with the statuses in order, then 200.
+type receiver struct {
+    *httptest.Server
+    mu sync.Mutex
+    statuses []int
+    requests []*http.Request
+    bodies []string
+    times []time.Time
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+    r := &receiver{statuses: statuses}
+    r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        body, _ := io.ReadAll(req.Body)
+        r.mu.Lock()
+        defer r.mu.Unlock()
+        r.requests = append(r.requests, req)
+        r.bodies = append(r.bodies, string(body))
+        r.times = append(r.times, time.Now())
+        status := http.StatusOK
+        if len(r.statuses) > 0 {
+            status, r.statuses = r.statuses[0], r.statuses[1:]
+        }
+        w.WriteHeader(status)
+        if status != http.StatusOK {
+            io.WriteString(w, "try later\n")
+        }
+    }))
+    t.Cleanup(r.Close)
+    return r
+}
+
+func TestSendHeaders(t *testing.T) {
+    r := newReceiver(t)
+    body := []byte(`{"weight":66.4}`)
+
+    s := NewSender(r.URL, "secret")
+    s.Headers = map[string]string{"Authorization": "Bearer token"}
+    if _, err := s.Send(context.Background(), body); err != nil {
+        t.Fatal(err)
+    }
+    s = NewSender(r.URL, "")
+    s.ContentType = "text/plain"
+    if _, err := s.Send(context.Background(), body); err != nil {
+        t.Fatal(err)
+    }
+
+    signed, unsigned := r.requests[0], r.requests[1]
+    if got := signed.Header.Get(SignatureHeader); !Verify("secret", []byte(r.bodies[0]), got) {
+        t.Errorf("%s = %q does not verify the body %s", SignatureHeader, got, r.bodies[0])
+    }
+    if signed.Header.Get("Content-Type") != DefaultContentType || signed.Header.Get("Authorization") != "Bearer token" {
+        t.Errorf("headers = %v", signed.Header)
+    }
+    if got := unsigned.Header.Get(SignatureHeader); got != "" {
+        t.Errorf("%s = %q without the secret", SignatureHeader, got)
+    }
+    if unsigned.Header.Get("Content-Type") != "text/plain" || r.bodies[1] != string(body) {
+        t.Errorf("Content-Type = %q, body = %s", unsigned.Header.Get("Content-Type"), r.bodies[1])
+    }
+}
+
+func TestSendRetry(t *testing.T) {
+    tests := []struct {
+        name string
+        statuses []int
+        retries int
+        attempts int
+        status int // of the error, 0 for no error
+    }{
+        {"ok", nil, 3, 1, 0},
+        {"recovered", []int{503, 502}, 3, 3, 0},
+        {"rate limited", []int{429}, 3, 2, 0},
+        {"gave up", []int{500, 500, 500, 500, 500}, 3, 4, 500},
+        {"no retries", []int{503}, 0, 1, 503},
+        // a client error does not succeed by trying again
+        {"bad request", []int{400}, 3, 1, 400},
+        {"not found", []int{404}, 3, 1, 404},
+    }
+    for _, tt := range tests {
+        r := newReceiver(t, tt.statuses...)
+        s := NewSender(r.URL, "")
+        s.Retries = tt.retries
+        s.Backoff = 10 * time.Millisecond
+        attempts, err := s.Send(context.Background(), []byte(`{}`))
+
+        var statusErr *StatusError
+        switch {
+        case tt.status == 0 && err != nil:
+            t.Errorf("%s: Send failed: %v", tt.name, err)
+        case tt.status != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.status):
+            t.Errorf("%s: error = %v, want status %d", tt.name, err, tt.status)
+        case tt.status != 0 && statusErr.Body != "try later":
+            t.Errorf("%s: body of the error = %q", tt.name, statusErr.Body)
+        }
+        if attempts != tt.attempts || len(r.requests) != tt.attempts {
+            t.Errorf("%s: %d attempts and %d requests, want %d", tt.name, attempts, len(r.requests), tt.attempts)
+        }
+    }
+}
+
+func TestSendBackoff(t *testing.T) {
+    r := newReceiver(t, 503, 503, 503)
+    s := NewSender(r.URL, "")
+    s.Backoff = 40 * time.Millisecond
+    if _, err := s.Send(context.Background(), []byte(`{}`)); err != nil {
+        t.Fatal(err)
+    }
+    // the wait is doubled for each retry
+    for i, want := range []time.Duration{40 * time.Millisecond, 80 * time.Millisecond, 160 * time.Millisecond} {
+        if got := r.times[i+1].Sub(r.times[i]); got < want || got > want + time.Second {
+            t.Errorf("wait before retry %d = %v, want %v", i+1, got, want)
+        }
+    }
+}
+
+func TestSendNetworkError(t *testing.T) {
+    r := newReceiver(t)
+    url := r.URL
+    r.Close()
+
+    s := NewSender(url, "")
+    s.Retries = 2
+    s.Backoff = time.Millisecond
+    attempts, err := s.Send(context.Background(), []byte(`{}`))
+    if err == nil || attempts != 3 {
+        t.Errorf("Send to a closed server = %d attempts, %v, want 3 attempts and an error", attempts, err)
+    }
+}
+
+func TestSendCanceled(t *testing.T) {
+    r := newReceiver(t, 503, 503)
+    s := NewSender(r.URL, "")
+    s.Backoff = time.Hour
+    ctx, cancel := context.WithCancel(context.Background())
+    time.AfterFunc(20 * time.Millisecond, cancel)
+    attempts, err := s.Send(ctx, []byte(`{}`))
+    if !errors.Is(err, context.Canceled) || attempts != 1 {
+        t.Errorf("canceled Send = %d attempts, %v, want 1 attempt and %v", attempts, err, context.Canceled)
+    }
+}
+
+func TestAppendDeadLetter(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "state", "dead-letter.jsonl")
+    s := NewSender("https://example.com/hook", "secret")
+    bodies := []string{`{"weight":66.4}`, `{"weight":66.2}`}
+    for _, body := range bodies {
+        d := NewDeadLetter(s, []byte(body), 4, &StatusError{StatusCode: 503, Status: "503 Service Unavailable"})
+        if err := AppendDeadLetter(path, d); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    info, err := os.Stat(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if info.Mode().Perm() != 0600 {
+        t.Errorf("dead letter file mode = %v, want 0600", info.Mode().Perm())
+    }
+    f, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    var letters []*DeadLetter
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        d := &DeadLetter{}
+        if err := json.Unmarshal(scanner.Bytes(), d); err != nil {
+            t.Fatalf("invalid line %s: %v", scanner.Text(), err)
+        }
+        letters = append(letters, d)
+    }
+    if len(letters) != len(bodies) {
+        t.Fatalf("got %d dead letters, want %d", len(letters), len(bodies))
+    }
+    for i, d := range letters {
+        if d.Body != bodies[i] || d.URL != s.URL || d.ContentType != DefaultContentType || d.Attempts != 4 || d.Error != "[Webhook]503 Service Unavailable" || d.Time.IsZero() {
+            t.Errorf("dead letter %d = %+v", i, d)
+        }
+    }
+}